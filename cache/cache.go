@@ -66,6 +66,8 @@ type URIObj struct {
 	ResponseHeaders http.Header
 	Content         [][]byte
 	Stale           bool
+	// Partition - Separates the responses of the same URL (e.g. per user).
+	Partition string
 }
 
 // IsStatusAllowed - Checks if a status code is allowed to be cached.
@@ -268,6 +270,9 @@ func (c Object) PurgeFullPage(ctx context.Context) (bool, error) {
 // StorageKey - Returns the cache key for the requested URL.
 func StorageKey(currentURIObject URIObj, meta []string) string {
 	key := []string{"DATA", currentURIObject.Method, currentURIObject.URL.String(), currentURIObject.GetHeadersChecksum(meta)}
+	if currentURIObject.Partition != "" {
+		key = append(key, currentURIObject.Partition)
+	}
 	storageKey := strings.Join(key, utils.StringSeparatorOne)
 
 	return storageKey
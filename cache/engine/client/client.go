@@ -252,6 +252,14 @@ func (rdb *RedisClient) Expire(key string, expiration time.Duration) error {
 	return err
 }
 
+// Run - Runs a Lua script (atomically), the keys must share the same hash
+// slot when running on a cluster.
+func (rdb *RedisClient) Run(ctx context.Context, script *goredislib.Script, keys []string, args ...interface{}) (interface{}, error) {
+	return circuitbreaker.CB(rdb.Name, rdb.logger).Execute(func() (interface{}, error) {
+		return script.Run(ctx, rdb.Client, keys, args...).Result()
+	})
+}
+
 // Encode - Encodes an object with msgpack.
 func (rdb *RedisClient) Encode(obj interface{}) (string, error) {
 	value, err := msgpack.Encode(obj)
@@ -10,11 +10,18 @@ package config
 // Repo: https://github.com/fabiocicerchia/go-proxy-cache
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
@@ -63,6 +70,23 @@ func getFromYaml(file string) (Configuration, error) {
 
 	YamlConfig.Server.Upstream.Scheme = scheme.NormalizeScheme(YamlConfig.Server.Upstream.Scheme)
 
+	err = validateServer(YamlConfig.Server)
+	if err == nil {
+		err = validateJwt(YamlConfig.Jwt)
+	}
+	for _, v := range YamlConfig.Domains {
+		if err == nil {
+			err = validateServer(v.Server)
+		}
+		if err == nil {
+			err = validateJwt(v.Jwt)
+		}
+	}
+
+	if err == nil {
+		err = validateProxyProtocolPorts(merge(YamlConfig, &file))
+	}
+
 	return YamlConfig, err
 }
 
@@ -79,7 +103,7 @@ func InitConfigFromFileOrEnv(file string) {
 	// JWT for the global configuration. Without this the global JwkCache was
 	// never initialised (only per-domain configs got InitJWT), so a JWKS URL
 	// configured globally could never be used for validation.
-	if Config.Jwt.JwksUrl != "" {
+	if Config.Jwt.IsEnabled() {
 		InitJWT(&Config.Jwt)
 	}
 
@@ -119,9 +143,79 @@ func InitJWT(jwtConfig *Jwt) {
 		)
 	}
 
+	// Every provider's JWKS URL shares the same cache.
+	providers := make([]JwtProvider, len(jwtConfig.Providers))
+	for k, v := range jwtConfig.Providers {
+		if v.JwksUrl != "" && !jwtKeyFetcher.IsRegistered(v.JwksUrl) {
+			jwtKeyFetcher.Register(
+				v.JwksUrl,
+				jwk.WithMinRefreshInterval(refreshIntervalDuration),
+			)
+		}
+
+		keySet, err := loadJwtKeySet(v)
+		if err != nil {
+			log.Errorf("Cannot load the JWT keys of the provider %s: %s", v.Issuer, err)
+		}
+
+		v.keySet = keySet
+		providers[k] = v
+	}
+
+	jwtConfig.Providers = providers
 	jwtConfig.JwkCache = jwtKeyFetcher
 }
 
+// loadJwtKeySet - Loads the static keys of the provider: the public keys
+// (PEM or JWK, inline or from file) and the HMAC secret.
+func loadJwtKeySet(provider JwtProvider) (jwk.Set, error) {
+	keySet := jwk.NewSet()
+
+	for _, v := range provider.PublicKeys {
+		data := []byte(strings.TrimSpace(v))
+		if !isInlineKey(data) {
+			content, err := os.ReadFile(filepath.Clean(v))
+			if err != nil {
+				return keySet, err
+			}
+
+			data = bytes.TrimSpace(content)
+		}
+
+		keys, err := jwk.Parse(data, jwk.WithPEM(!bytes.HasPrefix(data, []byte("{"))))
+		if err != nil {
+			return keySet, err
+		}
+
+		for i := 0; i < keys.Len(); i++ {
+			key, _ := keys.Key(i)
+
+			// Only the public part is needed (and kept) to verify the tokens.
+			publicKey, err := jwk.PublicKeyOf(key)
+			if err != nil {
+				return keySet, err
+			}
+
+			_ = keySet.AddKey(publicKey)
+		}
+	}
+
+	if provider.Secret != "" {
+		key, err := jwk.FromRaw([]byte(provider.Secret))
+		if err != nil {
+			return keySet, err
+		}
+
+		_ = keySet.AddKey(key)
+	}
+
+	return keySet, nil
+}
+
+func isInlineKey(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("-----BEGIN")) || bytes.HasPrefix(data, []byte("{"))
+}
+
 func copyGlobalOverDomainConfig(file string) {
 	if Config.Domains != nil {
 		domains := Config.Domains
@@ -134,7 +228,7 @@ func copyGlobalOverDomainConfig(file string) {
 			if isJWKSUrl {
 				domain.Jwt.JwksUrl = os.Getenv("JWT_JWKS_URL_" + domainName)
 			}
-			if domain.Jwt.JwksUrl != "" {
+			if domain.Jwt.IsEnabled() {
 				InitJWT(&domain.Jwt)
 			}
 			domains[k] = domain
@@ -144,6 +238,49 @@ func copyGlobalOverDomainConfig(file string) {
 	}
 }
 
+// defaults - The configuration before any override.
+var defaults = Config
+
+// Load - Builds the whole configuration (defaults, environment variables, YAML
+// file and domains overrides) without touching the one in use, e.g. to reload
+// part of it. The JWKS are not fetched.
+func Load(file string) (Configuration, error) {
+	conf := defaults
+	conf.CopyOverWith(newFromEnv(), nil)
+
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		conf.Domains = Domains{}
+
+		return conf, nil
+	}
+
+	yamlConfig, err := getFromYaml(file)
+	if err != nil {
+		return conf, err
+	}
+
+	return merge(yamlConfig, &file), nil
+}
+
+// merge - Returns the configuration of the YAML file over the defaults and
+// the environment variables, with its domains.
+func merge(yamlConfig Configuration, file *string) Configuration {
+	conf := defaults
+	conf.CopyOverWith(newFromEnv(), nil)
+	conf.CopyOverWith(yamlConfig, file)
+
+	domains := Domains{}
+	for k, v := range yamlConfig.Domains {
+		domain := conf
+		domain.CopyOverWith(v, file)
+		domain.Domains = Domains{}
+		domains[k] = domain
+	}
+	conf.Domains = domains
+
+	return conf
+}
+
 // Validate - Validate a YAML config file is syntactically valid.
 func Validate(file string) (bool, error) {
 	_, err := getFromYaml(file)
@@ -172,8 +309,9 @@ func (c *Configuration) CopyOverWith(overrides Configuration, file *string) {
 	c.copyOverWithServer(overrides.Server)
 	c.copyOverWithTLS(overrides.Server, file)
 	c.copyOverWithTimeout(overrides.Server)
-	c.copyOverWithUpstream(overrides.Server)
+	c.copyOverWithUpstream(overrides.Server, file)
 	c.copyOverWithCache(overrides.Cache)
+	c.copyOverWithLocations(overrides.Server, file)
 	c.copyOverWithTracing(overrides.Tracing)
 	c.copyOverWithLog(overrides.Log)
 	c.copyOverWithJwt(overrides.Jwt)
@@ -189,6 +327,46 @@ func (c *Configuration) copyOverWithServer(overrides Server) {
 	c.Server.Purge.AllowedIPs = utils.Coalesce(overrides.Purge.AllowedIPs, c.Server.Purge.AllowedIPs).([]string)
 	c.Server.Purge.Secret = utils.Coalesce(overrides.Purge.Secret, c.Server.Purge.Secret).(string)
 	c.Server.Purge.SecretHeader = utils.Coalesce(overrides.Purge.SecretHeader, c.Server.Purge.SecretHeader).(string)
+
+	c.Server.RateLimit.Enabled = utils.Coalesce(overrides.RateLimit.Enabled, c.Server.RateLimit.Enabled).(bool)
+	c.Server.RateLimit.Algorithm = utils.Coalesce(overrides.RateLimit.Algorithm, c.Server.RateLimit.Algorithm).(string)
+	c.Server.RateLimit.Limit = utils.Coalesce(overrides.RateLimit.Limit, c.Server.RateLimit.Limit).(int)
+	c.Server.RateLimit.Period = utils.Coalesce(overrides.RateLimit.Period, c.Server.RateLimit.Period).(time.Duration)
+	c.Server.RateLimit.Burst = utils.Coalesce(overrides.RateLimit.Burst, c.Server.RateLimit.Burst).(int)
+	c.Server.RateLimit.Key = utils.Coalesce(overrides.RateLimit.Key, c.Server.RateLimit.Key).(string)
+	c.Server.RateLimit.Header = utils.Coalesce(overrides.RateLimit.Header, c.Server.RateLimit.Header).(string)
+
+	c.Server.TrustedProxies = utils.Coalesce(overrides.TrustedProxies, c.Server.TrustedProxies).([]string)
+	c.Server.TrustedProxiesHeader = utils.Coalesce(overrides.TrustedProxiesHeader, c.Server.TrustedProxiesHeader).(string)
+	c.Server.AccessControl.Allow = utils.Coalesce(overrides.AccessControl.Allow, c.Server.AccessControl.Allow).([]string)
+	c.Server.AccessControl.Deny = utils.Coalesce(overrides.AccessControl.Deny, c.Server.AccessControl.Deny).([]string)
+	c.Server.AccessControl.Status = utils.Coalesce(overrides.AccessControl.Status, c.Server.AccessControl.Status).(int)
+
+	c.Server.ProxyProtocol.HTTP = utils.Coalesce(overrides.ProxyProtocol.HTTP, c.Server.ProxyProtocol.HTTP).(bool)
+	c.Server.ProxyProtocol.HTTPS = utils.Coalesce(overrides.ProxyProtocol.HTTPS, c.Server.ProxyProtocol.HTTPS).(bool)
+	c.Server.ProxyProtocol.TrustedSources = utils.Coalesce(overrides.ProxyProtocol.TrustedSources, c.Server.ProxyProtocol.TrustedSources).([]string)
+	c.Server.ProxyProtocol.ReadHeaderTimeout = utils.Coalesce(overrides.ProxyProtocol.ReadHeaderTimeout, c.Server.ProxyProtocol.ReadHeaderTimeout).(time.Duration)
+
+	c.Server.ForwardAuth.Address = utils.Coalesce(overrides.ForwardAuth.Address, c.Server.ForwardAuth.Address).(string)
+	c.Server.ForwardAuth.RequestHeaders = utils.Coalesce(overrides.ForwardAuth.RequestHeaders, c.Server.ForwardAuth.RequestHeaders).([]string)
+	c.Server.ForwardAuth.ResponseHeaders = utils.Coalesce(overrides.ForwardAuth.ResponseHeaders, c.Server.ForwardAuth.ResponseHeaders).([]string)
+	c.Server.ForwardAuth.Timeout = utils.Coalesce(overrides.ForwardAuth.Timeout, c.Server.ForwardAuth.Timeout).(time.Duration)
+	c.Server.ForwardAuth.CacheTTL = utils.Coalesce(overrides.ForwardAuth.CacheTTL, c.Server.ForwardAuth.CacheTTL).(time.Duration)
+
+	c.Server.WebSocket.MaxConnections = utils.Coalesce(overrides.WebSocket.MaxConnections, c.Server.WebSocket.MaxConnections).(int)
+	c.Server.WebSocket.IdleTimeout = utils.Coalesce(overrides.WebSocket.IdleTimeout, c.Server.WebSocket.IdleTimeout).(time.Duration)
+	c.Server.WebSocket.MaxLifetime = utils.Coalesce(overrides.WebSocket.MaxLifetime, c.Server.WebSocket.MaxLifetime).(time.Duration)
+	c.Server.WebSocket.AllowedOrigins = utils.Coalesce(overrides.WebSocket.AllowedOrigins, c.Server.WebSocket.AllowedOrigins).([]string)
+
+	if len(overrides.Rewrites) > 0 {
+		c.Server.Rewrites = compileRewrites(overrides.Rewrites)
+	}
+	if len(overrides.Headers.Request) > 0 {
+		c.Server.Headers.Request = compileHeaderRules(overrides.Headers.Request)
+	}
+	if len(overrides.Headers.Response) > 0 {
+		c.Server.Headers.Response = compileHeaderRules(overrides.Headers.Response)
+	}
 }
 
 // --- TLS.
@@ -199,9 +377,41 @@ func (c *Configuration) copyOverWithTLS(overrides Server, file *string) {
 	c.Server.TLS.KeyFile = utils.Coalesce(overrides.TLS.KeyFile, c.Server.TLS.KeyFile).(string)
 	c.Server.TLS.Override = utils.Coalesce(overrides.TLS.Override, c.Server.TLS.Override).(*tls.Config)
 	c.Server.TLS.CertCacheDir = utils.Coalesce(overrides.TLS.CertCacheDir, c.Server.TLS.CertCacheDir).(string)
+	c.Server.TLS.ACME.DirectoryURL = utils.Coalesce(overrides.TLS.ACME.DirectoryURL, c.Server.TLS.ACME.DirectoryURL).(string)
+	c.Server.TLS.ACME.CAFile = utils.Coalesce(overrides.TLS.ACME.CAFile, c.Server.TLS.ACME.CAFile).(string)
+	c.Server.TLS.ACME.EABKeyID = utils.Coalesce(overrides.TLS.ACME.EABKeyID, c.Server.TLS.ACME.EABKeyID).(string)
+	c.Server.TLS.ACME.EABHMACKey = utils.Coalesce(overrides.TLS.ACME.EABHMACKey, c.Server.TLS.ACME.EABHMACKey).(string)
+	c.Server.TLS.ACME.KeyType = utils.Coalesce(overrides.TLS.ACME.KeyType, c.Server.TLS.ACME.KeyType).(string)
+	c.Server.TLS.ACME.Storage = utils.Coalesce(overrides.TLS.ACME.Storage, c.Server.TLS.ACME.Storage).(string)
+
+	c.Server.TLS.DefaultCertFile = utils.Coalesce(overrides.TLS.DefaultCertFile, c.Server.TLS.DefaultCertFile).(string)
+	c.Server.TLS.DefaultKeyFile = utils.Coalesce(overrides.TLS.DefaultKeyFile, c.Server.TLS.DefaultKeyFile).(string)
+	if len(overrides.TLS.Certificates) > 0 {
+		c.Server.TLS.Certificates = make([]CertificatePair, 0, len(overrides.TLS.Certificates))
+		for _, v := range overrides.TLS.Certificates {
+			c.Server.TLS.Certificates = append(c.Server.TLS.Certificates, CertificatePair{
+				CertFile: patchAbsFilePath(v.CertFile, file),
+				KeyFile:  patchAbsFilePath(v.KeyFile, file),
+			})
+		}
+	}
+	c.Server.TLS.OCSP.Enabled = utils.Coalesce(overrides.TLS.OCSP.Enabled, c.Server.TLS.OCSP.Enabled).(bool)
+	c.Server.TLS.OCSP.Responder = utils.Coalesce(overrides.TLS.OCSP.Responder, c.Server.TLS.OCSP.Responder).(string)
+	c.Server.TLS.OCSP.CacheDir = utils.Coalesce(overrides.TLS.OCSP.CacheDir, c.Server.TLS.OCSP.CacheDir).(string)
+	c.Server.TLS.ClientAuth.Mode = utils.Coalesce(overrides.TLS.ClientAuth.Mode, c.Server.TLS.ClientAuth.Mode).(string)
+	c.Server.TLS.ClientAuth.CAFile = utils.Coalesce(overrides.TLS.ClientAuth.CAFile, c.Server.TLS.ClientAuth.CAFile).(string)
+	c.Server.TLS.ClientAuth.CRLFile = utils.Coalesce(overrides.TLS.ClientAuth.CRLFile, c.Server.TLS.ClientAuth.CRLFile).(string)
+	c.Server.TLS.HTTP3.Enabled = utils.Coalesce(overrides.TLS.HTTP3.Enabled, c.Server.TLS.HTTP3.Enabled).(bool)
+	c.Server.TLS.HTTP3.AltSvcMaxAge = utils.Coalesce(overrides.TLS.HTTP3.AltSvcMaxAge, c.Server.TLS.HTTP3.AltSvcMaxAge).(time.Duration)
 
 	c.Server.TLS.CertFile = patchAbsFilePath(c.Server.TLS.CertFile, file)
 	c.Server.TLS.KeyFile = patchAbsFilePath(c.Server.TLS.KeyFile, file)
+	c.Server.TLS.DefaultCertFile = patchAbsFilePath(c.Server.TLS.DefaultCertFile, file)
+	c.Server.TLS.DefaultKeyFile = patchAbsFilePath(c.Server.TLS.DefaultKeyFile, file)
+	c.Server.TLS.OCSP.CacheDir = patchAbsFilePath(c.Server.TLS.OCSP.CacheDir, file)
+	c.Server.TLS.ACME.CAFile = patchAbsFilePath(c.Server.TLS.ACME.CAFile, file)
+	c.Server.TLS.ClientAuth.CAFile = patchAbsFilePath(c.Server.TLS.ClientAuth.CAFile, file)
+	c.Server.TLS.ClientAuth.CRLFile = patchAbsFilePath(c.Server.TLS.ClientAuth.CRLFile, file)
 }
 
 // --- TIMEOUT.
@@ -214,7 +424,7 @@ func (c *Configuration) copyOverWithTimeout(overrides Server) {
 }
 
 // --- UPSTREAM.
-func (c *Configuration) copyOverWithUpstream(overrides Server) {
+func (c *Configuration) copyOverWithUpstream(overrides Server, file *string) {
 	c.Server.Upstream.Host = utils.Coalesce(overrides.Upstream.Host, c.Server.Upstream.Host).(string)
 	c.Server.Upstream.Port = utils.Coalesce(overrides.Upstream.Port, c.Server.Upstream.Port).(string)
 	c.Server.Upstream.Scheme = utils.Coalesce(overrides.Upstream.Scheme, c.Server.Upstream.Scheme).(string)
@@ -222,6 +432,17 @@ func (c *Configuration) copyOverWithUpstream(overrides Server) {
 	c.Server.Upstream.Endpoints = utils.Coalesce(overrides.Upstream.Endpoints, c.Server.Upstream.Endpoints).([]string)
 	c.Server.Upstream.HTTP2HTTPS = utils.Coalesce(overrides.Upstream.HTTP2HTTPS, c.Server.Upstream.HTTP2HTTPS).(bool)
 	c.Server.Upstream.InsecureBridge = utils.Coalesce(overrides.Upstream.InsecureBridge, c.Server.Upstream.InsecureBridge).(bool)
+	c.Server.Upstream.TLS.CAFile = utils.Coalesce(overrides.Upstream.TLS.CAFile, c.Server.Upstream.TLS.CAFile).(string)
+	c.Server.Upstream.TLS.CertFile = utils.Coalesce(overrides.Upstream.TLS.CertFile, c.Server.Upstream.TLS.CertFile).(string)
+	c.Server.Upstream.TLS.KeyFile = utils.Coalesce(overrides.Upstream.TLS.KeyFile, c.Server.Upstream.TLS.KeyFile).(string)
+	c.Server.Upstream.TLS.ServerName = utils.Coalesce(overrides.Upstream.TLS.ServerName, c.Server.Upstream.TLS.ServerName).(string)
+	c.Server.Upstream.TLS.MinVersion = utils.Coalesce(overrides.Upstream.TLS.MinVersion, c.Server.Upstream.TLS.MinVersion).(string)
+
+	c.Server.Upstream.Protocol = utils.Coalesce(overrides.Upstream.Protocol, c.Server.Upstream.Protocol).(string)
+	c.Server.Upstream.Stream.Enabled = utils.Coalesce(overrides.Upstream.Stream.Enabled, c.Server.Upstream.Stream.Enabled).(bool)
+	c.Server.Upstream.Stream.ContentTypes = utils.Coalesce(overrides.Upstream.Stream.ContentTypes, c.Server.Upstream.Stream.ContentTypes).([]string)
+	c.Server.Upstream.Stream.IdleTimeout = utils.Coalesce(overrides.Upstream.Stream.IdleTimeout, c.Server.Upstream.Stream.IdleTimeout).(time.Duration)
+	c.Server.Upstream.Stream.MaxDuration = utils.Coalesce(overrides.Upstream.Stream.MaxDuration, c.Server.Upstream.Stream.MaxDuration).(time.Duration)
 	c.Server.Upstream.RedirectStatusCode = utils.Coalesce(overrides.Upstream.RedirectStatusCode, c.Server.Upstream.RedirectStatusCode).(int)
 	c.Server.Upstream.HealthCheck.StatusCodes = utils.Coalesce(overrides.Upstream.HealthCheck.StatusCodes, c.Server.Upstream.HealthCheck.StatusCodes).([]string)
 	c.Server.Upstream.HealthCheck.Timeout = utils.Coalesce(overrides.Upstream.HealthCheck.Timeout, c.Server.Upstream.HealthCheck.Timeout).(time.Duration)
@@ -229,8 +450,567 @@ func (c *Configuration) copyOverWithUpstream(overrides Server) {
 	c.Server.Upstream.HealthCheck.Port = utils.Coalesce(overrides.Upstream.HealthCheck.Port, c.Server.Upstream.HealthCheck.Port).(string)
 	c.Server.Upstream.HealthCheck.Scheme = utils.Coalesce(overrides.Upstream.HealthCheck.Scheme, c.Server.Upstream.HealthCheck.Scheme).(string)
 	c.Server.Upstream.HealthCheck.AllowInsecure = utils.Coalesce(overrides.Upstream.HealthCheck.AllowInsecure, c.Server.Upstream.HealthCheck.AllowInsecure).(bool)
+	c.Server.Upstream.StickySession.Enabled = utils.Coalesce(overrides.Upstream.StickySession.Enabled, c.Server.Upstream.StickySession.Enabled).(bool)
+	c.Server.Upstream.StickySession.CookieName = utils.Coalesce(overrides.Upstream.StickySession.CookieName, c.Server.Upstream.StickySession.CookieName).(string)
+	c.Server.Upstream.StickySession.TTL = utils.Coalesce(overrides.Upstream.StickySession.TTL, c.Server.Upstream.StickySession.TTL).(time.Duration)
+	c.Server.Upstream.StickySession.Secret = utils.Coalesce(overrides.Upstream.StickySession.Secret, c.Server.Upstream.StickySession.Secret).(string)
+	c.Server.Upstream.StickySession.Path = utils.Coalesce(overrides.Upstream.StickySession.Path, c.Server.Upstream.StickySession.Path).(string)
+	c.Server.Upstream.StickySession.Domain = utils.Coalesce(overrides.Upstream.StickySession.Domain, c.Server.Upstream.StickySession.Domain).(string)
+	c.Server.Upstream.StickySession.Secure = utils.Coalesce(overrides.Upstream.StickySession.Secure, c.Server.Upstream.StickySession.Secure).(bool)
+	c.Server.Upstream.StickySession.HTTPOnly = utils.Coalesce(overrides.Upstream.StickySession.HTTPOnly, c.Server.Upstream.StickySession.HTTPOnly).(bool)
+	c.Server.Upstream.StickySession.SameSite = utils.Coalesce(overrides.Upstream.StickySession.SameSite, c.Server.Upstream.StickySession.SameSite).(string)
+	c.Server.Upstream.SlowStart.Duration = utils.Coalesce(overrides.Upstream.SlowStart.Duration, c.Server.Upstream.SlowStart.Duration).(time.Duration)
+	c.Server.Upstream.SlowStart.MinWeight = utils.Coalesce(overrides.Upstream.SlowStart.MinWeight, c.Server.Upstream.SlowStart.MinWeight).(int)
+	c.Server.Upstream.Concurrency.MaxConnsPerHost = utils.Coalesce(overrides.Upstream.Concurrency.MaxConnsPerHost, c.Server.Upstream.Concurrency.MaxConnsPerHost).(int)
+	c.Server.Upstream.Concurrency.MaxRequests = utils.Coalesce(overrides.Upstream.Concurrency.MaxRequests, c.Server.Upstream.Concurrency.MaxRequests).(int)
+	c.Server.Upstream.Concurrency.MaxRequestsPerNode = utils.Coalesce(overrides.Upstream.Concurrency.MaxRequestsPerNode, c.Server.Upstream.Concurrency.MaxRequestsPerNode).(int)
+	c.Server.Upstream.Concurrency.QueueSize = utils.Coalesce(overrides.Upstream.Concurrency.QueueSize, c.Server.Upstream.Concurrency.QueueSize).(int)
+	c.Server.Upstream.Concurrency.QueueTimeout = utils.Coalesce(overrides.Upstream.Concurrency.QueueTimeout, c.Server.Upstream.Concurrency.QueueTimeout).(time.Duration)
 
 	c.Server.Upstream.Scheme = utils.IfEmpty(c.Server.Upstream.Scheme, SchemeWildcard)
+
+	c.Server.Upstream.TLS.CAFile = patchAbsFilePath(c.Server.Upstream.TLS.CAFile, file)
+	c.Server.Upstream.TLS.CertFile = patchAbsFilePath(c.Server.Upstream.TLS.CertFile, file)
+	c.Server.Upstream.TLS.KeyFile = patchAbsFilePath(c.Server.Upstream.TLS.KeyFile, file)
+}
+
+func validateServer(server Server) error {
+	if err := validateHeaders(server.Headers); err != nil {
+		return err
+	}
+
+	if err := validateRewrites(server.Rewrites); err != nil {
+		return err
+	}
+
+	if err := validateRateLimit(server.RateLimit); err != nil {
+		return err
+	}
+
+	if err := validateConcurrency(server.Upstream.Concurrency); err != nil {
+		return err
+	}
+
+	if err := validateIPs("trusted proxies", server.TrustedProxies); err != nil {
+		return err
+	}
+
+	if err := validateTrustedProxiesHeader(server.TrustedProxiesHeader); err != nil {
+		return err
+	}
+
+	if err := validateAccessControl(server.AccessControl); err != nil {
+		return err
+	}
+
+	if err := validateIPs("proxy protocol trusted sources", server.ProxyProtocol.TrustedSources); err != nil {
+		return err
+	}
+
+	if err := validateForwardAuth(server.ForwardAuth); err != nil {
+		return err
+	}
+
+	if err := validateCertificates(server.TLS); err != nil {
+		return err
+	}
+
+	if err := validateACME(server.TLS.ACME); err != nil {
+		return err
+	}
+
+	if err := validateClientAuth(server.TLS.ClientAuth); err != nil {
+		return err
+	}
+
+	if err := validateHTTP3(server.TLS); err != nil {
+		return err
+	}
+
+	if err := validateUpstreamTLS(server.Upstream.TLS); err != nil {
+		return err
+	}
+
+	if err := validateUpstreamProtocol(server.Upstream.Protocol); err != nil {
+		return err
+	}
+
+	if err := validateStream(server.Upstream.Stream); err != nil {
+		return err
+	}
+
+	if err := validateWebSocket(server.WebSocket); err != nil {
+		return err
+	}
+
+	return validateLocations(server.Locations)
+}
+
+// --- LOCATIONS.
+func validateLocations(locations Locations) error {
+	for k, v := range locations {
+		if v.Prefix == "" && v.Regex == "" {
+			return fmt.Errorf("location #%d must have either a prefix or a regex", k)
+		}
+
+		if _, err := regexp.Compile(v.Regex); err != nil {
+			return fmt.Errorf("location #%d has an invalid regex: %s", k, err)
+		}
+
+		if err := validateHeaders(v.Headers); err != nil {
+			return fmt.Errorf("location #%d: %s", k, err)
+		}
+
+		if err := validateRateLimit(v.RateLimit); err != nil {
+			return fmt.Errorf("location #%d: %s", k, err)
+		}
+
+		if err := validateConcurrency(v.Upstream.Concurrency); err != nil {
+			return fmt.Errorf("location #%d: %s", k, err)
+		}
+
+		if err := validateAccessControl(v.AccessControl); err != nil {
+			return fmt.Errorf("location #%d: %s", k, err)
+		}
+
+		if err := validateForwardAuth(v.ForwardAuth); err != nil {
+			return fmt.Errorf("location #%d: %s", k, err)
+		}
+
+		if err := validateUpstreamTLS(v.Upstream.TLS); err != nil {
+			return fmt.Errorf("location #%d: %s", k, err)
+		}
+
+		if err := validateUpstreamProtocol(v.Upstream.Protocol); err != nil {
+			return fmt.Errorf("location #%d: %s", k, err)
+		}
+
+		if err := validateStream(v.Upstream.Stream); err != nil {
+			return fmt.Errorf("location #%d: %s", k, err)
+		}
+	}
+
+	return nil
+}
+
+// copyOverWithLocations - Locations inherit every unset upstream and cache
+// setting from the domain, so it must run after copyOverWithUpstream and
+// copyOverWithCache.
+func (c *Configuration) copyOverWithLocations(overrides Server, file *string) {
+	if len(overrides.Locations) > 0 {
+		c.Server.Locations = overrides.Locations
+	}
+
+	locations := make(Locations, len(c.Server.Locations))
+	for k, v := range c.Server.Locations {
+		base := Configuration{
+			Server: Server{Upstream: c.Server.Upstream},
+			Cache:  c.Cache,
+		}
+		base.copyOverWithUpstream(Server{Upstream: v.Upstream}, file)
+		base.copyOverWithCache(v.Cache)
+
+		v.Name = utils.IfEmpty(v.Name, utils.IfEmpty(v.Prefix, v.Regex))
+		v.Upstream = base.Server.Upstream
+		// The location belongs to the domain, it cannot change the matching
+		// rules nor the Redis connection.
+		v.Upstream.Host = c.Server.Upstream.Host
+		v.Upstream.Scheme = c.Server.Upstream.Scheme
+		v.Cache = base.Cache
+		v.Cache.Hosts = c.Cache.Hosts
+		v.Cache.Password = c.Cache.Password
+		v.Cache.DB = c.Cache.DB
+		v.Headers = compileHeaders(v.Headers)
+
+		if v.Prefix == "" && v.Regex != "" {
+			regex, err := regexp.Compile(v.Regex)
+			if err != nil {
+				log.Errorf("Location %s has an invalid regex, it will be ignored: %s", v.Name, err)
+			}
+			v.regex = regex
+		}
+
+		locations[k] = v
+	}
+
+	c.Server.Locations = locations
+}
+
+// --- HEADERS.
+func validateHeaders(headers Headers) error {
+	for _, v := range append(append([]HeaderRule{}, headers.Request...), headers.Response...) {
+		switch v.Action {
+		case HeaderActionAdd, HeaderActionSet, HeaderActionRemove, HeaderActionReplace:
+		default:
+			return fmt.Errorf("header rule on %s has an invalid action: %s", v.Name, v.Action)
+		}
+
+		if v.Name == "" {
+			return fmt.Errorf("header rule with action %s has no name", v.Action)
+		}
+
+		if _, err := regexp.Compile(v.Pattern); err != nil {
+			return fmt.Errorf("header rule on %s has an invalid pattern: %s", v.Name, err)
+		}
+	}
+
+	return nil
+}
+
+func compileHeaderRules(rules []HeaderRule) []HeaderRule {
+	compiled := make([]HeaderRule, len(rules))
+	for k, v := range rules {
+		if v.Action == HeaderActionReplace {
+			pattern, err := regexp.Compile(v.Pattern)
+			if err != nil {
+				log.Errorf("Header rule on %s has an invalid pattern, it will be ignored: %s", v.Name, err)
+			}
+			v.pattern = pattern
+		}
+
+		compiled[k] = v
+	}
+
+	return compiled
+}
+
+func compileHeaders(headers Headers) Headers {
+	return Headers{
+		Request:  compileHeaderRules(headers.Request),
+		Response: compileHeaderRules(headers.Response),
+	}
+}
+
+// --- RATE LIMIT.
+func validateRateLimit(rateLimit RateLimit) error {
+	if !rateLimit.Enabled {
+		return nil
+	}
+
+	switch rateLimit.Algorithm {
+	case "", RateLimitTokenBucket, RateLimitSlidingWindow:
+	default:
+		return fmt.Errorf("rate limit has an invalid algorithm: %s", rateLimit.Algorithm)
+	}
+
+	switch rateLimit.Key {
+	case "", RateLimitKeyIP, RateLimitKeyJWTSubject, RateLimitKeyAPIKey:
+	case RateLimitKeyHeader:
+		if rateLimit.Header == "" {
+			return fmt.Errorf("rate limit by header requires the header name")
+		}
+	default:
+		return fmt.Errorf("rate limit has an invalid key: %s", rateLimit.Key)
+	}
+
+	if rateLimit.Limit <= 0 || rateLimit.Period <= 0 {
+		return fmt.Errorf("rate limit requires a positive limit and period")
+	}
+
+	return nil
+}
+
+// --- CONCURRENCY.
+func validateConcurrency(concurrency Concurrency) error {
+	if concurrency.MaxConnsPerHost < 0 || concurrency.MaxRequests < 0 || concurrency.MaxRequestsPerNode < 0 ||
+		concurrency.QueueSize < 0 || concurrency.QueueTimeout < 0 {
+		return fmt.Errorf("concurrency limits cannot be negative")
+	}
+
+	return nil
+}
+
+// --- ACCESS CONTROL.
+func validateAccessControl(accessControl AccessControl) error {
+	switch accessControl.Status {
+	case 0, http.StatusForbidden, http.StatusNotFound:
+	default:
+		return fmt.Errorf("access control has an invalid status: %d", accessControl.Status)
+	}
+
+	if err := validateIPs("access control allow list", accessControl.Allow); err != nil {
+		return err
+	}
+
+	return validateIPs("access control deny list", accessControl.Deny)
+}
+
+// --- FORWARD AUTH.
+func validateForwardAuth(forwardAuth ForwardAuth) error {
+	if !forwardAuth.IsEnabled() {
+		return nil
+	}
+
+	u, err := url.Parse(forwardAuth.Address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("forward auth has an invalid address: %s", forwardAuth.Address)
+	}
+
+	if forwardAuth.Timeout < 0 || forwardAuth.CacheTTL < 0 {
+		return fmt.Errorf("forward auth timeout and cache ttl cannot be negative")
+	}
+
+	return nil
+}
+
+func validateCertificates(tlsConfig TLS) error {
+	pairs := append(tlsConfig.GetCertificatePairs(), CertificatePair{CertFile: tlsConfig.DefaultCertFile, KeyFile: tlsConfig.DefaultKeyFile})
+
+	for _, v := range pairs {
+		if (v.CertFile == "") != (v.KeyFile == "") {
+			return fmt.Errorf("tls certificates require both the cert file and the key file")
+		}
+	}
+
+	if tlsConfig.OCSP.Responder != "" {
+		u, err := url.Parse(tlsConfig.OCSP.Responder)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("tls ocsp has an invalid responder: %s", tlsConfig.OCSP.Responder)
+		}
+	}
+
+	return nil
+}
+
+func validateACME(acme ACME) error {
+	if acme.DirectoryURL != "" {
+		u, err := url.Parse(acme.DirectoryURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("tls acme has an invalid directory url: %s", acme.DirectoryURL)
+		}
+	}
+
+	if (acme.EABKeyID == "") != (acme.EABHMACKey == "") {
+		return fmt.Errorf("tls acme external account binding requires both the key id and the hmac key")
+	}
+
+	if _, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(acme.EABHMACKey, "=")); err != nil {
+		return fmt.Errorf("tls acme has an invalid eab hmac key: %s", err)
+	}
+
+	switch acme.KeyType {
+	case "", ACMEKeyTypeECDSA, ACMEKeyTypeRSA:
+	default:
+		return fmt.Errorf("tls acme has an invalid key type: %s", acme.KeyType)
+	}
+
+	switch acme.Storage {
+	case "", ACMEStorageDir, ACMEStorageRedis:
+	default:
+		return fmt.Errorf("tls acme has an invalid storage: %s", acme.Storage)
+	}
+
+	return nil
+}
+
+// validateHTTP3 - QUIC requires TLS 1.3, it can't be excluded by the overrides.
+func validateHTTP3(tlsConfig TLS) error {
+	if !tlsConfig.HTTP3.Enabled {
+		return nil
+	}
+
+	if tlsConfig.HTTP3.AltSvcMaxAge < 0 {
+		return fmt.Errorf("tls http3 has an invalid alt-svc max age: %s", tlsConfig.HTTP3.AltSvcMaxAge)
+	}
+
+	if tlsConfig.Override != nil && tlsConfig.Override.MaxVersion != 0 && tlsConfig.Override.MaxVersion < tls.VersionTLS13 {
+		return fmt.Errorf("tls http3 requires tls 1.3, but the max version is lower")
+	}
+
+	return nil
+}
+
+func validateClientAuth(clientAuth ClientAuth) error {
+	if !clientAuth.IsEnabled() {
+		return nil
+	}
+
+	switch clientAuth.Mode {
+	case ClientAuthRequire, ClientAuthVerifyIfGiven, ClientAuthOptional:
+	default:
+		return fmt.Errorf("tls client auth has an invalid mode: %s", clientAuth.Mode)
+	}
+
+	if clientAuth.CAFile == "" {
+		return fmt.Errorf("tls client auth requires a ca file")
+	}
+
+	return nil
+}
+
+func validateUpstreamTLS(upstreamTLS UpstreamTLS) error {
+	if (upstreamTLS.CertFile == "") != (upstreamTLS.KeyFile == "") {
+		return fmt.Errorf("upstream tls requires both the cert file and the key file")
+	}
+
+	if _, ok := UpstreamTLSVersions[upstreamTLS.MinVersion]; upstreamTLS.MinVersion != "" && !ok {
+		return fmt.Errorf("upstream tls has an invalid min version: %s", upstreamTLS.MinVersion)
+	}
+
+	return nil
+}
+
+func validateUpstreamProtocol(protocol string) error {
+	switch protocol {
+	case "", UpstreamProtocolHTTP1, UpstreamProtocolH2, UpstreamProtocolH2C:
+		return nil
+	default:
+		return fmt.Errorf("upstream has an invalid protocol: %s", protocol)
+	}
+}
+
+func validateStream(stream Stream) error {
+	if stream.IdleTimeout < 0 {
+		return fmt.Errorf("upstream stream has an invalid idle timeout: %s", stream.IdleTimeout)
+	}
+
+	if stream.MaxDuration < 0 {
+		return fmt.Errorf("upstream stream has an invalid max duration: %s", stream.MaxDuration)
+	}
+
+	return nil
+}
+
+// --- WEBSOCKET.
+func validateWebSocket(webSocket WebSocket) error {
+	if webSocket.MaxConnections < 0 {
+		return fmt.Errorf("websocket max connections cannot be negative")
+	}
+
+	if webSocket.IdleTimeout < 0 || webSocket.MaxLifetime < 0 {
+		return fmt.Errorf("websocket idle timeout and max lifetime cannot be negative")
+	}
+
+	for _, v := range webSocket.AllowedOrigins {
+		if _, err := path.Match(v, ""); err != nil {
+			return fmt.Errorf("websocket has an invalid allowed origin: %s", v)
+		}
+	}
+
+	return nil
+}
+
+func validateTrustedProxiesHeader(header string) error {
+	switch strings.ToLower(header) {
+	case "", ClientIPHeaderXForwardedFor, ClientIPHeaderForwarded:
+		return nil
+	}
+
+	return fmt.Errorf("trusted proxies header must be x-forwarded-for or forwarded: %s", header)
+}
+
+// validateProxyProtocolPorts - The PROXY protocol is set on the listeners,
+// which are shared by the domains on the same port: they must agree on it.
+func validateProxyProtocolPorts(conf Configuration) error {
+	servers := []Server{conf.Server}
+	for _, v := range conf.Domains {
+		servers = append(servers, v.Server)
+	}
+
+	ports := map[string]string{}
+	for _, v := range servers {
+		listeners := map[string]bool{
+			"HTTP port " + v.Port.HTTP:   v.ProxyProtocol.HTTP,
+			"HTTPS port " + v.Port.HTTPS: v.ProxyProtocol.HTTPS,
+		}
+
+		for port, enabled := range listeners {
+			settings := "disabled"
+			if enabled {
+				timeout := v.ProxyProtocol.ReadHeaderTimeout
+				if timeout == 0 {
+					timeout = DefaultProxyProtocolReadHeaderTimeout
+				}
+
+				settings = fmt.Sprintf("enabled (trusted sources: %v, read header timeout: %s)", v.ProxyProtocol.TrustedSources, timeout)
+			}
+
+			if prev, ok := ports[port]; ok && prev != settings {
+				return fmt.Errorf("conflicting proxy protocol settings on the %s: %s and %s", port, prev, settings)
+			}
+
+			ports[port] = settings
+		}
+	}
+
+	return nil
+}
+
+func validateIPs(name string, entries []string) error {
+	for _, v := range entries {
+		v = strings.TrimSpace(v)
+
+		if _, _, err := net.ParseCIDR(v); err == nil {
+			continue
+		}
+
+		if net.ParseIP(v) == nil {
+			return fmt.Errorf("%s has an invalid IP: %s", name, v)
+		}
+	}
+
+	return nil
+}
+
+// --- REWRITES.
+func validateRewrites(rewrites Rewrites) error {
+	for k, v := range rewrites {
+		switch v.Redirect {
+		case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			return fmt.Errorf("rewrite #%d has an invalid redirect status code: %d", k, v.Redirect)
+		}
+
+		patterns := []string{v.Match, v.Conditions.Host, v.Conditions.Query}
+		for _, h := range v.Conditions.Headers {
+			patterns = append(patterns, h)
+		}
+
+		for _, p := range patterns {
+			if _, err := regexp.Compile(p); err != nil {
+				return fmt.Errorf("rewrite #%d has an invalid regex: %s", k, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// compileOptionalRegex - Empty patterns are not compiled, so they always match.
+func compileOptionalRegex(pattern string) *regexp.Regexp {
+	if pattern == "" {
+		return nil
+	}
+
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Errorf("Invalid regex %s, it will be ignored: %s", pattern, err)
+	}
+
+	return regex
+}
+
+func compileRewrites(rewrites Rewrites) Rewrites {
+	compiled := make(Rewrites, len(rewrites))
+	for k, v := range rewrites {
+		v.match = compileOptionalRegex(v.Match)
+		if v.match == nil {
+			log.Errorf("Rewrite #%d has no valid match, it will be ignored.", k)
+		}
+
+		v.Conditions.host = compileOptionalRegex(v.Conditions.Host)
+		v.Conditions.query = compileOptionalRegex(v.Conditions.Query)
+		v.Conditions.headers = make(map[string]*regexp.Regexp, len(v.Conditions.Headers))
+		for name, pattern := range v.Conditions.Headers {
+			if regex := compileOptionalRegex(pattern); regex != nil {
+				v.Conditions.headers[name] = regex
+			}
+		}
+
+		compiled[k] = v
+	}
+
+	return compiled
 }
 
 // --- CACHE.
@@ -267,10 +1047,71 @@ func (c *Configuration) copyOverWithJwt(overrides Jwt) {
 	c.Jwt.AllowedScopes = utils.Coalesce(overrides.AllowedScopes, c.Jwt.AllowedScopes).([]string)
 	c.Jwt.JwksUrl = utils.Coalesce(overrides.JwksUrl, c.Jwt.JwksUrl).(string)
 	c.Jwt.JwksRefreshInterval = utils.Coalesce(overrides.JwksRefreshInterval, c.Jwt.JwksRefreshInterval).(int)
+	c.Jwt.Issuer = utils.Coalesce(overrides.Issuer, c.Jwt.Issuer).(string)
+	c.Jwt.Audiences = utils.Coalesce(overrides.Audiences, c.Jwt.Audiences).([]string)
+
+	if len(overrides.RequiredClaims) > 0 {
+		c.Jwt.RequiredClaims = overrides.RequiredClaims
+	}
+	if len(overrides.ClaimsHeaders) > 0 {
+		c.Jwt.ClaimsHeaders = overrides.ClaimsHeaders
+	}
+
+	if len(overrides.Providers) > 0 {
+		c.Jwt.Providers = overrides.Providers
+	}
+	if len(overrides.Rules) > 0 {
+		c.Jwt.Rules = overrides.Rules
+	}
+
 	c.Jwt.Context = context.Background()
 	c.Jwt.Logger = log.New()
 }
 
+// --- JWT PROVIDERS.
+func validateJwt(jwt Jwt) error {
+	for k, v := range jwt.Providers {
+		if v.JwksUrl == "" && len(v.PublicKeys) == 0 && v.Secret == "" {
+			return fmt.Errorf("jwt provider #%d requires a jwks url, public keys or a secret", k)
+		}
+
+		if _, err := loadJwtKeySet(v); err != nil {
+			return fmt.Errorf("jwt provider #%d has invalid keys: %s", k, err)
+		}
+	}
+
+	for k, v := range jwt.Rules {
+		if v.Prefix == "" {
+			return fmt.Errorf("jwt rule #%d must have a prefix", k)
+		}
+	}
+
+	return nil
+}
+
+func obfuscateACME(acme *ACME) {
+	if acme.EABHMACKey != "" {
+		acme.EABHMACKey = PasswordOmittedValue
+	}
+}
+
+func obfuscateJwtProviders(providers []JwtProvider) {
+	for k := range providers {
+		if providers[k].Secret != "" {
+			providers[k].Secret = PasswordOmittedValue
+		}
+	}
+}
+
+func obfuscateLocations(locations Locations) {
+	for k := range locations {
+		locations[k].Cache.Password = PasswordOmittedValue
+		if locations[k].Upstream.StickySession.Secret != "" {
+			locations[k].Upstream.StickySession.Secret = PasswordOmittedValue
+		}
+	}
+}
+
 // Print - Shows the current configuration.
 func Print() {
 	obfuscatedConfig := Configuration{}
@@ -285,12 +1126,24 @@ func Print() {
 	if obfuscatedConfig.Server.Purge.Secret != "" {
 		obfuscatedConfig.Server.Purge.Secret = PasswordOmittedValue
 	}
+	if obfuscatedConfig.Server.Upstream.StickySession.Secret != "" {
+		obfuscatedConfig.Server.Upstream.StickySession.Secret = PasswordOmittedValue
+	}
+	obfuscateLocations(obfuscatedConfig.Server.Locations)
+	obfuscateJwtProviders(obfuscatedConfig.Jwt.Providers)
+	obfuscateACME(&obfuscatedConfig.Server.TLS.ACME)
 
 	for k, v := range obfuscatedConfig.Domains {
 		v.Cache.Password = PasswordOmittedValue
 		if v.Server.Purge.Secret != "" {
 			v.Server.Purge.Secret = PasswordOmittedValue
 		}
+		if v.Server.Upstream.StickySession.Secret != "" {
+			v.Server.Upstream.StickySession.Secret = PasswordOmittedValue
+		}
+		obfuscateLocations(v.Server.Locations)
+		obfuscateJwtProviders(v.Jwt.Providers)
+		obfuscateACME(&v.Server.TLS.ACME)
 		obfuscatedConfig.Domains[k] = v
 	}
 
@@ -13,6 +13,8 @@ import (
 	"context"
 	"crypto/tls"
 	"net/http"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/fabiocicerchia/go-proxy-cache/utils"
@@ -21,6 +23,18 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// DefaultStreamContentType - Default value used for the streamed content types.
+const DefaultStreamContentType = "text/event-stream"
+
+// DefaultStreamIdleTimeout - Default value used for the streams' idle timeout.
+var DefaultStreamIdleTimeout time.Duration = 1 * time.Minute
+
+// DefaultStreamMaxDuration - Default value used for the streams' max duration.
+var DefaultStreamMaxDuration time.Duration = 1 * time.Hour
+
+// DefaultHTTP3AltSvcMaxAge - Default value used for the Alt-Svc's max age.
+var DefaultHTTP3AltSvcMaxAge time.Duration = 24 * time.Hour
+
 // DefaultTimeoutRead - Default value used for http.Server.ReadTimeout
 var DefaultTimeoutRead time.Duration = 5 * time.Second
 
@@ -60,7 +74,7 @@ type Configuration struct {
 	Log            Log                           `yaml:"log"`
 	Tracing        Tracing                       `yaml:"tracing"`
 	domainsCache   map[string]Configuration
-	Jwt		   	   Jwt					 		 `yaml:"jwt"`
+	Jwt            Jwt `yaml:"jwt"`
 }
 
 // Domains - Overrides per domain.
@@ -78,6 +92,287 @@ type Server struct {
 	GZip      bool      `yaml:"gzip" envconfig:"GZIP_ENABLED"`
 	Internals Internals `yaml:"internals"`
 	Purge     Purge     `yaml:"purge"`
+	Locations Locations `yaml:"locations"`
+	Headers   Headers   `yaml:"headers"`
+	Rewrites  Rewrites  `yaml:"rewrites"`
+	RateLimit RateLimit `yaml:"rate_limit"`
+	// TrustedProxies - IPs (or CIDRs) of the proxies in front of the server,
+	// allowed to set the client IP through the TrustedProxiesHeader.
+	TrustedProxies []string `yaml:"trusted_proxies" envconfig:"TRUSTED_PROXIES" split_words:"true"`
+	// TrustedProxiesHeader - Header written by the trusted proxies, one of
+	// x-forwarded-for (default) or forwarded. The other one is ignored.
+	TrustedProxiesHeader string        `yaml:"trusted_proxies_header" envconfig:"TRUSTED_PROXIES_HEADER"`
+	AccessControl        AccessControl `yaml:"access_control"`
+	ProxyProtocol        ProxyProtocol `yaml:"proxy_protocol"`
+	ForwardAuth          ForwardAuth   `yaml:"forward_auth"`
+	WebSocket            WebSocket     `yaml:"websocket"`
+}
+
+// WebSocket - Defines the limits of the WebSocket connections, per domain.
+// The zero values mean no limit.
+type WebSocket struct {
+	// MaxConnections - Concurrent connections, the exceeding ones are
+	// rejected with 503.
+	MaxConnections int `yaml:"max_connections" envconfig:"WEBSOCKET_MAX_CONNECTIONS"`
+	// IdleTimeout - Closes the connection when no data is exchanged for this long.
+	IdleTimeout time.Duration `yaml:"idle_timeout" envconfig:"WEBSOCKET_IDLE_TIMEOUT"`
+	// MaxLifetime - Closes the connection after this long.
+	MaxLifetime time.Duration `yaml:"max_lifetime" envconfig:"WEBSOCKET_MAX_LIFETIME"`
+	// AllowedOrigins - Origins (wildcards allowed, e.g. https://*.example.com)
+	// allowed to connect, the others are rejected with 403. The requests
+	// without the Origin header (i.e. not from a browser) are allowed.
+	AllowedOrigins []string `yaml:"allowed_origins" envconfig:"WEBSOCKET_ALLOWED_ORIGINS" split_words:"true"`
+}
+
+// Headers carrying the client IP, written by the trusted proxies.
+const (
+	ClientIPHeaderXForwardedFor = "x-forwarded-for"
+	ClientIPHeaderForwarded     = "forwarded"
+)
+
+// DefaultForwardAuthTimeout - How long to wait for the auth endpoint.
+const DefaultForwardAuthTimeout = 5 * time.Second
+
+// DefaultForwardAuthRequestHeaders - Headers sent to the auth endpoint, by default.
+var DefaultForwardAuthRequestHeaders = []string{"Authorization", "Cookie"}
+
+// ForwardAuth - Delegates the authentication to an external endpoint: before
+// proxying, a subrequest (with the original method, URI and the selected
+// headers) is sent to it. A 2xx response lets the request through, any
+// other response is returned to the client.
+type ForwardAuth struct {
+	// Address - URL of the auth endpoint, when empty it's disabled.
+	Address string `yaml:"address" envconfig:"FORWARD_AUTH_ADDRESS"`
+	// RequestHeaders - Sent to the auth endpoint, defaults to
+	// DefaultForwardAuthRequestHeaders. They identify the credentials.
+	RequestHeaders []string `yaml:"request_headers" envconfig:"FORWARD_AUTH_REQUEST_HEADERS" split_words:"true"`
+	// ResponseHeaders - Copied from the auth response to the upstream request
+	// (the ones sent by the client are dropped).
+	ResponseHeaders []string      `yaml:"response_headers" envconfig:"FORWARD_AUTH_RESPONSE_HEADERS" split_words:"true"`
+	Timeout         time.Duration `yaml:"timeout" envconfig:"FORWARD_AUTH_TIMEOUT"`
+	// CacheTTL - Caches the results by credentials, disabled when zero.
+	CacheTTL time.Duration `yaml:"cache_ttl" envconfig:"FORWARD_AUTH_CACHE_TTL"`
+}
+
+// IsEnabled - Checks whether the auth endpoint is set.
+func (f ForwardAuth) IsEnabled() bool {
+	return f.Address != ""
+}
+
+// DefaultProxyProtocolReadHeaderTimeout - How long to wait for the PROXY protocol header.
+const DefaultProxyProtocolReadHeaderTimeout = 10 * time.Second
+
+// ProxyProtocol - Requires the PROXY protocol (v1 and v2) header on the
+// listening ports, so the connections carry the real client address.
+type ProxyProtocol struct {
+	HTTP  bool `yaml:"http" envconfig:"PROXY_PROTOCOL_HTTP"`
+	HTTPS bool `yaml:"https" envconfig:"PROXY_PROTOCOL_HTTPS"`
+	// TrustedSources - IPs (or CIDRs) required to send the header, the other
+	// sources connect directly (the ones sending it are rejected). When empty
+	// every source is trusted.
+	TrustedSources    []string      `yaml:"trusted_sources" envconfig:"PROXY_PROTOCOL_TRUSTED_SOURCES" split_words:"true"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" envconfig:"PROXY_PROTOCOL_READ_HEADER_TIMEOUT"`
+}
+
+// AccessControl - Allows or denies the clients by IP (or CIDR). The deny list
+// takes precedence, when the allow list is set only its clients are allowed.
+type AccessControl struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+	// Status - Sent to the denied clients: 403 (default) or 404.
+	Status int `yaml:"status"`
+}
+
+// IsEnabled - Checks whether there's any rule.
+func (a AccessControl) IsEnabled() bool {
+	return len(a.Allow) > 0 || len(a.Deny) > 0
+}
+
+// Rate limiting algorithms.
+const (
+	RateLimitTokenBucket   = "token-bucket"
+	RateLimitSlidingWindow = "sliding-window"
+)
+
+// Rate limiting keys, identifying the client.
+const (
+	RateLimitKeyIP         = "ip"
+	RateLimitKeyHeader     = "header"
+	RateLimitKeyJWTSubject = "jwt_sub"
+	RateLimitKeyAPIKey     = "api_key"
+)
+
+// DefaultRateLimitAPIKeyHeader - Default HTTP header carrying the API key.
+const DefaultRateLimitAPIKeyHeader = "X-API-Key"
+
+// RateLimit - Defines how many requests a client can send in a period.
+// The counters are shared across instances via Redis, a local (per instance)
+// limiter is used when Redis is unavailable.
+type RateLimit struct {
+	Enabled bool `yaml:"enabled" envconfig:"RATE_LIMIT_ENABLED"`
+	// Algorithm - One of: token-bucket (default), sliding-window.
+	Algorithm string        `yaml:"algorithm" envconfig:"RATE_LIMIT_ALGORITHM"`
+	Limit     int           `yaml:"limit" envconfig:"RATE_LIMIT_LIMIT"`
+	Period    time.Duration `yaml:"period" envconfig:"RATE_LIMIT_PERIOD"`
+	// Burst - Capacity of the token bucket, defaults to Limit.
+	Burst int `yaml:"burst" envconfig:"RATE_LIMIT_BURST"`
+	// Key - One of: ip (default), header, jwt_sub (verified tokens only),
+	// api_key. When the key is missing from the request the client IP is used.
+	Key string `yaml:"key" envconfig:"RATE_LIMIT_KEY"`
+	// Header - Used by the header key (required) and the api_key key
+	// (defaults to DefaultRateLimitAPIKeyHeader).
+	Header string `yaml:"header" envconfig:"RATE_LIMIT_HEADER"`
+}
+
+// Rewrites - Ordered list of rewrite rules, the first matching one applies.
+type Rewrites []RewriteRule
+
+// RewriteRule - Rewrites the path sent to the upstream, or redirects the
+// client, when the request path matches the regex (and the conditions).
+// The replacement supports the regex groups (e.g. $1). The original query
+// string is kept unless the replacement contains its own.
+type RewriteRule struct {
+	Match       string `yaml:"match"`
+	Replacement string `yaml:"replacement"`
+	// Redirect - Status code of the redirect (301, 302, 307, 308), when not
+	// set the path is rewritten internally.
+	Redirect   int              `yaml:"redirect"`
+	Conditions RewriteCondition `yaml:"conditions"`
+	match      *regexp.Regexp
+}
+
+// RewriteCondition - Extra regexes to be matched by the request, all of them
+// must match for the rule to apply.
+type RewriteCondition struct {
+	Host    string            `yaml:"host"`
+	Query   string            `yaml:"query"`
+	Headers map[string]string `yaml:"headers"`
+	host    *regexp.Regexp
+	query   *regexp.Regexp
+	headers map[string]*regexp.Regexp
+}
+
+// IsRedirect - Checks whether the rule redirects the client.
+func (r RewriteRule) IsRedirect() bool {
+	return r.Redirect != 0
+}
+
+// Apply - Returns the replacement when the rule matches.
+func (r RewriteRule) Apply(host string, path string, query string, headers http.Header) (string, bool) {
+	if r.match == nil || !r.Conditions.match(host, query, headers) {
+		return "", false
+	}
+
+	matches := r.match.FindStringSubmatchIndex(path)
+	if matches == nil {
+		return "", false
+	}
+
+	return string(r.match.ExpandString(nil, r.Replacement, path, matches)), true
+}
+
+func (c RewriteCondition) match(host string, query string, headers http.Header) bool {
+	if c.host != nil && !c.host.MatchString(host) {
+		return false
+	}
+
+	if c.query != nil && !c.query.MatchString(query) {
+		return false
+	}
+
+	for k, v := range c.headers {
+		if !v.MatchString(headers.Get(k)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Header rules actions.
+const (
+	HeaderActionAdd     = "add"
+	HeaderActionSet     = "set"
+	HeaderActionRemove  = "remove"
+	HeaderActionReplace = "replace"
+)
+
+// Headers - Defines the rules applied to the request headers (before
+// proxying) and to the response headers (before serving, cached or not).
+type Headers struct {
+	Request  []HeaderRule `yaml:"request"`
+	Response []HeaderRule `yaml:"response"`
+}
+
+// HeaderRule - Defines a single add/set/remove/replace operation on a header.
+// The value supports variables (e.g. $client_ip, $request_id, $cache_status),
+// and for the replace action the regex groups too (e.g. $1).
+type HeaderRule struct {
+	Action string `yaml:"action"`
+	Name   string `yaml:"name"`
+	Value  string `yaml:"value"`
+	// Pattern - Regex matched against the header value (replace action only).
+	Pattern string `yaml:"pattern"`
+	pattern *regexp.Regexp
+}
+
+// GetPattern - Returns the compiled pattern, nil when not compiled.
+func (r HeaderRule) GetPattern() *regexp.Regexp {
+	return r.pattern
+}
+
+// Locations - Ordered list of locations, the first matching one wins.
+type Locations []Location
+
+// Location - Routes the matching paths to a dedicated upstream pool.
+// Unset upstream and cache settings are inherited from the domain, the host
+// and scheme are always the domain's ones (as well as the Redis connection).
+type Location struct {
+	// Name - Identifies the location, defaults to the prefix (or the regex).
+	Name string `yaml:"name"`
+	// Prefix - Matches the paths starting with it, on a segment boundary
+	// (e.g. "/api" matches "/api/users" but not "/apis").
+	Prefix string `yaml:"prefix"`
+	// Regex - Matches the paths against it, used when no prefix is set.
+	Regex string `yaml:"regex"`
+	// StripPrefix - Removes the prefix from the path sent to the upstream.
+	StripPrefix bool     `yaml:"strip_prefix"`
+	Upstream    Upstream `yaml:"upstream"`
+	Cache       Cache    `yaml:"cache"`
+	// Headers - Applied after the domain's ones.
+	Headers Headers `yaml:"headers"`
+	// RateLimit - When enabled it replaces the domain's one, with its own counters.
+	RateLimit RateLimit `yaml:"rate_limit"`
+	// AccessControl - When set it replaces the domain's one.
+	AccessControl AccessControl `yaml:"access_control"`
+	// ForwardAuth - When set it replaces the domain's one.
+	ForwardAuth ForwardAuth `yaml:"forward_auth"`
+	regex       *regexp.Regexp
+}
+
+// Match - Checks whether the path belongs to the location.
+func (l Location) Match(path string) bool {
+	if l.Prefix != "" {
+		return utils.HasPathPrefix(path, l.Prefix)
+	}
+
+	return l.regex != nil && l.regex.MatchString(path)
+}
+
+// GetBalancerID - Returns the unique ID of the location's load balancer.
+func (l Location) GetBalancerID() string {
+	return l.Upstream.GetDomainID() + utils.StringSeparatorOne + l.Name
+}
+
+// Find - Returns the first location matching the path.
+func (l Locations) Find(path string) (Location, bool) {
+	for _, v := range l {
+		if v.Match(path) {
+			return v, true
+		}
+	}
+
+	return Location{}, false
 }
 
 // Purge - Defines access control for PURGE requests.
@@ -86,8 +381,7 @@ type Server struct {
 // check to be authorized.
 type Purge struct {
 	// AllowedIPs - Allowlist of client IPs/CIDRs permitted to issue PURGE. The
-	// direct connection IP (RemoteAddr) is checked, not the spoofable
-	// X-Forwarded-For header.
+	// forwarding headers are trusted only when set by the TrustedProxies.
 	AllowedIPs []string `yaml:"allowed_ips" envconfig:"PURGE_ALLOWED_IPS" split_words:"true"`
 	// Secret - Shared secret that must be presented in SecretHeader.
 	Secret string `yaml:"secret" envconfig:"PURGE_SECRET"`
@@ -113,19 +407,154 @@ type TLS struct {
 	// cached. Must be persistent: an ephemeral directory forces re-issuance on
 	// every restart, burning through the CA's rate limits.
 	CertCacheDir string `yaml:"cert_cache_dir" envconfig:"TLS_CERT_CACHE_DIR"`
+	// ACME - Settings of the automatic certificates.
+	ACME ACME `yaml:"acme"`
+	// Certificates - Additional pairs (e.g. both RSA and ECDSA), the first one
+	// supported by the client is served.
+	Certificates []CertificatePair `yaml:"certificates"`
+	// DefaultCertFile - Served when no certificate matches the SNI (or the
+	// client doesn't send it). Only in the global configuration.
+	DefaultCertFile string `yaml:"default_cert_file" envconfig:"TLS_DEFAULT_CERT_FILE"`
+	DefaultKeyFile  string `yaml:"default_key_file" envconfig:"TLS_DEFAULT_KEY_FILE"`
+	// OCSP - Staples the OCSP responses to the certificates (not the automatic ones).
+	OCSP OCSP `yaml:"ocsp"`
+	// ClientAuth - Verifies the client certificates (mutual TLS).
+	ClientAuth ClientAuth `yaml:"client_auth"`
+	// HTTP3 - Serves HTTP/3 (QUIC) on the HTTPS port too (over UDP).
+	HTTP3 HTTP3 `yaml:"http3"`
+}
+
+// HTTP3 - Defines the HTTP/3 listener, sharing the TLS settings (and the
+// certificates) of the HTTPS one.
+type HTTP3 struct {
+	Enabled bool `yaml:"enabled" envconfig:"TLS_HTTP3_ENABLED"`
+	// AltSvcMaxAge - How long the clients remember that HTTP/3 is available
+	// (announced with the Alt-Svc header on the HTTPS responses).
+	AltSvcMaxAge time.Duration `yaml:"alt_svc_max_age" envconfig:"TLS_HTTP3_ALT_SVC_MAX_AGE"`
+}
+
+// OCSP - Defines the OCSP stapling, the responses are fetched in background
+// and refreshed before their expiry.
+type OCSP struct {
+	Enabled bool `yaml:"enabled" envconfig:"TLS_OCSP_ENABLED"`
+	// Responder - Overrides the responder's URL in the certificates.
+	Responder string `yaml:"responder" envconfig:"TLS_OCSP_RESPONDER"`
+	// CacheDir - Persists the responses, so they're stapled right after a
+	// restart. Not persisted when empty.
+	CacheDir string `yaml:"cache_dir" envconfig:"TLS_OCSP_CACHE_DIR"`
+}
+
+// ACME key types.
+const (
+	ACMEKeyTypeECDSA = "ecdsa"
+	ACMEKeyTypeRSA   = "rsa"
+)
+
+// ACME storages of the automatic certificates.
+const (
+	// ACMEStorageDir - In CertCacheDir, per instance.
+	ACMEStorageDir = "dir"
+	// ACMEStorageRedis - In the domain's Redis, shared by the instances.
+	ACMEStorageRedis = "redis"
+)
+
+// ACME - Defines the CA issuing the automatic certificates and where they're
+// stored.
+type ACME struct {
+	// DirectoryURL - Defaults to Let's Encrypt (production).
+	DirectoryURL string `yaml:"directory_url" envconfig:"TLS_ACME_DIRECTORY_URL"`
+	// CAFile - PEM bundle of the CAs trusted for the directory's connections
+	// (e.g. an internal CA), instead of the system ones.
+	CAFile string `yaml:"ca_file" envconfig:"TLS_ACME_CA_FILE"`
+	// EABKeyID - External Account Binding, required by some CAs.
+	EABKeyID string `yaml:"eab_key_id" envconfig:"TLS_ACME_EAB_KEY_ID"`
+	// EABHMACKey - Base64url encoded, as provided by the CA.
+	EABHMACKey string `yaml:"eab_hmac_key" envconfig:"TLS_ACME_EAB_HMAC_KEY"`
+	// KeyType - One of ecdsa (default) or rsa.
+	KeyType string `yaml:"key_type" envconfig:"TLS_ACME_KEY_TYPE"`
+	// Storage - One of dir (default) or redis.
+	Storage string `yaml:"storage" envconfig:"TLS_ACME_STORAGE"`
+}
+
+// CertificatePair - Defines a certificate (with its chain) and its key.
+type CertificatePair struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// GetCertificatePairs - Returns all the certificates, the main one first.
+func (t TLS) GetCertificatePairs() []CertificatePair {
+	pairs := []CertificatePair{}
+	if t.CertFile != "" || t.KeyFile != "" {
+		pairs = append(pairs, CertificatePair{CertFile: t.CertFile, KeyFile: t.KeyFile})
+	}
+
+	return append(pairs, t.Certificates...)
+}
+
+// Client certificate verification modes.
+const (
+	// ClientAuthRequire - The handshake fails without a valid certificate.
+	ClientAuthRequire = "require"
+	// ClientAuthVerifyIfGiven - The certificate is optional, but when sent
+	// it must be valid.
+	ClientAuthVerifyIfGiven = "verify_if_given"
+	// ClientAuthOptional - The certificate is requested but never enforced,
+	// the verification result is forwarded to the upstream.
+	ClientAuthOptional = "optional"
+)
+
+// ClientAuth - Defines the client certificates verification, the verified
+// certificate's details are sent to the upstream as headers.
+type ClientAuth struct {
+	// Mode - One of require, verify_if_given or optional, when empty it's disabled.
+	Mode string `yaml:"mode" envconfig:"TLS_CLIENT_AUTH_MODE"`
+	// CAFile - PEM bundle of the CAs issuing the client certificates.
+	CAFile string `yaml:"ca_file" envconfig:"TLS_CLIENT_AUTH_CA_FILE"`
+	// CRLFile - Revocation list (PEM or DER) signed by one of the CAs.
+	CRLFile string `yaml:"crl_file" envconfig:"TLS_CLIENT_AUTH_CRL_FILE"`
+}
+
+// IsEnabled - Checks whether the client certificates are requested.
+func (c ClientAuth) IsEnabled() bool {
+	return c.Mode != ""
 }
 
 // Upstream - Defines the upstream settings.
 type Upstream struct {
-	Host               string      `yaml:"host" envconfig:"FORWARD_HOST"`
-	Port               string      `yaml:"port" envconfig:"FORWARD_PORT"`
-	Scheme             string      `yaml:"scheme" envconfig:"FORWARD_SCHEME"`
-	BalancingAlgorithm string      `yaml:"balancing_algorithm" envconfig:"BALANCING_ALGORITHM" default:"round-robin"`
-	Endpoints          []string    `yaml:"endpoints" envconfig:"LB_ENDPOINT_LIST" split_words:"true"`
-	InsecureBridge     bool        `yaml:"insecure_bridge"`
-	HTTP2HTTPS         bool        `yaml:"http_to_https" envconfig:"HTTP2HTTPS"`
-	RedirectStatusCode int         `yaml:"redirect_status_code" envconfig:"REDIRECT_STATUS_CODE" default:"301"`
-	HealthCheck        HealthCheck `yaml:"health_check"`
+	Host               string        `yaml:"host" envconfig:"FORWARD_HOST"`
+	Port               string        `yaml:"port" envconfig:"FORWARD_PORT"`
+	Scheme             string        `yaml:"scheme" envconfig:"FORWARD_SCHEME"`
+	BalancingAlgorithm string        `yaml:"balancing_algorithm" envconfig:"BALANCING_ALGORITHM" default:"round-robin"`
+	Endpoints          []string      `yaml:"endpoints" envconfig:"LB_ENDPOINT_LIST" split_words:"true"`
+	InsecureBridge     bool          `yaml:"insecure_bridge"`
+	TLS                UpstreamTLS   `yaml:"tls"`
+	HTTP2HTTPS         bool          `yaml:"http_to_https" envconfig:"HTTP2HTTPS"`
+	RedirectStatusCode int           `yaml:"redirect_status_code" envconfig:"REDIRECT_STATUS_CODE" default:"301"`
+	HealthCheck        HealthCheck   `yaml:"health_check"`
+	StickySession      StickySession `yaml:"sticky_session"`
+	SlowStart          SlowStart     `yaml:"slow_start"`
+	Concurrency        Concurrency   `yaml:"concurrency"`
+	// Protocol - One of http1, h2 (negotiated over TLS) or h2c (cleartext,
+	// with prior knowledge), defaults to http1.
+	Protocol string `yaml:"protocol" envconfig:"FORWARD_PROTOCOL"`
+	// Stream - Streamed responses (e.g. Server-Sent Events or long polling).
+	Stream Stream `yaml:"stream"`
+}
+
+// Stream - Defines the streamed responses: they're sent right away (never
+// buffered nor cached) and they have their own timeouts instead of the
+// handler's one.
+type Stream struct {
+	// Enabled - Streams every response (e.g. long polling), only these
+	// requests bypass the handler's timeout.
+	Enabled bool `yaml:"enabled" envconfig:"STREAM_ENABLED"`
+	// ContentTypes - Streamed responses, by the upstream's content type.
+	ContentTypes []string `yaml:"content_types" envconfig:"STREAM_CONTENT_TYPES" split_words:"true"`
+	// IdleTimeout - Closes the stream when nothing is received for this long.
+	IdleTimeout time.Duration `yaml:"idle_timeout" envconfig:"STREAM_IDLE_TIMEOUT"`
+	// MaxDuration - Closes the stream after this long.
+	MaxDuration time.Duration `yaml:"max_duration" envconfig:"STREAM_MAX_DURATION"`
 }
 
 // GetDomainID - Returns the unique ID for the upstream.
@@ -133,6 +562,35 @@ func (u Upstream) GetDomainID() string {
 	return utils.IfEmpty(u.Host, "*") + utils.StringSeparatorOne + u.Scheme
 }
 
+// Protocols to the upstream.
+const (
+	UpstreamProtocolHTTP1 = "http1"
+	UpstreamProtocolH2    = "h2"
+	UpstreamProtocolH2C   = "h2c"
+)
+
+// UpstreamTLSVersions - Allowed values of the upstream minimum TLS version.
+var UpstreamTLSVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// UpstreamTLS - Defines the TLS connections to the upstream (and its health
+// checks).
+type UpstreamTLS struct {
+	// CAFile - PEM bundle of the CAs trusted (instead of the system ones).
+	CAFile string `yaml:"ca_file" envconfig:"UPSTREAM_TLS_CA_FILE"`
+	// CertFile - Client certificate (with KeyFile) for mutual TLS.
+	CertFile string `yaml:"cert_file" envconfig:"UPSTREAM_TLS_CERT_FILE"`
+	KeyFile  string `yaml:"key_file" envconfig:"UPSTREAM_TLS_KEY_FILE"`
+	// ServerName - Overrides the SNI (and the name verified in the certificate).
+	ServerName string `yaml:"server_name" envconfig:"UPSTREAM_TLS_SERVER_NAME"`
+	// MinVersion - One of 1.0, 1.1, 1.2 or 1.3, defaults to 1.2.
+	MinVersion string `yaml:"min_version" envconfig:"UPSTREAM_TLS_MIN_VERSION"`
+}
+
 // HealthCheck - Defines the health check settings.
 type HealthCheck struct {
 	StatusCodes   []string      `yaml:"status_codes" envconfig:"HEALTHCHECK_STATUS_CODES" split_words:"true"`
@@ -143,6 +601,57 @@ type HealthCheck struct {
 	AllowInsecure bool          `yaml:"allow_insecure" envconfig:"HEALTHCHECK_ALLOW_INSECURE"`
 }
 
+// DefaultSlowStartMinWeight - Initial weight (in percent) of a node in slow start.
+const DefaultSlowStartMinWeight = 10
+
+// SlowStart - Defines how a recovered (or newly added) node ramps up its
+// share of traffic, it works with any balancing algorithm.
+type SlowStart struct {
+	Duration  time.Duration `yaml:"duration" envconfig:"SLOW_START_DURATION"`
+	MinWeight int           `yaml:"min_weight" envconfig:"SLOW_START_MIN_WEIGHT"`
+}
+
+// DefaultConcurrencyQueueTimeout - How long a request waits in the queue for a free slot.
+const DefaultConcurrencyQueueTimeout = 1 * time.Second
+
+// Concurrency - Caps the in-flight requests sent to the upstream, the excess
+// waits in a bounded queue and it's shed when the queue is full or the wait
+// times out. Zero means unlimited.
+type Concurrency struct {
+	// MaxConnsPerHost - Connections to each node (http.Transport.MaxConnsPerHost).
+	MaxConnsPerHost    int           `yaml:"max_conns_per_host" envconfig:"CONCURRENCY_MAX_CONNS_PER_HOST"`
+	MaxRequests        int           `yaml:"max_requests" envconfig:"CONCURRENCY_MAX_REQUESTS"`
+	MaxRequestsPerNode int           `yaml:"max_requests_per_node" envconfig:"CONCURRENCY_MAX_REQUESTS_PER_NODE"`
+	QueueSize          int           `yaml:"queue_size" envconfig:"CONCURRENCY_QUEUE_SIZE"`
+	QueueTimeout       time.Duration `yaml:"queue_timeout" envconfig:"CONCURRENCY_QUEUE_TIMEOUT"`
+}
+
+// DefaultStickySessionCookieName - Default cookie carrying the sticky session node.
+const DefaultStickySessionCookieName = "GPC_STICKY"
+
+// StickySession - Defines the cookie-based session affinity, it works with
+// every balancing algorithm.
+// The cookie references one of the upstream endpoints and is signed, so it
+// cannot be forged to target an arbitrary node. When the referenced node is
+// unhealthy a new one is picked and the cookie is re-issued.
+type StickySession struct {
+	Enabled bool `yaml:"enabled" envconfig:"STICKY_SESSION_ENABLED"`
+	// CookieName - Defaults to DefaultStickySessionCookieName.
+	CookieName string `yaml:"cookie_name" envconfig:"STICKY_SESSION_COOKIE_NAME"`
+	// TTL - Cookie lifetime. When zero a session cookie is issued.
+	TTL time.Duration `yaml:"ttl" envconfig:"STICKY_SESSION_TTL"`
+	// Secret - Key used to sign the cookie. When empty a random key is
+	// generated at startup (cookies won't survive restarts nor be shared
+	// across multiple instances).
+	Secret   string `yaml:"secret" envconfig:"STICKY_SESSION_SECRET"`
+	Path     string `yaml:"path"`
+	Domain   string `yaml:"domain"`
+	Secure   bool   `yaml:"secure"`
+	HTTPOnly bool   `yaml:"http_only"`
+	// SameSite - One of: lax, strict, none. Default: browser's default.
+	SameSite string `yaml:"same_site"`
+}
+
 // Timeout - Defines the server timeouts.
 type Timeout struct {
 	Read       time.Duration `yaml:"read" envconfig:"TIMEOUT_READ"`
@@ -192,13 +701,109 @@ type DomainSet struct {
 
 // Jwt - Defines the config for the jwt validation.
 type Jwt struct {
-	ExcludedPaths       []string   `yaml:"excluded_paths" envconfig:"JWT_EXCLUDED_PATHS" split_words:"true"`
-	AllowedScopes       []string   `yaml:"allowed_scopes" envconfig:"JWT_ALLOWED_SCOPES" split_words:"true"`
-	JwksUrl             string     `yaml:"jwks_url" envconfig:"JWT_JWKS_URL"`
-	JwksRefreshInterval int        `yaml:"jwks_refresh_interval" envconfig:"JWT_REFRESH_INTERVAL" default:"15"`
-	JwkCache            *jwk.Cache
-	Context             context.Context
-	Logger              *logrus.Logger
+	ExcludedPaths       []string `yaml:"excluded_paths" envconfig:"JWT_EXCLUDED_PATHS" split_words:"true"`
+	AllowedScopes       []string `yaml:"allowed_scopes" envconfig:"JWT_ALLOWED_SCOPES" split_words:"true"`
+	JwksUrl             string   `yaml:"jwks_url" envconfig:"JWT_JWKS_URL"`
+	JwksRefreshInterval int      `yaml:"jwks_refresh_interval" envconfig:"JWT_REFRESH_INTERVAL" default:"15"`
+	// Issuer - Required value of the iss claim (when set).
+	Issuer string `yaml:"issuer" envconfig:"JWT_ISSUER"`
+	// Audiences - The aud claim must contain at least one of them (when set).
+	Audiences []string `yaml:"audiences" envconfig:"JWT_AUDIENCES" split_words:"true"`
+	// RequiredClaims - Claims the token must carry with the given value (an
+	// array claim must contain it), an empty value requires only the claim.
+	RequiredClaims map[string]string `yaml:"required_claims" envconfig:"JWT_REQUIRED_CLAIMS"`
+	// ClaimsHeaders - Claims forwarded to the upstream as request headers
+	// (e.g. sub: X-User-Id), the copies sent by the client are dropped.
+	ClaimsHeaders map[string]string `yaml:"claims_headers" envconfig:"JWT_CLAIMS_HEADERS"`
+	// Providers - Trusted issuers, each one with its own keys (in addition to
+	// the JWKS URL).
+	Providers []JwtProvider `yaml:"providers"`
+	// Rules - Per path and method requirements, the first matching one applies.
+	Rules    []JwtRule `yaml:"rules"`
+	JwkCache *jwk.Cache
+	Context  context.Context
+	Logger   *logrus.Logger
+}
+
+// IsEnabled - Checks whether there's any key to validate the tokens.
+func (j Jwt) IsEnabled() bool {
+	return j.JwksUrl != "" || len(j.Providers) > 0
+}
+
+// GetProviders - Returns the trusted issuers, the JWKS URL is an issuer-less one.
+func (j Jwt) GetProviders() []JwtProvider {
+	providers := []JwtProvider{}
+	if j.JwksUrl != "" {
+		providers = append(providers, JwtProvider{JwksUrl: j.JwksUrl})
+	}
+
+	return append(providers, j.Providers...)
+}
+
+// JwtRule - Requirements of the requests matching the path prefix (and
+// method). The authenticated responses are cached per subject, unless public.
+type JwtRule struct {
+	// Prefix - Matches the paths starting with it on a path segment boundary
+	// (a trailing * or / is ignored, so /admin/* covers /admin too).
+	Prefix string `yaml:"prefix"`
+	// Methods - Matches any method when empty.
+	Methods []string `yaml:"methods"`
+	// Scopes - At least one of them is required, replacing the allowed scopes.
+	Scopes []string `yaml:"scopes"`
+	// Claims - Required in addition to (or replacing) the required claims.
+	Claims map[string]string `yaml:"claims"`
+	// Public - The responses are cached and shared across the users.
+	Public bool `yaml:"public"`
+}
+
+// Match - Checks whether the request belongs to the rule.
+func (r JwtRule) Match(method string, path string) bool {
+	prefix := strings.TrimSuffix(strings.TrimSuffix(r.Prefix, "*"), "/")
+	if !utils.HasPathPrefix(path, prefix) {
+		return false
+	}
+
+	if len(r.Methods) == 0 {
+		return true
+	}
+
+	for _, v := range r.Methods {
+		if strings.EqualFold(v, method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetRule - Returns the first rule matching the request.
+func (j Jwt) GetRule(method string, path string) (JwtRule, bool) {
+	for _, v := range j.Rules {
+		if v.Match(method, path) {
+			return v, true
+		}
+	}
+
+	return JwtRule{}, false
+}
+
+// JwtProvider - A trusted issuer, its keys are fetched from the JWKS URL or
+// statically set (public keys and HMAC secret), so no endpoint is needed.
+type JwtProvider struct {
+	// Issuer - Selects the provider by the iss claim. The issuer-less
+	// providers validate the tokens not matching any issuer.
+	Issuer  string `yaml:"issuer"`
+	JwksUrl string `yaml:"jwks_url"`
+	// PublicKeys - PEM or JWK (JWKS) public keys, inline or as file paths.
+	PublicKeys []string `yaml:"public_keys"`
+	// Secret - HMAC shared secret (HS256, HS384, HS512).
+	Secret string `yaml:"secret"`
+	keySet jwk.Set
+}
+
+// GetKeySet - Returns the static keys (public keys and secret), loaded by InitJWT.
+func (p JwtProvider) GetKeySet() jwk.Set {
+	return p.keySet
 }
 
 // Jwt - Defines the jwt validation error.
@@ -242,6 +847,10 @@ var Config Configuration = Configuration{
 					tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
 				},
 			},
+			HTTP3: HTTP3{
+				Enabled:      false,
+				AltSvcMaxAge: DefaultHTTP3AltSvcMaxAge,
+			},
 		},
 		Timeout: Timeout{
 			Read:       DefaultTimeoutRead,
@@ -259,6 +868,11 @@ var Config Configuration = Configuration{
 				StatusCodes: []string{"200"},
 				Scheme:      "https",
 			},
+			Stream: Stream{
+				ContentTypes: []string{DefaultStreamContentType},
+				IdleTimeout:  DefaultStreamIdleTimeout,
+				MaxDuration:  DefaultStreamMaxDuration,
+			},
 		},
 		GZip: false,
 	},
@@ -10,6 +10,7 @@ package logger
 // Repo: https://github.com/fabiocicerchia/go-proxy-cache
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log/syslog"
@@ -83,6 +84,24 @@ func escapeLogValue(value string) string {
 	return value
 }
 
+type contextKey string
+
+const clientIPContextKey contextKey = "client_ip"
+
+// WithClientIP - Returns a copy of the request carrying the client IP resolved
+// through the trusted proxies, logged as $remote_addr.
+func WithClientIP(req *http.Request, clientIP string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), clientIPContextKey, clientIP))
+}
+
+func getRemoteAddr(req http.Request) string {
+	if clientIP, ok := req.Context().Value(clientIPContextKey).(string); ok && clientIP != "" {
+		return clientIP
+	}
+
+	return req.RemoteAddr
+}
+
 // Log - Logs against a requested URL.
 func Log(req http.Request, reqID string, message string) {
 	escapedMessage := escapeLogValue(message)
@@ -115,7 +134,7 @@ func LogRequest(req http.Request, statusCode int, lenContent int, reqID string,
 	// log lines (log injection, CWE-117).
 	r := strings.NewReplacer(
 		`$host`, escapeLogValue(req.Host),
-		`$remote_addr`, escapeLogValue(req.RemoteAddr),
+		`$remote_addr`, escapeLogValue(getRemoteAddr(req)),
 		`$remote_user`, "-",
 		`$time_local`, time.Now().Local().Format(config.Config.Log.TimeFormat),
 		`$protocol`, escapeLogValue(protocol),
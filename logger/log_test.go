@@ -98,6 +98,39 @@ func TestLogRequest(t *testing.T) {
 	tearDownLog()
 }
 
+func TestLogRequestWithClientIP(t *testing.T) {
+	setUpLog()
+
+	reqMock := &http.Request{
+		RemoteAddr: "10.0.0.1:1234",
+		Host:       "example.org",
+		URL:        &url.URL{Path: "/path/to/file"},
+		Header:     make(http.Header),
+	}
+	reqMock = logger.WithClientIP(reqMock, "5.6.7.8")
+
+	var buf bytes.Buffer
+	logger.Logger.SetOutput(&buf)
+	defer func() {
+		logger.Logger.SetOutput(os.Stderr)
+	}()
+
+	config.Config = config.Configuration{
+		Log: config.Log{
+			TimeFormat: "2006/01/02 15:04:05",
+			Format:     `$host - $remote_addr - $status`,
+		},
+	}
+
+	logger.LogRequest(*reqMock, 200, 0, "TestLogRequestWithClientIP", 0)
+
+	expectedOut := `time=" " level=info msg="example.org - 5.6.7.8 - 200" ReqID=TestLogRequestWithClientIP` + "\n"
+
+	assert.Equal(t, expectedOut, buf.String())
+
+	tearDownLog()
+}
+
 func TestLogSetup(t *testing.T) {
 	setUpLog()
 
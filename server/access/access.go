@@ -0,0 +1,239 @@
+package access
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/utils"
+)
+
+// List - IPs and CIDRs.
+type List []*net.IPNet
+
+// NewList - Parses the entries (single IPs or CIDRs), the invalid ones are skipped.
+func NewList(entries []string) List {
+	list := List{}
+
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			list = append(list, cidr)
+			continue
+		}
+
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			continue
+		}
+
+		bits := net.IPv6len * 8
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = net.IPv4len * 8
+		}
+
+		list = append(list, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+	}
+
+	return list
+}
+
+// Contains - Checks whether the IP matches any entry.
+func (l List) Contains(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+
+	for _, v := range l {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Rules - Access rules of a domain (or location).
+type Rules struct {
+	Allow  List
+	Deny   List
+	Status int
+}
+
+// NewRules - Returns the compiled rules, nil when there's none.
+func NewRules(conf config.AccessControl) *Rules {
+	if !conf.IsEnabled() {
+		return nil
+	}
+
+	return &Rules{
+		Allow:  NewList(conf.Allow),
+		Deny:   NewList(conf.Deny),
+		Status: utils.Coalesce(conf.Status, http.StatusForbidden).(int),
+	}
+}
+
+// IsAllowed - The deny list takes precedence, when the allow list is set
+// only its IPs are allowed. An unknown IP is never allowed.
+func (r *Rules) IsAllowed(ip net.IP) bool {
+	if r == nil {
+		return true
+	}
+
+	if ip == nil || r.Deny.Contains(ip) {
+		return false
+	}
+
+	return len(r.Allow) == 0 || r.Allow.Contains(ip)
+}
+
+// Snapshot - Access rules and trusted proxies in use, replaced as a whole
+// when reloaded.
+type Snapshot struct {
+	// Rules - By domain ID and location balancer ID.
+	Rules map[string]*Rules
+	// TrustedProxies - By domain ID.
+	TrustedProxies map[string]List
+}
+
+var current atomic.Value
+
+// NewSnapshot - Builds the snapshot for the global configuration and its domains.
+func NewSnapshot(conf config.Configuration) *Snapshot {
+	s := &Snapshot{
+		Rules:          make(map[string]*Rules),
+		TrustedProxies: make(map[string]List),
+	}
+
+	s.add(conf)
+	for _, domain := range conf.Domains {
+		s.add(domain)
+	}
+
+	return s
+}
+
+func (s *Snapshot) add(conf config.Configuration) {
+	domainID := conf.Server.Upstream.GetDomainID()
+
+	s.Rules[domainID] = NewRules(conf.Server.AccessControl)
+	s.TrustedProxies[domainID] = NewList(conf.Server.TrustedProxies)
+
+	for _, location := range conf.Server.Locations {
+		s.Rules[location.GetBalancerID()] = NewRules(location.AccessControl)
+	}
+}
+
+// GetRules - Returns the rules of the location, or of the domain when the
+// location has none.
+func (s *Snapshot) GetRules(domainID string, locationID string) *Rules {
+	if rules := s.Rules[locationID]; locationID != "" && rules != nil {
+		return rules
+	}
+
+	return s.Rules[domainID]
+}
+
+// GetTrustedProxies - Returns the trusted proxies of the domain.
+func (s *Snapshot) GetTrustedProxies(domainID string) List {
+	return s.TrustedProxies[domainID]
+}
+
+// Store - Replaces the snapshot in use.
+func Store(s *Snapshot) {
+	current.Store(s)
+}
+
+// Load - Returns the snapshot in use (an empty one when none has been stored).
+func Load() *Snapshot {
+	if s, ok := current.Load().(*Snapshot); ok {
+		return s
+	}
+
+	return &Snapshot{}
+}
+
+// ResolveClientIP - Returns the client IP when the peer is a trusted proxy,
+// walking the hops from the closest one as long as they are trusted proxies.
+// The hops are taken only from the header written by the trusted proxies:
+// the Forwarded one (RFC 7239) or X-Forwarded-For (default), as the other
+// one would be passed through as sent by the client.
+func ResolveClientIP(remoteIP string, header http.Header, trustedProxies List, clientIPHeader string) string {
+	if len(trustedProxies) == 0 || !trustedProxies.Contains(net.ParseIP(remoteIP)) {
+		return remoteIP
+	}
+
+	var hops []string
+	if strings.EqualFold(clientIPHeader, config.ClientIPHeaderForwarded) {
+		hops = getForwardedHops(header.Values("Forwarded"))
+	} else {
+		hops = getForwardedForHops(header.Values("X-Forwarded-For"))
+	}
+
+	clientIP := remoteIP
+	for k := len(hops) - 1; k >= 0; k-- {
+		// Obfuscated identifiers (e.g. "unknown", "_hidden") stop the walk.
+		ip := net.ParseIP(utils.StripPort(hops[k]))
+		if ip == nil {
+			break
+		}
+
+		clientIP = ip.String()
+		if !trustedProxies.Contains(ip) {
+			break
+		}
+	}
+
+	return clientIP
+}
+
+func getForwardedForHops(values []string) []string {
+	hops := []string{}
+
+	for _, v := range values {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+
+	return hops
+}
+
+// getForwardedHops - Returns the "for" parameter of every element of the
+// Forwarded header (e.g. for=192.0.2.60;proto=http, for="[2001:db8::17]:4711").
+func getForwardedHops(values []string) []string {
+	hops := []string{}
+
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			hop := ""
+
+			for _, pair := range strings.Split(element, ";") {
+				name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if found && strings.EqualFold(name, "for") {
+					hop = strings.Trim(value, `"`)
+				}
+			}
+
+			hops = append(hops, hop)
+		}
+	}
+
+	return hops
+}
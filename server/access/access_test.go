@@ -0,0 +1,172 @@
+//go:build all || unit
+// +build all unit
+
+package access_test
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/access"
+)
+
+func TestList(t *testing.T) {
+	list := access.NewList([]string{"10.0.0.0/24", " 192.168.1.1 ", "::1", "not-an-ip", ""})
+
+	assert.Len(t, list, 3)
+	assert.True(t, list.Contains(net.ParseIP("10.0.0.5")))
+	assert.False(t, list.Contains(net.ParseIP("10.0.1.5")))
+	assert.True(t, list.Contains(net.ParseIP("192.168.1.1")))
+	assert.False(t, list.Contains(net.ParseIP("192.168.1.2")))
+	assert.True(t, list.Contains(net.ParseIP("::1")))
+	assert.False(t, list.Contains(nil))
+}
+
+func TestRules(t *testing.T) {
+	assert.Nil(t, access.NewRules(config.AccessControl{Status: http.StatusNotFound}))
+
+	var none *access.Rules
+	assert.True(t, none.IsAllowed(net.ParseIP("10.0.0.1")))
+
+	rules := access.NewRules(config.AccessControl{
+		Allow: []string{"10.0.0.0/8"},
+		Deny:  []string{"10.0.0.1"},
+	})
+	assert.Equal(t, http.StatusForbidden, rules.Status)
+	assert.True(t, rules.IsAllowed(net.ParseIP("10.1.2.3")))
+	assert.False(t, rules.IsAllowed(net.ParseIP("10.0.0.1")))
+	assert.False(t, rules.IsAllowed(net.ParseIP("192.168.1.1")))
+	assert.False(t, rules.IsAllowed(nil))
+
+	rules = access.NewRules(config.AccessControl{
+		Deny:   []string{"192.168.0.0/16"},
+		Status: http.StatusNotFound,
+	})
+	assert.Equal(t, http.StatusNotFound, rules.Status)
+	assert.True(t, rules.IsAllowed(net.ParseIP("10.1.2.3")))
+	assert.False(t, rules.IsAllowed(net.ParseIP("192.168.1.1")))
+}
+
+func TestSnapshot(t *testing.T) {
+	conf := config.Configuration{
+		Server: config.Server{
+			Upstream:       config.Upstream{Host: "example.com", Scheme: "https"},
+			TrustedProxies: []string{"10.0.0.1"},
+			AccessControl:  config.AccessControl{Deny: []string{"192.168.0.0/16"}},
+			Locations: config.Locations{
+				{Name: "admin", Prefix: "/admin", Upstream: config.Upstream{Host: "example.com", Scheme: "https"}, AccessControl: config.AccessControl{Allow: []string{"10.0.0.0/8"}}},
+				{Name: "api", Prefix: "/api", Upstream: config.Upstream{Host: "example.com", Scheme: "https"}},
+			},
+		},
+		Domains: config.Domains{
+			"example_org": config.Configuration{
+				Server: config.Server{
+					Upstream: config.Upstream{Host: "example.org", Scheme: "https"},
+				},
+			},
+		},
+	}
+
+	s := access.NewSnapshot(conf)
+
+	domain := s.GetRules("example.com@@https", "")
+	assert.False(t, domain.IsAllowed(net.ParseIP("192.168.1.1")))
+	assert.True(t, domain.IsAllowed(net.ParseIP("172.16.0.1")))
+
+	admin := s.GetRules("example.com@@https", conf.Server.Locations[0].GetBalancerID())
+	assert.True(t, admin.IsAllowed(net.ParseIP("10.1.2.3")))
+	assert.False(t, admin.IsAllowed(net.ParseIP("172.16.0.1")))
+
+	// No rules for the location: the domain's ones apply.
+	assert.Same(t, domain, s.GetRules("example.com@@https", conf.Server.Locations[1].GetBalancerID()))
+
+	assert.Nil(t, s.GetRules("example.org@@https", ""))
+	assert.Len(t, s.GetTrustedProxies("example.com@@https"), 1)
+	assert.Len(t, s.GetTrustedProxies("example.org@@https"), 0)
+
+	access.Store(s)
+	assert.Same(t, s, access.Load())
+}
+
+func xff(values ...string) http.Header {
+	return http.Header{"X-Forwarded-For": values}
+}
+
+func TestResolveClientIP(t *testing.T) {
+	trusted := access.NewList([]string{"10.0.0.0/8"})
+
+	// Not from a trusted proxy: the header is ignored.
+	assert.Equal(t, "1.2.3.4", access.ResolveClientIP("1.2.3.4", xff("5.6.7.8"), trusted, ""))
+	assert.Equal(t, "1.2.3.4", access.ResolveClientIP("1.2.3.4", xff("5.6.7.8"), access.List{}, ""))
+
+	// The closest untrusted hop is the client.
+	assert.Equal(t, "5.6.7.8", access.ResolveClientIP("10.0.0.1", xff("9.9.9.9, 5.6.7.8"), trusted, ""))
+	assert.Equal(t, "5.6.7.8", access.ResolveClientIP("10.0.0.1", xff("9.9.9.9", "5.6.7.8, 10.0.0.2"), trusted, ""))
+
+	// Only trusted hops.
+	assert.Equal(t, "10.0.0.3", access.ResolveClientIP("10.0.0.1", xff("10.0.0.3, 10.0.0.2"), trusted, ""))
+
+	// Invalid hops stop the walk.
+	assert.Equal(t, "10.0.0.2", access.ResolveClientIP("10.0.0.1", xff("5.6.7.8, invalid, 10.0.0.2"), trusted, ""))
+
+	// No header.
+	assert.Equal(t, "10.0.0.1", access.ResolveClientIP("10.0.0.1", http.Header{}, trusted, ""))
+
+	// IPv6 and ports.
+	assert.Equal(t, "2001:db8::1", access.ResolveClientIP("10.0.0.1", xff("[2001:db8::1]:1234"), trusted, ""))
+	assert.Equal(t, "5.6.7.8", access.ResolveClientIP("10.0.0.1", xff("5.6.7.8:1234"), trusted, ""))
+}
+
+func TestResolveClientIPForwarded(t *testing.T) {
+	trusted := access.NewList([]string{"10.0.0.0/8"})
+	forwarded := config.ClientIPHeaderForwarded
+
+	header := http.Header{
+		"Forwarded":       []string{`for=5.6.7.8;proto=https, For="10.0.0.2:8080";by=10.0.0.1`},
+		"X-Forwarded-For": []string{"9.9.9.9"},
+	}
+	assert.Equal(t, "5.6.7.8", access.ResolveClientIP("10.0.0.1", header, trusted, forwarded))
+
+	header = http.Header{"Forwarded": []string{`for="[2001:db8:cafe::17]:4711"`}}
+	assert.Equal(t, "2001:db8:cafe::17", access.ResolveClientIP("10.0.0.1", header, trusted, "Forwarded"))
+
+	// Obfuscated identifiers.
+	header = http.Header{"Forwarded": []string{"for=5.6.7.8, for=_hidden, for=10.0.0.2"}}
+	assert.Equal(t, "10.0.0.2", access.ResolveClientIP("10.0.0.1", header, trusted, forwarded))
+
+	// Elements without "for".
+	header = http.Header{"Forwarded": []string{"for=5.6.7.8", "proto=https"}}
+	assert.Equal(t, "10.0.0.1", access.ResolveClientIP("10.0.0.1", header, trusted, forwarded))
+
+	// X-Forwarded-For is ignored.
+	assert.Equal(t, "10.0.0.1", access.ResolveClientIP("10.0.0.1", xff("5.6.7.8"), trusted, forwarded))
+}
+
+func TestResolveClientIPIgnoresTheOtherHeader(t *testing.T) {
+	trusted := access.NewList([]string{"10.0.0.0/8"})
+
+	// Behind a proxy appending to X-Forwarded-For, the Forwarded header is the
+	// client's one (i.e. spoofed).
+	header := http.Header{
+		"Forwarded":       []string{"for=1.2.3.4"},
+		"X-Forwarded-For": []string{"5.6.7.8"},
+	}
+	assert.Equal(t, "5.6.7.8", access.ResolveClientIP("10.0.0.1", header, trusted, ""))
+	assert.Equal(t, "5.6.7.8", access.ResolveClientIP("10.0.0.1", header, trusted, config.ClientIPHeaderXForwardedFor))
+
+	header = http.Header{"Forwarded": []string{"for=1.2.3.4"}}
+	assert.Equal(t, "10.0.0.1", access.ResolveClientIP("10.0.0.1", header, trusted, ""))
+}
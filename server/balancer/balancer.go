@@ -20,11 +20,13 @@ import (
 
 	"github.com/fabiocicerchia/go-proxy-cache/config"
 	"github.com/fabiocicerchia/go-proxy-cache/logger"
+	srvtls "github.com/fabiocicerchia/go-proxy-cache/server/tls"
 	"github.com/fabiocicerchia/go-proxy-cache/telemetry"
 	"github.com/fabiocicerchia/go-proxy-cache/telemetry/metrics"
 	"github.com/fabiocicerchia/go-proxy-cache/utils/slice"
 )
 
+const lBEWMA = "p2c-ewma"
 const lBIpHash = "ip-hash"
 const lBLeastConnections = "least-connections"
 const lBRandom = "random"
@@ -51,6 +53,8 @@ func convertEndpoints(endpoints []string) []Item {
 // Init - Initialise the LB algorithm.
 func Init(name string, config config.Upstream) {
 	switch config.BalancingAlgorithm {
+	case lBEWMA:
+		InitEWMA(name, config, enableHealthchecks)
 	case lBIpHash:
 		InitIpHash(name, config, enableHealthchecks)
 	case lBLeastConnections:
@@ -70,11 +74,16 @@ func initBalancer(name string, config config.Upstream, enableHealthchecks bool,
 	initLB()
 	items := convertEndpoints(config.Endpoints)
 
+	if previous, ok := lb[name]; ok {
+		inheritHealthySince(previous.GetNodeBalancer(), items, time.Now())
+	}
+
 	b := newBalancer(name, items)
+	b.GetNodeBalancer().SlowStart = config.SlowStart
 	lb[name] = b
 
 	if enableHealthchecks {
-		CheckHealth(b.GetNodeBalancer(), config.Host, config.HealthCheck)
+		CheckHealth(b.GetNodeBalancer(), config.Host, config.HealthCheck, config.TLS)
 	}
 }
 
@@ -98,14 +107,19 @@ func InitIpHash(name string, config config.Upstream, enableHealthchecks bool) {
 	initBalancer(name, config, enableHealthchecks, func(n string, items []Item) Balancer { return NewIpHashBalancer(n, items) })
 }
 
+// InitEWMA - Initialise the LB algorithm for latency-aware (power of two choices) selection.
+func InitEWMA(name string, config config.Upstream, enableHealthchecks bool) {
+	initBalancer(name, config, enableHealthchecks, func(n string, items []Item) Balancer { return NewEWMABalancer(n, items) })
+}
+
 // GetUpstreamNode - Returns backend server using current algorithm.
-func GetUpstreamNode(name string, requestURL url.URL, defaultHost string) string {
+func GetUpstreamNode(name string, clientIP string, defaultHost string) string {
 	var err error
 
 	endpoint := ""
 
 	if lbDomain, ok := lb[name]; ok {
-		endpoint, err = lbDomain.Pick(requestURL.String())
+		endpoint, err = lbDomain.Pick(clientIP)
 	}
 
 	if err != nil || endpoint == "" {
@@ -115,8 +129,22 @@ func GetUpstreamNode(name string, requestURL url.URL, defaultHost string) string
 	return endpoint
 }
 
+// RequestStarted - Notifies the balancer that a request has been sent to the endpoint.
+func RequestStarted(name string, endpoint string) {
+	if o, ok := lb[name].(Observer); ok {
+		o.Begin(endpoint)
+	}
+}
+
+// RequestDone - Notifies the balancer that the endpoint has responded.
+func RequestDone(name string, endpoint string, responseTime time.Duration) {
+	if o, ok := lb[name].(Observer); ok {
+		o.Done(endpoint, responseTime)
+	}
+}
+
 // CheckHealth - Periodic check on nodes status.
-func CheckHealth(b *NodeBalancer, host string, config config.HealthCheck) {
+func CheckHealth(b *NodeBalancer, host string, config config.HealthCheck, tlsConfig config.UpstreamTLS) {
 	period := config.Interval
 	if period == 0 {
 		period = HealthCheckInterval
@@ -138,8 +166,15 @@ func CheckHealth(b *NodeBalancer, host string, config config.HealthCheck) {
 			healthyCounter := 0
 			unhealthyCounter := 0
 
+			now := time.Now()
+
 			for k := range items {
-				DoHealthCheck(&items[k], host, config)
+				wasHealthy := items[k].Healthy
+				DoHealthCheck(&items[k], host, config, tlsConfig)
+
+				if !wasHealthy && items[k].Healthy {
+					items[k].HealthySince = now
+				}
 
 				if items[k].Healthy {
 					healthyCounter++
@@ -161,7 +196,7 @@ func CheckHealth(b *NodeBalancer, host string, config config.HealthCheck) {
 	}()
 }
 
-func getClient(timeout time.Duration, tlsFlag bool, allowInsecure bool) *http.Client {
+func getClient(timeout time.Duration, tlsConfig *tls.Config) *http.Client {
 	if timeout == 0 {
 		timeout = defaultClientTimeout
 	}
@@ -174,18 +209,18 @@ func getClient(timeout time.Duration, tlsFlag bool, allowInsecure bool) *http.Cl
 		Timeout: timeout,
 	}
 
-	if tlsFlag {
+	if tlsConfig != nil {
 		c.Transport = &http.Transport{
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: allowInsecure,
-			},
-		} //#nosec G402
+			TLSClientConfig: tlsConfig,
+		}
 	}
 
 	return c
 }
 
-func DoHealthCheck(v *Item, host string, config config.HealthCheck) {
+// DoHealthCheck - Checks the node, the HTTPS checks share the upstream's TLS
+// settings.
+func DoHealthCheck(v *Item, host string, config config.HealthCheck, upstreamTLS config.UpstreamTLS) {
 	url, _ := url.Parse(v.Endpoint)
 	scheme := url.Scheme
 	if scheme == "" || (scheme != "http" && scheme != "https") {
@@ -215,7 +250,16 @@ func DoHealthCheck(v *Item, host string, config config.HealthCheck) {
 		logger.GetGlobal().Errorf("Healthcheck request failed for %s / %s: %s", host, endpointURL, err) // TODO: Add to trace span?
 		return
 	}
-	res, err := getClient(config.Timeout, scheme == "https", config.AllowInsecure).Do(req)
+
+	var tlsConfig *tls.Config
+	if scheme == "https" {
+		tlsConfig, err = srvtls.UpstreamConfig(upstreamTLS, config.AllowInsecure)
+		if err != nil {
+			logger.GetGlobal().Errorf("Healthcheck TLS configuration failed for %s: %s", host, err)
+		}
+	}
+
+	res, err := getClient(config.Timeout, tlsConfig).Do(req)
 
 	v.Healthy = err == nil
 	if err != nil {
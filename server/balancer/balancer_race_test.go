@@ -43,12 +43,14 @@ func TestConcurrentPickWithHealthFlips(t *testing.T) {
 	rnd := balancer.NewRandomBalancer("race-rnd", testItems())
 	iph := balancer.NewIpHashBalancer("race-iph", testItems())
 	lc := balancer.NewLeastConnectionsBalancer("race-lc", testItems())
+	ewma := balancer.NewEWMABalancer("race-ewma", testItems())
 
 	instances := []instance{
 		{rr, &rr.NodeBalancer},
 		{rnd, &rnd.NodeBalancer},
 		{iph, &iph.NodeBalancer},
 		{lc, &lc.NodeBalancer},
+		{ewma, &ewma.NodeBalancer},
 	}
 
 	for _, inst := range instances {
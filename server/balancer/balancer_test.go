@@ -13,7 +13,6 @@ package balancer_test
 // Repo: https://github.com/fabiocicerchia/go-proxy-cache
 
 import (
-	"net/url"
 	"testing"
 
 	log "github.com/sirupsen/logrus"
@@ -26,11 +25,9 @@ import (
 func TestGetUpstreamNodeUndefined(t *testing.T) {
 	setUp()
 
-	requestURL, _ := url.Parse("https://example.com")
-
 	conf := config.Upstream{}
 	balancer.InitRoundRobin("testing", conf, false)
-	endpoint := balancer.GetUpstreamNode("testing", *requestURL, "8.8.8.8")
+	endpoint := balancer.GetUpstreamNode("testing", "127.0.0.1", "8.8.8.8")
 
 	assert.Equal(t, "8.8.8.8", endpoint)
 
@@ -40,13 +37,11 @@ func TestGetUpstreamNodeUndefined(t *testing.T) {
 func TestGetUpstreamNodeDefined(t *testing.T) {
 	setUp()
 
-	requestURL, _ := url.Parse("https://example.com")
-
 	conf := config.Upstream{
 		Endpoints: []string{"1.2.3.4"},
 	}
 	balancer.InitRoundRobin("testing", conf, false)
-	endpoint := balancer.GetUpstreamNode("testing", *requestURL, "8.8.8.8")
+	endpoint := balancer.GetUpstreamNode("testing", "127.0.0.1", "8.8.8.8")
 
 	assert.Equal(t, "1.2.3.4", endpoint)
 
@@ -0,0 +1,149 @@
+package balancer
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/fabiocicerchia/go-proxy-cache/utils/random"
+)
+
+// ewmaStats - Moving average of the response time and in-flight requests of a node.
+type ewmaStats struct {
+	latency    float64 // milliseconds
+	inFlight   int64
+	lastUpdate time.Time
+}
+
+// EWMABalancer instance.
+// It implements the "power of two choices": two random healthy nodes are
+// compared and the one with the lowest cost (latency * in-flight requests) is
+// picked, so it spreads the load without herding on the fastest node.
+type EWMABalancer struct {
+	NodeBalancer
+
+	statsM sync.Mutex
+	stats  map[string]*ewmaStats
+	decay  time.Duration
+}
+
+// NewEWMABalancer - Creates a new instance.
+func NewEWMABalancer(name string, items []Item) *EWMABalancer {
+	return &EWMABalancer{
+		NodeBalancer: NodeBalancer{
+			Id:    name,
+			M:     sync.RWMutex{},
+			Items: items,
+		},
+		stats: make(map[string]*ewmaStats),
+		decay: EWMADecay,
+	}
+}
+
+// Pick - Chooses next available item.
+func (b *EWMABalancer) Pick(key string) (string, error) {
+	healthyNodes := b.NodeBalancer.GetHealthyNodes()
+	if len(healthyNodes) == 0 {
+		return "", ErrNoAvailableItem
+	}
+
+	if len(healthyNodes) == 1 {
+		return healthyNodes[0].Endpoint, nil
+	}
+
+	n := int64(len(healthyNodes))
+	first := b.NodeBalancer.pickNode(healthyNodes, func() int {
+		return int(random.RandomInt64(n))
+	})
+	// Pick a distinct second node by shifting the first one.
+	second := b.NodeBalancer.pickNode(healthyNodes, func() int {
+		return int((int64(first) + 1 + random.RandomInt64(n-1)) % n)
+	})
+
+	a := healthyNodes[first].Endpoint
+	c := healthyNodes[second].Endpoint
+
+	now := time.Now()
+
+	b.statsM.Lock()
+	defer b.statsM.Unlock()
+
+	if b.cost(c, now) < b.cost(a, now) {
+		return c, nil
+	}
+
+	return a, nil
+}
+
+// cost - Must be called while holding statsM.
+// Nodes without stats have no latency yet, so they get probed quickly.
+func (b *EWMABalancer) cost(endpoint string, now time.Time) float64 {
+	s, ok := b.stats[endpoint]
+	if !ok {
+		return 1
+	}
+
+	// Decay the latency towards zero when the node hasn't been used for a
+	// while, so a node that was slow once gets a chance to be picked again.
+	latency := s.latency * b.weight(now.Sub(s.lastUpdate))
+
+	return (latency + 1) * float64(s.inFlight+1)
+}
+
+func (b *EWMABalancer) weight(elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 1
+	}
+
+	return math.Exp(-float64(elapsed) / float64(b.decay))
+}
+
+func (b *EWMABalancer) getStats(endpoint string) *ewmaStats {
+	s, ok := b.stats[endpoint]
+	if !ok {
+		s = &ewmaStats{}
+		b.stats[endpoint] = s
+	}
+
+	return s
+}
+
+// Begin - Tracks a request sent to the node.
+func (b *EWMABalancer) Begin(endpoint string) {
+	b.statsM.Lock()
+	defer b.statsM.Unlock()
+
+	b.getStats(endpoint).inFlight++
+}
+
+// Done - Tracks the response time of a request sent to the node.
+func (b *EWMABalancer) Done(endpoint string, responseTime time.Duration) {
+	b.statsM.Lock()
+	defer b.statsM.Unlock()
+
+	now := time.Now()
+	s := b.getStats(endpoint)
+
+	if s.inFlight > 0 {
+		s.inFlight--
+	}
+
+	sample := float64(responseTime) / float64(time.Millisecond)
+	if s.lastUpdate.IsZero() {
+		s.latency = sample
+	} else {
+		w := b.weight(now.Sub(s.lastUpdate))
+		s.latency = s.latency*w + sample*(1-w)
+	}
+
+	s.lastUpdate = now
+}
@@ -0,0 +1,135 @@
+//go:build all || unit
+// +build all unit
+
+package balancer_test
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/balancer"
+)
+
+func TestEWMAPickEmpty(t *testing.T) {
+	initLogs()
+
+	b := balancer.NewEWMABalancer("TestEWMAPickEmpty", []balancer.Item{})
+
+	value, err := b.Pick("https://example.com")
+
+	assert.NotNil(t, err)
+	assert.Equal(t, "*errors.errorString", fmt.Sprintf("%T", err))
+	assert.Equal(t, err.Error(), "no item is available")
+
+	assert.Empty(t, value)
+}
+
+func TestEWMAPickWithData(t *testing.T) {
+	initLogs()
+
+	b := balancer.NewEWMABalancer("TestEWMAPickWithData", []balancer.Item{
+		{Endpoint: "item1", Healthy: true},
+		{Endpoint: "item2", Healthy: true},
+		{Endpoint: "item3", Healthy: true},
+	})
+
+	value, err := b.Pick("https://example.com")
+
+	assert.Nil(t, err)
+	assert.Regexp(t, "^(item1|item2|item3)$", value)
+}
+
+func TestEWMAPickPrefersFasterNode(t *testing.T) {
+	initLogs()
+
+	b := balancer.NewEWMABalancer("TestEWMAPickPrefersFasterNode", []balancer.Item{
+		{Endpoint: "slow", Healthy: true},
+		{Endpoint: "fast", Healthy: true},
+	})
+
+	b.Begin("slow")
+	b.Done("slow", 500*time.Millisecond)
+	b.Begin("fast")
+	b.Done("fast", 5*time.Millisecond)
+
+	// With two nodes both are always compared.
+	for i := 0; i < 10; i++ {
+		value, err := b.Pick("https://example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, "fast", value)
+	}
+}
+
+func TestEWMAPickAccountsInFlightRequests(t *testing.T) {
+	initLogs()
+
+	b := balancer.NewEWMABalancer("TestEWMAPickAccountsInFlightRequests", []balancer.Item{
+		{Endpoint: "item1", Healthy: true},
+		{Endpoint: "item2", Healthy: true},
+	})
+
+	b.Begin("item1")
+	b.Done("item1", 10*time.Millisecond)
+	b.Begin("item2")
+	b.Done("item2", 10*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		b.Begin("item1")
+	}
+
+	value, err := b.Pick("https://example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "item2", value)
+}
+
+func TestEWMASkipsUnhealthyNodes(t *testing.T) {
+	initLogs()
+
+	b := balancer.NewEWMABalancer("TestEWMASkipsUnhealthyNodes", []balancer.Item{
+		{Endpoint: "item1", Healthy: false},
+		{Endpoint: "item2", Healthy: true},
+	})
+
+	b.Begin("item2")
+	b.Done("item2", time.Second)
+
+	value, err := b.Pick("https://example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "item2", value)
+}
+
+func TestEWMARequestFeedback(t *testing.T) {
+	setUp()
+
+	conf := config.Upstream{
+		BalancingAlgorithm: "p2c-ewma",
+		Endpoints:          []string{"slow", "fast"},
+	}
+	balancer.InitEWMA("TestEWMARequestFeedback", conf, false)
+
+	balancer.RequestStarted("TestEWMARequestFeedback", "slow")
+	balancer.RequestDone("TestEWMARequestFeedback", "slow", time.Second)
+	balancer.RequestStarted("TestEWMARequestFeedback", "fast")
+	balancer.RequestDone("TestEWMARequestFeedback", "fast", time.Millisecond)
+
+	// Not an observer, nothing happens.
+	balancer.RequestStarted("missing", "slow")
+	balancer.RequestDone("missing", "slow", time.Second)
+
+	assert.Equal(t, "fast", balancer.GetUpstreamNode("TestEWMARequestFeedback", "127.0.0.1", "8.8.8.8"))
+
+	tearDown()
+}
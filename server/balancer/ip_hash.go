@@ -21,7 +21,9 @@ import (
 type IpHashBalancer struct {
 	NodeBalancer
 
-	hashMap map[string]int64
+	// hashMap - Endpoint by client hash (positions would change with the
+	// healthy nodes).
+	hashMap map[string]string
 }
 
 // NewIpHashBalancer - Creates a new instance.
@@ -32,37 +34,39 @@ func NewIpHashBalancer(name string, items []Item) *IpHashBalancer {
 			M:     sync.RWMutex{},
 			Items: items,
 		},
-		hashMap: make(map[string]int64),
+		hashMap: make(map[string]string),
 	}
 }
 
 // Pick - Chooses next available item.
-func (b *IpHashBalancer) Pick(requestURL string) (string, error) {
+func (b *IpHashBalancer) Pick(key string) (string, error) {
 	healthyNodes := b.NodeBalancer.GetHealthyNodes()
 	if len(healthyNodes) == 0 {
 		return "", ErrNoAvailableItem
 	}
 
 	h := sha256.New()
-	h.Write([]byte(requestURL))
+	h.Write([]byte(key))
 	hash := fmt.Sprintf("%x", h.Sum(nil))
 
 	b.NodeBalancer.M.RLock()
-	// The set of healthy nodes can shrink between calls (e.g. a node becomes
-	// unhealthy), so a previously stored position may point past the current
-	// slice. Only reuse it when it is still in range, otherwise fall through and
-	// pick (and store) a fresh position.
-	if pos, ok := b.hashMap[hash]; ok && pos < int64(len(healthyNodes)) {
-		b.NodeBalancer.M.RUnlock()
-		return healthyNodes[pos].Endpoint, nil
-	}
+	endpoint, ok := b.hashMap[hash]
 	b.NodeBalancer.M.RUnlock()
 
-	rnd := random.RandomInt64(int64(len(healthyNodes)))
+	// The stored endpoint is kept as long as it is healthy.
+	for _, v := range healthyNodes {
+		if ok && v.Endpoint == endpoint {
+			return endpoint, nil
+		}
+	}
+
+	rnd := b.NodeBalancer.pickNode(healthyNodes, func() int {
+		return int(random.RandomInt64(int64(len(healthyNodes))))
+	})
 
 	r := healthyNodes[rnd]
 	b.NodeBalancer.M.Lock()
-	b.hashMap[hash] = rnd
+	b.hashMap[hash] = r.Endpoint
 	b.NodeBalancer.M.Unlock()
 
 	return r.Endpoint, nil
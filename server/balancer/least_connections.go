@@ -37,23 +37,32 @@ func NewLeastConnectionsBalancer(name string, items []Item) *LeastConnectionsBal
 }
 
 // Pick - Chooses next available item.
-func (b *LeastConnectionsBalancer) Pick(requestURL string) (string, error) {
+func (b *LeastConnectionsBalancer) Pick(key string) (string, error) {
 	healthyNodes := b.NodeBalancer.GetHealthyNodes()
 	if len(healthyNodes) == 0 {
 		return "", ErrNoAvailableItem
 	}
 
-	electedNode := healthyNodes[0].Endpoint
+	// Every attempt elects the least used node among the ones not tried yet.
+	tried := make(map[int]bool, len(healthyNodes))
 
 	b.NodeBalancer.M.RLock()
-	leastConnection := b.connections[electedNode]
+	k := b.NodeBalancer.pickNode(healthyNodes, func() int {
+		if len(tried) == len(healthyNodes) {
+			tried = make(map[int]bool, len(healthyNodes))
+		}
 
-	for _, v := range healthyNodes {
-		if b.connections[v.Endpoint] < leastConnection {
-			leastConnection = b.connections[v.Endpoint]
-			electedNode = v.Endpoint
+		elected := -1
+		for k, v := range healthyNodes {
+			if !tried[k] && (elected == -1 || b.connections[v.Endpoint] < b.connections[healthyNodes[elected].Endpoint]) {
+				elected = k
+			}
 		}
-	}
+		tried[elected] = true
+
+		return elected
+	})
+	electedNode := healthyNodes[k].Endpoint
 	b.NodeBalancer.M.RUnlock()
 
 	b.NodeBalancer.M.Lock()
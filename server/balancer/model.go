@@ -12,6 +12,8 @@ package balancer
 import (
 	"sync"
 	"time"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
 )
 
 // HealthCheckInterval - Health Check Frequency.
@@ -20,6 +22,9 @@ const HealthCheckInterval time.Duration = 30 * time.Second // TODO: make it cust
 // LeastConnectionsResetInterval - How often reset internal counter for Least Connection LoadBalancer.
 const LeastConnectionsResetInterval time.Duration = 5 * time.Minute // TODO: make it customizable
 
+// EWMADecay - How quickly the moving average of the response time forgets the past samples.
+const EWMADecay time.Duration = 10 * time.Second
+
 // LoadBalancing - Contains the multiple instances for the active servers.
 type LoadBalancing map[string]Balancer
 
@@ -29,6 +34,10 @@ var lb LoadBalancing
 type Item struct {
 	Healthy  bool
 	Endpoint string
+
+	// HealthySince - When the node recovered (or was added), zero when it has
+	// been healthy since the start.
+	HealthySince time.Time
 }
 
 // NodeBalancer - Core structure for a load balancer.
@@ -37,6 +46,8 @@ type NodeBalancer struct {
 
 	Id    string
 	Items []Item
+
+	SlowStart config.SlowStart
 }
 
 // GetNodeBalancer - Returns the embedded NodeBalancer, promoted to every
@@ -48,6 +59,15 @@ func (b *NodeBalancer) GetNodeBalancer() *NodeBalancer {
 // Balancer - Represents a Load Balancer interface.
 type Balancer interface {
 	GetHealthyNodes() []Item
-	Pick(requestURL string) (string, error)
+	// Pick - The key identifies the client (its IP), it's used by the
+	// hashing algorithms.
+	Pick(key string) (string, error)
 	GetNodeBalancer() *NodeBalancer
 }
+
+// Observer - Implemented by the balancers which need feedback about the
+// requests routed to their nodes.
+type Observer interface {
+	Begin(endpoint string)
+	Done(endpoint string, responseTime time.Duration)
+}
@@ -35,13 +35,15 @@ func NewRandomBalancer(name string, items []Item) *RandomBalancer {
 }
 
 // Pick - Chooses next available item.
-func (b *RandomBalancer) Pick(requestURL string) (string, error) {
+func (b *RandomBalancer) Pick(key string) (string, error) {
 	healthyNodes := b.NodeBalancer.GetHealthyNodes()
 	if len(healthyNodes) == 0 {
 		return "", ErrNoAvailableItem
 	}
 
-	rnd := random.RandomInt64(int64(len(healthyNodes)))
+	rnd := b.NodeBalancer.pickNode(healthyNodes, func() int {
+		return int(random.RandomInt64(int64(len(healthyNodes))))
+	})
 
 	b.NodeBalancer.M.Lock()
 	r := healthyNodes[rnd]
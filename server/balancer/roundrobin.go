@@ -37,7 +37,7 @@ func NewRoundRobinBalancer(name string, items []Item) *RoundRobinBalancer {
 }
 
 // Pick - Chooses next available item.
-func (b *RoundRobinBalancer) Pick(requestURL string) (string, error) {
+func (b *RoundRobinBalancer) Pick(key string) (string, error) {
 	// GetHealthyNodes locks internally.
 	healthyNodes := b.NodeBalancer.GetHealthyNodes()
 
@@ -49,11 +49,16 @@ func (b *RoundRobinBalancer) Pick(requestURL string) (string, error) {
 	// The set of healthy nodes can shrink between calls (e.g. a node becomes
 	// unhealthy), so b.next may point past the current slice. Clamp it to avoid
 	// an index-out-of-range panic.
-	if b.next >= len(healthyNodes) {
-		b.next = 0
-	}
-	r := healthyNodes[b.next]
-	b.next = (b.next + 1) % len(healthyNodes)
+	k := b.NodeBalancer.pickNode(healthyNodes, func() int {
+		if b.next >= len(healthyNodes) {
+			b.next = 0
+		}
+		k := b.next
+		b.next = (b.next + 1) % len(healthyNodes)
+
+		return k
+	})
+	r := healthyNodes[k]
 	b.NodeBalancer.M.Unlock()
 
 	return r.Endpoint, nil
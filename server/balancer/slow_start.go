@@ -0,0 +1,89 @@
+package balancer
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"time"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/utils/random"
+)
+
+// maxWeight - Weight of a fully warmed up node, in percent.
+const maxWeight = 100
+
+// inheritHealthySince - Nodes added when re-initialising an existing balancer
+// start slow, the ones already known keep their own state.
+func inheritHealthySince(previous *NodeBalancer, items []Item, now time.Time) {
+	previous.M.RLock()
+	defer previous.M.RUnlock()
+
+	known := make(map[string]time.Time, len(previous.Items))
+	for _, v := range previous.Items {
+		known[v.Endpoint] = v.HealthySince
+	}
+
+	for k := range items {
+		since, ok := known[items[k].Endpoint]
+		if !ok {
+			since = now
+		}
+		items[k].HealthySince = since
+	}
+}
+
+// getSlowStartWeight - Returns the effective weight of a node (in percent),
+// it ramps up linearly from the minimum weight during the slow start window.
+func getSlowStartWeight(conf config.SlowStart, since time.Time, now time.Time) int64 {
+	elapsed := now.Sub(since)
+	if conf.Duration <= 0 || since.IsZero() || elapsed >= conf.Duration {
+		return maxWeight
+	}
+
+	minWeight := int64(conf.MinWeight)
+	if minWeight <= 0 || minWeight > maxWeight {
+		minWeight = config.DefaultSlowStartMinWeight
+	}
+
+	if elapsed <= 0 {
+		return minWeight
+	}
+
+	return minWeight + (maxWeight-minWeight)*int64(elapsed)/int64(conf.Duration)
+}
+
+// maxSlowStartPicks - Attempts before accepting a node in slow start.
+const maxSlowStartPicks = 10
+
+// admits - Rolls the node's effective weight: a node in slow start is
+// accepted with a probability matching it.
+func (b *NodeBalancer) admits(item Item, now time.Time) bool {
+	weight := getSlowStartWeight(b.SlowStart, item.HealthySince, now)
+
+	return weight >= maxWeight || random.RandomInt64(maxWeight) < weight
+}
+
+// pickNode - Returns the position of the node picked by the algorithm. A node
+// in slow start losing its weight roll is picked again, so its share of
+// traffic grows over time while the healthy nodes (and the positions in them)
+// stay the same.
+func (b *NodeBalancer) pickNode(nodes []Item, pick func() int) int {
+	k := pick()
+	if b.SlowStart.Duration <= 0 {
+		return k
+	}
+
+	now := time.Now()
+	for i := 1; i < maxSlowStartPicks && !b.admits(nodes[k], now); i++ {
+		k = pick()
+	}
+
+	return k
+}
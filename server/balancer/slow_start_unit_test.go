@@ -0,0 +1,126 @@
+//go:build all || unit
+// +build all unit
+
+package balancer
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/utils/random"
+)
+
+func TestGetSlowStartWeight(t *testing.T) {
+	now := time.Now()
+	conf := config.SlowStart{Duration: 10 * time.Second, MinWeight: 20}
+
+	assert.Equal(t, int64(100), getSlowStartWeight(config.SlowStart{}, now, now))
+	assert.Equal(t, int64(100), getSlowStartWeight(conf, time.Time{}, now))
+	assert.Equal(t, int64(20), getSlowStartWeight(conf, now, now))
+	assert.Equal(t, int64(60), getSlowStartWeight(conf, now.Add(-5*time.Second), now))
+	assert.Equal(t, int64(100), getSlowStartWeight(conf, now.Add(-10*time.Second), now))
+
+	conf.MinWeight = 0
+	assert.Equal(t, int64(config.DefaultSlowStartMinWeight), getSlowStartWeight(conf, now, now))
+}
+
+func TestPickNodeRampsUp(t *testing.T) {
+	b := &NodeBalancer{
+		Id: "TestPickNodeRampsUp",
+		Items: []Item{
+			{Endpoint: "warm", Healthy: true},
+			{Endpoint: "cold", Healthy: true, HealthySince: time.Now()},
+			{Endpoint: "down", Healthy: false},
+		},
+		SlowStart: config.SlowStart{Duration: time.Hour, MinWeight: 1},
+	}
+
+	// The healthy nodes stay the same, only the final selection is weighted.
+	nodes := b.GetHealthyNodes()
+	assert.Len(t, nodes, 2)
+
+	pick := func() int { return int(random.RandomInt64(int64(len(nodes)))) }
+
+	picked := 0
+	for i := 0; i < 200; i++ {
+		if nodes[b.pickNode(nodes, pick)].Endpoint == "cold" {
+			picked++
+		}
+	}
+	assert.Less(t, picked, 20)
+
+	// Once the window is over the node gets its full share.
+	b.Items[1].HealthySince = time.Now().Add(-time.Hour)
+	nodes = b.GetHealthyNodes()
+
+	picked = 0
+	for i := 0; i < 200; i++ {
+		if nodes[b.pickNode(nodes, pick)].Endpoint == "cold" {
+			picked++
+		}
+	}
+	assert.Greater(t, picked, 50)
+}
+
+func TestPickNodeFallback(t *testing.T) {
+	b := &NodeBalancer{
+		Id:        "TestPickNodeFallback",
+		Items:     []Item{{Endpoint: "cold", Healthy: true, HealthySince: time.Now()}},
+		SlowStart: config.SlowStart{Duration: time.Hour, MinWeight: 1},
+	}
+
+	nodes := b.GetHealthyNodes()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, 0, b.pickNode(nodes, func() int { return 0 }))
+	}
+}
+
+func TestIpHashKeepsAffinityDuringSlowStart(t *testing.T) {
+	b := NewIpHashBalancer("TestIpHashKeepsAffinityDuringSlowStart", []Item{
+		{Endpoint: "warm", Healthy: true},
+		{Endpoint: "cold1", Healthy: true, HealthySince: time.Now()},
+		{Endpoint: "cold2", Healthy: true, HealthySince: time.Now()},
+	})
+	b.SlowStart = config.SlowStart{Duration: time.Hour, MinWeight: 50}
+
+	for _, key := range []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4"} {
+		first, err := b.Pick(key)
+		assert.Nil(t, err)
+
+		for i := 0; i < 20; i++ {
+			endpoint, _ := b.Pick(key)
+			assert.Equal(t, first, endpoint)
+		}
+	}
+}
+
+func TestInitMarksNewNodesInSlowStart(t *testing.T) {
+	name := "TestInitMarksNewNodesInSlowStart"
+	conf := config.Upstream{
+		Endpoints: []string{"server1"},
+		SlowStart: config.SlowStart{Duration: time.Minute},
+	}
+
+	InitRoundRobin(name, conf, false)
+	assert.True(t, lb[name].GetNodeBalancer().Items[0].HealthySince.IsZero())
+
+	conf.Endpoints = []string{"server1", "server2"}
+	InitRoundRobin(name, conf, false)
+
+	items := lb[name].GetNodeBalancer().Items
+	assert.True(t, items[0].HealthySince.IsZero())
+	assert.False(t, items[1].HealthySince.IsZero())
+	assert.Equal(t, time.Minute, lb[name].GetNodeBalancer().SlowStart.Duration)
+}
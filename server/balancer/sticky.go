@@ -0,0 +1,63 @@
+package balancer
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// stickyNodeIDLength - Amount of hex chars used to identify a node.
+const stickyNodeIDLength = 16
+
+// GetNodeID - Returns the opaque identifier of an endpoint, so the endpoint
+// itself (e.g. a private IP) is never disclosed to the clients.
+func GetNodeID(endpoint string) string {
+	h := sha256.Sum256([]byte(endpoint))
+
+	return hex.EncodeToString(h[:])[:stickyNodeIDLength]
+}
+
+// GetStickyNode - Returns the endpoint matching the node ID, only when it is
+// still part of the balancer and healthy.
+func GetStickyNode(name string, nodeID string) (string, bool) {
+	lbDomain, ok := lb[name]
+	if !ok || nodeID == "" {
+		return "", false
+	}
+
+	for _, v := range lbDomain.GetHealthyNodes() {
+		if GetNodeID(v.Endpoint) == nodeID {
+			return v.Endpoint, true
+		}
+	}
+
+	return "", false
+}
+
+// HasNode - Checks whether the endpoint is one of the balanced nodes.
+func HasNode(name string, endpoint string) bool {
+	lbDomain, ok := lb[name]
+	if !ok {
+		return false
+	}
+
+	b := lbDomain.GetNodeBalancer()
+	b.M.RLock()
+	defer b.M.RUnlock()
+
+	for _, v := range b.Items {
+		if v.Endpoint == endpoint {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,56 @@
+//go:build all || unit
+// +build all unit
+
+package balancer
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+func TestGetNodeIDIsOpaque(t *testing.T) {
+	id := GetNodeID("10.0.0.1:8080")
+
+	assert.Len(t, id, stickyNodeIDLength)
+	assert.NotContains(t, id, "10.0.0.1")
+	assert.Equal(t, id, GetNodeID("10.0.0.1:8080"))
+	assert.NotEqual(t, id, GetNodeID("10.0.0.2:8080"))
+}
+
+func TestGetStickyNode(t *testing.T) {
+	InitRoundRobin("TestGetStickyNode", config.Upstream{Endpoints: []string{"server1", "server2"}}, false)
+
+	endpoint, ok := GetStickyNode("TestGetStickyNode", GetNodeID("server2"))
+	assert.True(t, ok)
+	assert.Equal(t, "server2", endpoint)
+
+	_, ok = GetStickyNode("TestGetStickyNode", GetNodeID("server3"))
+	assert.False(t, ok)
+
+	_, ok = GetStickyNode("missing", GetNodeID("server2"))
+	assert.False(t, ok)
+
+	// An unhealthy node must not be honored anymore.
+	b := lb["TestGetStickyNode"].GetNodeBalancer()
+	b.M.Lock()
+	b.Items[1].Healthy = false
+	b.M.Unlock()
+
+	_, ok = GetStickyNode("TestGetStickyNode", GetNodeID("server2"))
+	assert.False(t, ok)
+
+	assert.True(t, HasNode("TestGetStickyNode", "server2"))
+	assert.False(t, HasNode("TestGetStickyNode", "server3"))
+}
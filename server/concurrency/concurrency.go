@@ -0,0 +1,71 @@
+package concurrency
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/utils"
+)
+
+var limiters = make(map[string]*Limiter)
+var mu sync.RWMutex
+
+// GetNodeID - Returns the ID of the limiter of a node in the pool.
+func GetNodeID(name string, endpoint string) string {
+	return name + utils.StringSeparatorOne + endpoint
+}
+
+// Init - Initialises the limiters of the upstream pool, and of its nodes.
+func Init(name string, upstream config.Upstream) {
+	conf := upstream.Concurrency
+
+	timeout := conf.QueueTimeout
+	if timeout == 0 {
+		timeout = config.DefaultConcurrencyQueueTimeout
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	limiters[name] = NewLimiter(name, conf.MaxRequests, conf.QueueSize, timeout)
+
+	for _, endpoint := range upstream.Endpoints {
+		nodeID := GetNodeID(name, endpoint)
+		limiters[nodeID] = NewLimiter(nodeID, conf.MaxRequestsPerNode, conf.QueueSize, timeout)
+	}
+}
+
+// Acquire - Takes a slot in the upstream pool and one in the node, the
+// returned function releases both of them.
+func Acquire(ctx context.Context, name string, endpoint string) (func(), error) {
+	mu.RLock()
+	pool := limiters[name]
+	node := limiters[GetNodeID(name, endpoint)]
+	mu.RUnlock()
+
+	releasePool, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	releaseNode, err := node.Acquire(ctx)
+	if err != nil {
+		releasePool()
+		return nil, err
+	}
+
+	return func() {
+		releaseNode()
+		releasePool()
+	}, nil
+}
@@ -0,0 +1,134 @@
+//go:build all || unit
+// +build all unit
+
+package concurrency_test
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/concurrency"
+)
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := concurrency.NewLimiter("TestLimiterUnlimited", 0, 0, time.Second)
+	assert.Nil(t, l)
+
+	for i := 0; i < 10; i++ {
+		release, err := l.Acquire(context.Background())
+		assert.Nil(t, err)
+		release()
+	}
+}
+
+func TestLimiterWithoutQueue(t *testing.T) {
+	l := concurrency.NewLimiter("TestLimiterWithoutQueue", 1, 0, time.Second)
+
+	release, err := l.Acquire(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, l.InFlight())
+
+	_, err = l.Acquire(context.Background())
+	assert.Equal(t, concurrency.ErrQueueFull, err)
+
+	release()
+	assert.Equal(t, 0, l.InFlight())
+
+	release, err = l.Acquire(context.Background())
+	assert.Nil(t, err)
+	release()
+}
+
+func TestLimiterQueue(t *testing.T) {
+	l := concurrency.NewLimiter("TestLimiterQueue", 1, 1, time.Second)
+
+	release, err := l.Acquire(context.Background())
+	assert.Nil(t, err)
+
+	acquired := make(chan error)
+	go func() {
+		releaseQueued, err := l.Acquire(context.Background())
+		if err == nil {
+			releaseQueued()
+		}
+		acquired <- err
+	}()
+
+	assert.Eventually(t, func() bool { return l.QueueDepth() == 1 }, time.Second, time.Millisecond)
+
+	// The queue is full.
+	_, err = l.Acquire(context.Background())
+	assert.Equal(t, concurrency.ErrQueueFull, err)
+
+	release()
+	assert.Nil(t, <-acquired)
+	assert.Equal(t, 0, l.QueueDepth())
+	assert.Equal(t, 0, l.InFlight())
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	l := concurrency.NewLimiter("TestLimiterQueueTimeout", 1, 1, 10*time.Millisecond)
+
+	release, err := l.Acquire(context.Background())
+	assert.Nil(t, err)
+	defer release()
+
+	_, err = l.Acquire(context.Background())
+	assert.Equal(t, concurrency.ErrQueueTimeout, err)
+	assert.Equal(t, 0, l.QueueDepth())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = l.Acquire(ctx)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestAcquirePoolAndNode(t *testing.T) {
+	concurrency.Init("TestAcquirePoolAndNode", config.Upstream{
+		Endpoints: []string{"server1", "server2"},
+		Concurrency: config.Concurrency{
+			MaxRequests:        2,
+			MaxRequestsPerNode: 1,
+		},
+	})
+
+	release1, err := concurrency.Acquire(context.Background(), "TestAcquirePoolAndNode", "server1")
+	assert.Nil(t, err)
+
+	// The node is full.
+	_, err = concurrency.Acquire(context.Background(), "TestAcquirePoolAndNode", "server1")
+	assert.Equal(t, concurrency.ErrQueueFull, err)
+
+	release2, err := concurrency.Acquire(context.Background(), "TestAcquirePoolAndNode", "server2")
+	assert.Nil(t, err)
+
+	// The pool is full.
+	_, err = concurrency.Acquire(context.Background(), "TestAcquirePoolAndNode", "server3")
+	assert.Equal(t, concurrency.ErrQueueFull, err)
+
+	release1()
+	release2()
+
+	release, err := concurrency.Acquire(context.Background(), "TestAcquirePoolAndNode", "server1")
+	assert.Nil(t, err)
+	release()
+
+	// Not initialised: unlimited.
+	release, err = concurrency.Acquire(context.Background(), "missing", "server1")
+	assert.Nil(t, err)
+	release()
+}
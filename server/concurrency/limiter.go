@@ -0,0 +1,119 @@
+package concurrency
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry/metrics"
+)
+
+// ErrQueueFull - The request cannot wait for a free slot.
+var ErrQueueFull = errors.New("concurrency queue is full")
+
+// ErrQueueTimeout - The request waited too long for a free slot.
+var ErrQueueTimeout = errors.New("concurrency queue timeout")
+
+// Limiter - Caps the in-flight requests, the excess waits in a bounded queue.
+// A nil Limiter doesn't limit anything.
+type Limiter struct {
+	Name string
+
+	slots   chan struct{}
+	queue   chan struct{}
+	timeout time.Duration
+}
+
+// NewLimiter - Returns a new Limiter, nil when max is not positive (unlimited).
+func NewLimiter(name string, max int, queueSize int, timeout time.Duration) *Limiter {
+	if max <= 0 {
+		return nil
+	}
+
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	return &Limiter{
+		Name:    name,
+		slots:   make(chan struct{}, max),
+		queue:   make(chan struct{}, queueSize),
+		timeout: timeout,
+	}
+}
+
+// Acquire - Takes a free slot, waiting in the queue when there's none. The
+// returned function releases the slot.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		l.report()
+		return l.release, nil
+	default:
+	}
+
+	select {
+	case l.queue <- struct{}{}:
+		l.report()
+	default:
+		return nil, ErrQueueFull
+	}
+
+	defer func() {
+		<-l.queue
+		l.report()
+	}()
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return l.release, nil
+	case <-timer.C:
+		return nil, ErrQueueTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// InFlight - Returns the amount of slots taken.
+func (l *Limiter) InFlight() int {
+	if l == nil {
+		return 0
+	}
+
+	return len(l.slots)
+}
+
+// QueueDepth - Returns the amount of requests waiting for a slot.
+func (l *Limiter) QueueDepth() int {
+	if l == nil {
+		return 0
+	}
+
+	return len(l.queue)
+}
+
+func (l *Limiter) release() {
+	<-l.slots
+	l.report()
+}
+
+func (l *Limiter) report() {
+	metrics.SetConcurrencyInFlight(l.Name, float64(len(l.slots)))
+	metrics.SetConcurrencyQueueDepth(l.Name, float64(len(l.queue)))
+}
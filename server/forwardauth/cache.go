@@ -0,0 +1,98 @@
+package forwardauth
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+// maxCacheEntries - Amount of cached results before sweeping the expired ones.
+const maxCacheEntries = 100000
+
+type cacheEntry struct {
+	result    Result
+	expiresAt time.Time
+}
+
+// resultCache - Per-instance results, the credentials are stored hashed.
+type resultCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+var results = &resultCache{entries: make(map[string]cacheEntry)}
+
+func (c *resultCache) get(key string) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return Result{}, false
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		delete(c.entries, key)
+		return Result{}, false
+	}
+
+	return entry.result, true
+}
+
+func (c *resultCache) set(key string, result Result, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if len(c.entries) >= maxCacheEntries {
+		c.sweep(now)
+	}
+
+	c.entries[key] = cacheEntry{result: result, expiresAt: now.Add(ttl)}
+}
+
+func (c *resultCache) sweep(now time.Time) {
+	for k, v := range c.entries {
+		if now.After(v.expiresAt) {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// getCacheKey - Identifies the credentials sent to the auth endpoint, it's
+// empty when the cache is disabled or the request carries no credentials
+// (anonymous requests always hit the auth endpoint).
+func getCacheKey(conf config.ForwardAuth, header http.Header) string {
+	if conf.CacheTTL <= 0 {
+		return ""
+	}
+
+	credentials := []string{}
+	for _, h := range GetRequestHeaders(conf) {
+		if values := header.Values(h); len(values) > 0 {
+			credentials = append(credentials, http.CanonicalHeaderKey(h)+": "+strings.Join(values, ", "))
+		}
+	}
+
+	if len(credentials) == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(conf.Address + "\n" + strings.Join(credentials, "\n")))
+
+	return hex.EncodeToString(sum[:])
+}
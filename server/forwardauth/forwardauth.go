@@ -0,0 +1,126 @@
+package forwardauth
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+// maxBodySize - Maximum size of the auth response body returned to the client.
+const maxBodySize = 64 * 1024
+
+// Headers describing the original request, sent to the auth endpoint.
+const (
+	HeaderForwardedMethod = "X-Forwarded-Method"
+	HeaderForwardedProto  = "X-Forwarded-Proto"
+	HeaderForwardedHost   = "X-Forwarded-Host"
+	HeaderForwardedURI    = "X-Forwarded-Uri"
+	HeaderForwardedFor    = "X-Forwarded-For"
+)
+
+// client - The redirects are not followed: they're returned to the client
+// (e.g. to a login page).
+var client = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// Result - Response of the auth endpoint.
+type Result struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// IsAllowed - Checks whether the auth endpoint let the request through.
+func (r Result) IsAllowed() bool {
+	return r.StatusCode >= http.StatusOK && r.StatusCode < http.StatusMultipleChoices
+}
+
+// GetRequestHeaders - Returns the headers sent to the auth endpoint.
+func GetRequestHeaders(conf config.ForwardAuth) []string {
+	if len(conf.RequestHeaders) == 0 {
+		return config.DefaultForwardAuthRequestHeaders
+	}
+
+	return conf.RequestHeaders
+}
+
+// Check - Sends the subrequest to the auth endpoint, the result is cached
+// (by credentials) when the cache TTL is set.
+func Check(ctx context.Context, conf config.ForwardAuth, req *http.Request, scheme string, clientIP string) (Result, error) {
+	key := getCacheKey(conf, req.Header)
+	if key != "" {
+		if res, found := results.get(key); found {
+			return res, nil
+		}
+	}
+
+	res, err := send(ctx, conf, req, scheme, clientIP)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Server errors are transient, they're never cached.
+	if key != "" && res.StatusCode < http.StatusInternalServerError {
+		results.set(key, res, conf.CacheTTL)
+	}
+
+	return res, nil
+}
+
+func send(ctx context.Context, conf config.ForwardAuth, req *http.Request, scheme string, clientIP string) (Result, error) {
+	timeout := conf.Timeout
+	if timeout == 0 {
+		timeout = config.DefaultForwardAuthTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	authReq, err := http.NewRequestWithContext(ctx, req.Method, conf.Address, nil)
+	if err != nil {
+		return Result{}, err
+	}
+
+	for _, h := range GetRequestHeaders(conf) {
+		for _, v := range req.Header.Values(h) {
+			authReq.Header.Add(h, v)
+		}
+	}
+
+	authReq.Header.Set(HeaderForwardedMethod, req.Method)
+	authReq.Header.Set(HeaderForwardedProto, scheme)
+	authReq.Header.Set(HeaderForwardedHost, req.Host)
+	authReq.Header.Set(HeaderForwardedURI, req.URL.RequestURI())
+	authReq.Header.Set(HeaderForwardedFor, clientIP)
+
+	authRes, err := client.Do(authReq)
+	if err != nil {
+		return Result{}, err
+	}
+	defer authRes.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(authRes.Body, maxBodySize))
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		StatusCode: authRes.StatusCode,
+		Header:     authRes.Header,
+		Body:       body,
+	}, nil
+}
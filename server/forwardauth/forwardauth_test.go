@@ -0,0 +1,195 @@
+//go:build all || unit
+// +build all unit
+
+package forwardauth_test
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/forwardauth"
+)
+
+func newAuthServer(calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+
+		switch r.Header.Get("Authorization") {
+		case "Bearer valid":
+			w.Header().Set("X-Auth-User", "john")
+			w.WriteHeader(http.StatusNoContent)
+		case "Bearer broken":
+			w.WriteHeader(http.StatusBadGateway)
+		case "":
+			http.Redirect(w, r, "https://login.example.com/?rd="+r.Header.Get(forwardauth.HeaderForwardedURI), http.StatusFound)
+		default:
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("invalid token"))
+		}
+	}))
+}
+
+func newRequest(method string, target string, authorization string) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	return req
+}
+
+func TestCheckForwardsTheOriginalRequest(t *testing.T) {
+	var received *http.Request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+	}))
+	defer srv.Close()
+
+	req := newRequest(http.MethodPost, "http://www.example.com/path?q=1", "Bearer valid")
+	req.Header.Set("Cookie", "session=abc")
+	req.Header.Set("X-Custom", "value")
+
+	conf := config.ForwardAuth{Address: srv.URL + "/auth"}
+	res, err := forwardauth.Check(context.Background(), conf, req, "https", "1.2.3.4")
+
+	assert.Nil(t, err)
+	assert.True(t, res.IsAllowed())
+
+	assert.Equal(t, http.MethodPost, received.Method)
+	assert.Equal(t, "/auth", received.URL.Path)
+	assert.Equal(t, "Bearer valid", received.Header.Get("Authorization"))
+	assert.Equal(t, "session=abc", received.Header.Get("Cookie"))
+	assert.Empty(t, received.Header.Get("X-Custom"))
+	assert.Equal(t, http.MethodPost, received.Header.Get(forwardauth.HeaderForwardedMethod))
+	assert.Equal(t, "https", received.Header.Get(forwardauth.HeaderForwardedProto))
+	assert.Equal(t, "www.example.com", received.Header.Get(forwardauth.HeaderForwardedHost))
+	assert.Equal(t, "/path?q=1", received.Header.Get(forwardauth.HeaderForwardedURI))
+	assert.Equal(t, "1.2.3.4", received.Header.Get(forwardauth.HeaderForwardedFor))
+}
+
+func TestCheckSelectedHeaders(t *testing.T) {
+	var received *http.Request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+	}))
+	defer srv.Close()
+
+	req := newRequest(http.MethodGet, "http://www.example.com/", "Bearer valid")
+	req.Header.Set("X-Api-Key", "secret")
+
+	conf := config.ForwardAuth{Address: srv.URL, RequestHeaders: []string{"X-Api-Key"}}
+	_, err := forwardauth.Check(context.Background(), conf, req, "http", "1.2.3.4")
+
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", received.Header.Get("X-Api-Key"))
+	assert.Empty(t, received.Header.Get("Authorization"))
+}
+
+func TestCheckResults(t *testing.T) {
+	var calls int32
+
+	srv := newAuthServer(&calls)
+	defer srv.Close()
+
+	conf := config.ForwardAuth{Address: srv.URL}
+
+	res, err := forwardauth.Check(context.Background(), conf, newRequest(http.MethodGet, "/", "Bearer valid"), "http", "1.2.3.4")
+	assert.Nil(t, err)
+	assert.True(t, res.IsAllowed())
+	assert.Equal(t, "john", res.Header.Get("X-Auth-User"))
+
+	res, err = forwardauth.Check(context.Background(), conf, newRequest(http.MethodGet, "/", "Bearer invalid"), "http", "1.2.3.4")
+	assert.Nil(t, err)
+	assert.False(t, res.IsAllowed())
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	assert.Equal(t, "Bearer", res.Header.Get("WWW-Authenticate"))
+	assert.Equal(t, "invalid token", string(res.Body))
+
+	// Redirects are returned, not followed.
+	res, err = forwardauth.Check(context.Background(), conf, newRequest(http.MethodGet, "/private", ""), "http", "1.2.3.4")
+	assert.Nil(t, err)
+	assert.False(t, res.IsAllowed())
+	assert.Equal(t, http.StatusFound, res.StatusCode)
+	assert.Equal(t, "https://login.example.com/?rd=/private", res.Header.Get("Location"))
+}
+
+func TestCheckUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	conf := config.ForwardAuth{Address: srv.URL, Timeout: 10 * time.Millisecond}
+	_, err := forwardauth.Check(context.Background(), conf, newRequest(http.MethodGet, "/", "Bearer valid"), "http", "1.2.3.4")
+
+	assert.NotNil(t, err)
+}
+
+func TestCheckCache(t *testing.T) {
+	var calls int32
+
+	srv := newAuthServer(&calls)
+	defer srv.Close()
+
+	conf := config.ForwardAuth{Address: srv.URL, CacheTTL: 50 * time.Millisecond}
+
+	check := func(authorization string) forwardauth.Result {
+		res, err := forwardauth.Check(context.Background(), conf, newRequest(http.MethodGet, "/", authorization), "http", "1.2.3.4")
+		assert.Nil(t, err)
+
+		return res
+	}
+
+	// Allowed and denied results are cached by credentials.
+	assert.True(t, check("Bearer valid").IsAllowed())
+	assert.True(t, check("Bearer valid").IsAllowed())
+	assert.False(t, check("Bearer invalid").IsAllowed())
+	assert.False(t, check("Bearer invalid").IsAllowed())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// Server errors and anonymous requests are never cached.
+	check("Bearer broken")
+	check("Bearer broken")
+	check("")
+	check("")
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+
+	time.Sleep(60 * time.Millisecond)
+
+	assert.True(t, check("Bearer valid").IsAllowed())
+	assert.Equal(t, int32(7), atomic.LoadInt32(&calls))
+}
+
+func TestCheckCacheDisabled(t *testing.T) {
+	var calls int32
+
+	srv := newAuthServer(&calls)
+	defer srv.Close()
+
+	conf := config.ForwardAuth{Address: srv.URL}
+
+	for i := 0; i < 3; i++ {
+		_, _ = forwardauth.Check(context.Background(), conf, newRequest(http.MethodGet, "/", "Bearer valid"), "http", "1.2.3.4")
+	}
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
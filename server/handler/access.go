@@ -0,0 +1,50 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/fabiocicerchia/go-proxy-cache/logger"
+	"github.com/fabiocicerchia/go-proxy-cache/server/access"
+	"github.com/fabiocicerchia/go-proxy-cache/server/cache"
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry"
+)
+
+// IsAccessDenied - Checks the client IP against the access rules of the
+// location (or domain), when denied a 403 (or 404) is sent.
+func (rc RequestCall) IsAccessDenied(ctx context.Context) bool {
+	locationID := ""
+	if rc.Location != nil {
+		locationID = rc.Location.GetBalancerID()
+	}
+
+	rules := access.Load().GetRules(rc.DomainConfig.Server.Upstream.GetDomainID(), locationID)
+
+	clientIP := rc.GetClientIP()
+	if rules.IsAllowed(net.ParseIP(clientIP)) {
+		return false
+	}
+
+	rc.GetLogger().Warnf("Access denied to %s (remote address: %s)", clientIP, rc.GetRemoteIP())
+
+	rc.Response.ForceWriteHeader(rules.Status)
+	_ = rc.Response.WriteBody(http.StatusText(rules.Status) + "\n")
+
+	telemetry.From(ctx).RegisterStatusCode(rules.Status)
+
+	if enableLoggingRequest {
+		logger.LogRequest(rc.Request, rules.Status, 0, rc.ReqID, cache.StatusNA)
+	}
+
+	return true
+}
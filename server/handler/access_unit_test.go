@@ -0,0 +1,137 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/access"
+	"github.com/fabiocicerchia/go-proxy-cache/server/balancer"
+)
+
+func getAccessConfig() config.Configuration {
+	conf := config.Configuration{}
+	conf.CopyOverWith(config.Configuration{
+		Server: config.Server{
+			Upstream: config.Upstream{
+				Host:   "access.example.com",
+				Scheme: "http",
+			},
+			TrustedProxies: []string{"10.0.0.1"},
+			AccessControl: config.AccessControl{
+				Deny: []string{"192.168.0.0/16"},
+			},
+			Locations: config.Locations{
+				{
+					Prefix: "/admin",
+					AccessControl: config.AccessControl{
+						Allow:  []string{"172.16.0.0/12"},
+						Status: http.StatusNotFound,
+					},
+				},
+			},
+		},
+	}, nil)
+
+	return conf
+}
+
+func TestIsAccessDenied(t *testing.T) {
+	access.Store(access.NewSnapshot(getAccessConfig()))
+	defer access.Store(&access.Snapshot{})
+
+	tests := []struct {
+		name       string
+		target     string
+		remoteAddr string
+		header     http.Header
+		status     int
+	}{
+		{"allowed", "/", "1.2.3.4:1234", http.Header{}, 0},
+		{"denied", "/", "192.168.1.1:1234", http.Header{}, http.StatusForbidden},
+		{"denied through trusted proxy", "/", "10.0.0.1:1234", http.Header{"X-Forwarded-For": []string{"192.168.1.1"}}, http.StatusForbidden},
+		{"spoofed header", "/", "1.2.3.4:1234", http.Header{"X-Forwarded-For": []string{"192.168.1.1"}}, 0},
+		{"location allowed", "/admin", "172.16.0.1:1234", http.Header{}, 0},
+		{"location denied", "/admin", "1.2.3.4:1234", http.Header{}, http.StatusNotFound},
+		{"location replaces domain", "/admin", "10.0.0.1:1234", http.Header{"X-Forwarded-For": []string{"172.16.0.1"}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header = tt.header
+
+			rc := newTestRequestCall(getAccessConfig(), req)
+			recorder := rc.Response.ResponseWriter.(*httptest.ResponseRecorder)
+
+			assert.Equal(t, tt.status != 0, rc.IsAccessDenied(context.Background()))
+			if tt.status != 0 {
+				assert.Equal(t, tt.status, recorder.Code)
+			}
+		})
+	}
+}
+
+func TestGetClientIP(t *testing.T) {
+	access.Store(access.NewSnapshot(getAccessConfig()))
+	defer access.Store(&access.Snapshot{})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "5.6.7.8")
+
+	rc := newTestRequestCall(getAccessConfig(), req)
+	assert.Equal(t, "5.6.7.8", rc.GetClientIP())
+	assert.Equal(t, "10.0.0.1", rc.GetRemoteIP())
+
+	req.RemoteAddr = "1.2.3.4:1234"
+
+	rc = newTestRequestCall(getAccessConfig(), req)
+	assert.Equal(t, "1.2.3.4", rc.GetClientIP())
+}
+
+func TestIPHashUsesClientIP(t *testing.T) {
+	conf := getAccessConfig()
+	conf.Server.TrustedProxies = []string{"10.0.0.0/8"}
+	conf.Server.Upstream.BalancingAlgorithm = "ip-hash"
+	conf.Server.Upstream.Endpoints = []string{"server1", "server2", "server3", "server4"}
+
+	access.Store(access.NewSnapshot(conf))
+	defer access.Store(&access.Snapshot{})
+
+	balancer.InitIpHash(conf.Server.Upstream.GetDomainID(), conf.Server.Upstream, false)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "5.6.7.8")
+
+	endpoint := newTestRequestCall(conf, req).GetUpstreamNode()
+
+	// Same client through another proxy, and another path.
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/%d", i), nil)
+		req.RemoteAddr = fmt.Sprintf("10.0.0.%d:1234", i+2)
+		req.Header.Set("X-Forwarded-For", "5.6.7.8")
+
+		rc := newTestRequestCall(conf, req)
+		assert.Equal(t, endpoint, rc.GetUpstreamNode())
+	}
+}
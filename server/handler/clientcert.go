@@ -0,0 +1,146 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/logger"
+	"github.com/fabiocicerchia/go-proxy-cache/server/cache"
+	srvtls "github.com/fabiocicerchia/go-proxy-cache/server/tls"
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry"
+)
+
+// Headers sent to the upstream, carrying the client certificate's details.
+const (
+	ClientCertVerifyHeader      = "X-Client-Cert-Verify"
+	ClientCertSubjectHeader     = "X-Client-Cert-Subject"
+	ClientCertSANHeader         = "X-Client-Cert-San"
+	ClientCertFingerprintHeader = "X-Client-Cert-Fingerprint"
+)
+
+// Client certificate verification results.
+const (
+	ClientCertSuccess = "SUCCESS"
+	ClientCertFailed  = "FAILED"
+	ClientCertNone    = "NONE"
+)
+
+// getClientCert - Verifies the client certificate against the domain's CAs,
+// returning the result and the verified certificate.
+// The listeners are shared by the domains: the handshake could have been
+// verified for another domain (by SNI), so it's always checked again.
+func (rc RequestCall) getClientCert() (string, *x509.Certificate) {
+	if rc.Request.TLS == nil || len(rc.Request.TLS.PeerCertificates) == 0 {
+		return ClientCertNone, nil
+	}
+
+	verifier, err := srvtls.GetClientVerifier(rc.DomainConfig.Server.TLS.ClientAuth)
+	if err != nil {
+		rc.GetLogger().Errorf("Cannot load the client certificates CAs: %s", err)
+
+		return ClientCertFailed, nil
+	}
+
+	if err := verifier.Verify(rc.Request.TLS.PeerCertificates); err != nil {
+		rc.GetLogger().Debugf("Client certificate not valid: %s", err)
+
+		return ClientCertFailed, nil
+	}
+
+	return ClientCertSuccess, rc.Request.TLS.PeerCertificates[0]
+}
+
+// IsClientCertDenied - Enforces the domain's client certificates mode, when
+// denied a 403 is sent.
+func (rc RequestCall) IsClientCertDenied(ctx context.Context) bool {
+	clientAuth := rc.DomainConfig.Server.TLS.ClientAuth
+	if !clientAuth.IsEnabled() || clientAuth.Mode == config.ClientAuthOptional {
+		return false
+	}
+
+	status, _ := rc.getClientCert()
+	if status == ClientCertSuccess || (status == ClientCertNone && clientAuth.Mode == config.ClientAuthVerifyIfGiven) {
+		return false
+	}
+
+	rc.GetLogger().Warnf("Client certificate required (result: %s, remote address: %s)", status, rc.GetRemoteIP())
+
+	rc.Response.ForceWriteHeader(http.StatusForbidden)
+	_ = rc.Response.WriteBody(http.StatusText(http.StatusForbidden) + "\n")
+
+	telemetry.From(ctx).RegisterStatusCode(http.StatusForbidden)
+
+	if enableLoggingRequest {
+		logger.LogRequest(rc.Request, http.StatusForbidden, 0, rc.ReqID, cache.StatusNA)
+	}
+
+	return true
+}
+
+// applyClientCertHeaders - Drops the client-supplied copies of the client
+// certificate headers (always, the upstream could trust them), then sets the
+// verification result (and the certificate's details, when verified).
+func (rc RequestCall) applyClientCertHeaders(req *http.Request) {
+	req.Header.Del(ClientCertVerifyHeader)
+	req.Header.Del(ClientCertSubjectHeader)
+	req.Header.Del(ClientCertSANHeader)
+	req.Header.Del(ClientCertFingerprintHeader)
+
+	if !rc.DomainConfig.Server.TLS.ClientAuth.IsEnabled() {
+		return
+	}
+
+	status, cert := rc.getClientCert()
+	req.Header.Set(ClientCertVerifyHeader, status)
+
+	if cert == nil {
+		return
+	}
+
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	req.Header.Set(ClientCertSubjectHeader, cert.Subject.String())
+	req.Header.Set(ClientCertFingerprintHeader, hex.EncodeToString(fingerprint[:]))
+
+	if san := getSubjectAltNames(cert); san != "" {
+		req.Header.Set(ClientCertSANHeader, san)
+	}
+}
+
+// getSubjectAltNames - Returns the SANs (comma-separated) with their type, e.g.
+// "DNS:example.com, email:user@example.com".
+func getSubjectAltNames(cert *x509.Certificate) string {
+	names := []string{}
+
+	for _, v := range cert.DNSNames {
+		names = append(names, "DNS:"+v)
+	}
+
+	for _, v := range cert.EmailAddresses {
+		names = append(names, "email:"+v)
+	}
+
+	for _, v := range cert.IPAddresses {
+		names = append(names, "IP:"+v.String())
+	}
+
+	for _, v := range cert.URIs {
+		names = append(names, "URI:"+v.String())
+	}
+
+	return strings.Join(names, ", ")
+}
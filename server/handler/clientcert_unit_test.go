@@ -0,0 +1,155 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+// newTestClientCert - Returns a CA bundle file and a client certificate
+// issued by it.
+func newTestClientCert(t *testing.T) (string, *x509.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(1 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	assert.Nil(t, err)
+
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(2),
+		Subject:        pkix.Name{CommonName: "partner", Organization: []string{"ACME"}},
+		NotBefore:      time.Now().Add(-1 * time.Hour),
+		NotAfter:       time.Now().Add(1 * time.Hour),
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		DNSNames:       []string{"partner.example.com"},
+		EmailAddresses: []string{"ops@example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	assert.Nil(t, err)
+
+	cert, _ := x509.ParseCertificate(der)
+
+	file := filepath.Join(t.TempDir(), "ca.pem")
+	assert.Nil(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o600))
+
+	return file, cert
+}
+
+func TestApplyClientCertHeaders(t *testing.T) {
+	caFile, cert := newTestClientCert(t)
+	_, otherCert := newTestClientCert(t)
+
+	tests := []struct {
+		name    string
+		mode    string
+		certs   []*x509.Certificate
+		verify  string
+		subject string
+	}{
+		{"verified", config.ClientAuthRequire, []*x509.Certificate{cert}, ClientCertSuccess, "CN=partner,O=ACME"},
+		{"not verified", config.ClientAuthOptional, []*x509.Certificate{otherCert}, ClientCertFailed, ""},
+		{"not sent", config.ClientAuthOptional, nil, ClientCertNone, ""},
+		// The client-supplied copies are dropped anyway.
+		{"disabled", "", []*x509.Certificate{cert}, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "https://example.com/", nil)
+			req.Header.Set(ClientCertSubjectHeader, "CN=spoofed")
+			req.Header.Set(ClientCertVerifyHeader, ClientCertSuccess)
+			req.TLS = &tls.ConnectionState{PeerCertificates: tt.certs}
+
+			rc := newTestRequestCall(config.Configuration{
+				Server: config.Server{TLS: config.TLS{ClientAuth: config.ClientAuth{Mode: tt.mode, CAFile: caFile}}},
+			}, req)
+
+			upstreamReq := rc.Request.Clone(rc.Request.Context())
+			rc.applyClientCertHeaders(upstreamReq)
+
+			assert.Equal(t, tt.verify, upstreamReq.Header.Get(ClientCertVerifyHeader))
+			assert.Equal(t, tt.subject, upstreamReq.Header.Get(ClientCertSubjectHeader))
+
+			if tt.verify == ClientCertSuccess {
+				assert.Equal(t, "DNS:partner.example.com, email:ops@example.com", upstreamReq.Header.Get(ClientCertSANHeader))
+				assert.Regexp(t, "^[0-9a-f]{64}$", upstreamReq.Header.Get(ClientCertFingerprintHeader))
+			}
+		})
+	}
+}
+
+func TestIsClientCertDenied(t *testing.T) {
+	caFile, cert := newTestClientCert(t)
+	_, otherCert := newTestClientCert(t)
+
+	tests := []struct {
+		mode   string
+		certs  []*x509.Certificate
+		denied bool
+	}{
+		{config.ClientAuthRequire, []*x509.Certificate{cert}, false},
+		{config.ClientAuthRequire, nil, true},
+		{config.ClientAuthRequire, []*x509.Certificate{otherCert}, true},
+		{config.ClientAuthVerifyIfGiven, nil, false},
+		{config.ClientAuthVerifyIfGiven, []*x509.Certificate{otherCert}, true},
+		{config.ClientAuthOptional, []*x509.Certificate{otherCert}, false},
+		{"", nil, false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "https://example.com/", nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: tt.certs}
+
+		rc := newTestRequestCall(config.Configuration{
+			Server: config.Server{TLS: config.TLS{ClientAuth: config.ClientAuth{Mode: tt.mode, CAFile: caFile}}},
+		}, req)
+
+		assert.Equal(t, tt.denied, rc.IsClientCertDenied(context.Background()), tt.mode)
+
+		if tt.denied {
+			assert.Equal(t, http.StatusForbidden, rc.Response.StatusCode)
+		}
+	}
+}
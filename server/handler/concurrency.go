@@ -0,0 +1,38 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/fabiocicerchia/go-proxy-cache/server/cache"
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry"
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry/metrics"
+)
+
+// shedRequest - The upstream is overloaded: serves the cached copy, even when
+// stale, or a 503 when there's none.
+func (rc RequestCall) shedRequest(ctx context.Context, err error) {
+	rc.GetLogger().Warnf("Shedding request to %s: %s", rc.GetBalancerID(), err)
+
+	// The cache has been bypassed (or the copy has been stored meanwhile).
+	if enableCachedResponse && rc.serveCachedContent(ctx) != cache.StatusMiss {
+		metrics.IncConcurrencyShed(rc.GetHostname(), rc.GetBalancerID(), "cached")
+		return
+	}
+
+	metrics.IncConcurrencyShed(rc.GetHostname(), rc.GetBalancerID(), "unavailable")
+
+	rc.Response.ForceWriteHeader(http.StatusServiceUnavailable)
+	_ = rc.Response.WriteBody(http.StatusText(http.StatusServiceUnavailable) + "\n")
+
+	telemetry.From(ctx).RegisterStatusCode(http.StatusServiceUnavailable)
+}
@@ -0,0 +1,92 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/concurrency"
+)
+
+func TestShedRequestWithoutCachedCopy(t *testing.T) {
+	rc := newTestRequestCall(config.Configuration{
+		Server: config.Server{
+			Upstream: config.Upstream{
+				Host:   "concurrency.example.com",
+				Scheme: "http",
+			},
+		},
+	}, httptest.NewRequest("GET", "http://concurrency.example.com/", nil))
+	recorder := rc.Response.ResponseWriter.(*httptest.ResponseRecorder)
+
+	rc.shedRequest(context.Background(), concurrency.ErrQueueFull)
+
+	assert.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	assert.Equal(t, "Service Unavailable\n", recorder.Body.String())
+}
+
+func TestGetProxyTransportIsShared(t *testing.T) {
+	rc := RequestCall{
+		DomainConfig: config.Configuration{
+			Server: config.Server{
+				Upstream: config.Upstream{
+					Host:        "transport.example.com",
+					Scheme:      "http",
+					Concurrency: config.Concurrency{MaxConnsPerHost: 10},
+				},
+			},
+		},
+	}
+
+	transport, err := rc.getProxyTransport()
+	assert.Nil(t, err)
+	assert.Equal(t, 10, transport.MaxConnsPerHost)
+
+	shared, _ := rc.getProxyTransport()
+	assert.Same(t, transport, shared)
+
+	rc.DomainConfig.Server.Upstream.Host = "another.example.com"
+	rc.DomainConfig.Server.Upstream.Concurrency.MaxConnsPerHost = 0
+
+	transport, err = rc.getProxyTransport()
+	assert.Nil(t, err)
+	assert.Equal(t, DefaultTransportMaxConnsPerHost, transport.MaxConnsPerHost)
+}
+
+func TestGetProxyTransportUpstreamTLSError(t *testing.T) {
+	rc := RequestCall{
+		DomainConfig: config.Configuration{
+			Server: config.Server{
+				Upstream: config.Upstream{
+					Host:   "broken-tls.example.com",
+					Scheme: "https",
+					TLS:    config.UpstreamTLS{CAFile: filepath.Join(t.TempDir(), "missing.pem")},
+				},
+			},
+		},
+	}
+
+	_, err := rc.getProxyTransport()
+	assert.NotNil(t, err)
+
+	// Never stored, so it's retried on the next request.
+	_, ok := transports.Load(rc.GetBalancerID())
+	assert.False(t, ok)
+}
@@ -15,7 +15,6 @@ import (
 
 	"github.com/fabiocicerchia/go-proxy-cache/telemetry"
 	"github.com/go-http-utils/fresh"
-	"github.com/yhat/wsutil"
 )
 
 // HttpVersion2 - The value for the HTTP/2 protocol.
@@ -26,8 +25,9 @@ func (rc RequestCall) GetResponseWithETag(ctx context.Context, proxy *httputil.R
 	// Start buffering the response.
 	proxy.ServeHTTP(rc.Response, &rc.Request)
 
-	// ETag wrapper doesn't work well with WebSocket and HTTP/2.
-	if wsutil.IsWebSocketRequest(&rc.Request) || rc.Request.ProtoMajor == HttpVersion2 {
+	// ETag wrapper doesn't work well with WebSocket and HTTP/2 (and HTTP/3),
+	// nor with the streams (already sent).
+	if rc.IsWebSocket() || rc.Request.ProtoMajor >= HttpVersion2 || rc.Response.IsStreaming() {
 		telemetry.From(ctx).RegisterEvent("request.etag.not_supported")
 		rc.GetLogger().Info("Current request doesn't support ETag.")
 
@@ -0,0 +1,114 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/logger"
+	"github.com/fabiocicerchia/go-proxy-cache/server/cache"
+	"github.com/fabiocicerchia/go-proxy-cache/server/forwardauth"
+	"github.com/fabiocicerchia/go-proxy-cache/server/transport"
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry"
+)
+
+// getForwardAuth - Returns the forward auth of the location (or domain).
+func (rc RequestCall) getForwardAuth() config.ForwardAuth {
+	if rc.Location != nil && rc.Location.ForwardAuth.IsEnabled() {
+		return rc.Location.ForwardAuth
+	}
+
+	return rc.DomainConfig.Server.ForwardAuth
+}
+
+// getForwardAuthCachePartition - The responses personalised by the forward
+// auth are cached per user: identified by the headers copied from the auth
+// response or, without them, by the credentials.
+func (rc RequestCall) getForwardAuthCachePartition() string {
+	forwardAuth := rc.getForwardAuth()
+	if !forwardAuth.IsEnabled() {
+		return ""
+	}
+
+	headers := forwardAuth.ResponseHeaders
+	if len(headers) == 0 {
+		headers = forwardauth.GetRequestHeaders(forwardAuth)
+	}
+
+	sum := sha256.New()
+	for _, h := range headers {
+		for _, v := range rc.Request.Header.Values(h) {
+			_, _ = sum.Write([]byte(http.CanonicalHeaderKey(h) + ": " + v + "\n"))
+		}
+	}
+
+	return "fwd:" + hex.EncodeToString(sum.Sum(nil))
+}
+
+// IsForwardAuthDenied - Sends the subrequest to the auth endpoint, when
+// allowed its selected headers are copied to the upstream request, otherwise
+// its response is sent to the client.
+func (rc *RequestCall) IsForwardAuthDenied(ctx context.Context) bool {
+	forwardAuth := rc.getForwardAuth()
+	if !forwardAuth.IsEnabled() {
+		return false
+	}
+
+	res, err := forwardauth.Check(ctx, forwardAuth, &rc.Request, rc.GetScheme(), rc.GetClientIP())
+	if err != nil {
+		rc.GetLogger().Errorf("Forward auth failed: %s", err)
+
+		res = forwardauth.Result{
+			StatusCode: http.StatusInternalServerError,
+			Body:       []byte(http.StatusText(http.StatusInternalServerError) + "\n"),
+		}
+	}
+
+	if res.IsAllowed() {
+		// Never trust the client's copy of the auth headers.
+		for _, h := range forwardAuth.ResponseHeaders {
+			rc.Request.Header.Del(h)
+
+			for _, v := range res.Header.Values(h) {
+				rc.Request.Header.Add(h, v)
+			}
+		}
+
+		return false
+	}
+
+	rc.GetLogger().Warnf("Forward auth denied the request with status %d", res.StatusCode)
+
+	header := res.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	for _, h := range transport.HopHeaders {
+		header.Del(h)
+	}
+	header.Del("Content-Length")
+
+	rc.Response.CopyHeaders(header)
+	rc.Response.ForceWriteHeader(res.StatusCode)
+	_, _ = rc.Response.ForceWrite(res.Body)
+
+	telemetry.From(ctx).RegisterStatusCode(res.StatusCode)
+
+	if enableLoggingRequest {
+		logger.LogRequest(rc.Request, res.StatusCode, len(res.Body), rc.ReqID, cache.StatusNA)
+	}
+
+	return true
+}
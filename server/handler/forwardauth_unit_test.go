@@ -0,0 +1,154 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+func getForwardAuthConfig(address string) config.Configuration {
+	conf := config.Configuration{}
+	conf.CopyOverWith(config.Configuration{
+		Server: config.Server{
+			Upstream: config.Upstream{
+				Host:   "auth.example.com",
+				Scheme: "http",
+			},
+			ForwardAuth: config.ForwardAuth{
+				Address:         address,
+				ResponseHeaders: []string{"X-Auth-User"},
+			},
+			Locations: config.Locations{
+				{
+					Prefix: "/admin",
+					ForwardAuth: config.ForwardAuth{
+						Address: address + "/admin",
+					},
+				},
+			},
+		},
+	}, nil)
+
+	return conf
+}
+
+func TestIsForwardAuthDenied(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/admin" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer valid" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("invalid token"))
+
+			return
+		}
+
+		w.Header().Set("X-Auth-User", "john")
+	}))
+	defer srv.Close()
+
+	t.Run("disabled", func(t *testing.T) {
+		rc := newTestRequestCall(getForwardAuthConfig(""), httptest.NewRequest("GET", "/", nil))
+		assert.False(t, rc.IsForwardAuthDenied(context.Background()))
+	})
+
+	t.Run("allowed", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer valid")
+		req.Header.Set("X-Auth-User", "admin")
+
+		rc := newTestRequestCall(getForwardAuthConfig(srv.URL), req)
+		assert.False(t, rc.IsForwardAuthDenied(context.Background()))
+		assert.Equal(t, []string{"john"}, rc.Request.Header.Values("X-Auth-User"))
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer invalid")
+
+		rc := newTestRequestCall(getForwardAuthConfig(srv.URL), req)
+		recorder := rc.Response.ResponseWriter.(*httptest.ResponseRecorder)
+
+		assert.True(t, rc.IsForwardAuthDenied(context.Background()))
+		assert.Equal(t, http.StatusUnauthorized, recorder.Code)
+		assert.Equal(t, "Bearer", recorder.Header().Get("WWW-Authenticate"))
+		assert.Equal(t, "invalid token", recorder.Body.String())
+	})
+
+	t.Run("location replaces domain", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/admin", nil)
+		req.Header.Set("Authorization", "Bearer valid")
+
+		rc := newTestRequestCall(getForwardAuthConfig(srv.URL), req)
+		recorder := rc.Response.ResponseWriter.(*httptest.ResponseRecorder)
+
+		assert.True(t, rc.IsForwardAuthDenied(context.Background()))
+		assert.Equal(t, http.StatusForbidden, recorder.Code)
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Authorization", "Bearer valid")
+
+		rc := newTestRequestCall(getForwardAuthConfig("http://127.0.0.1:1"), req)
+		recorder := rc.Response.ResponseWriter.(*httptest.ResponseRecorder)
+
+		assert.True(t, rc.IsForwardAuthDenied(context.Background()))
+		assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+	})
+}
+
+func TestGetCachePartitionForwardAuth(t *testing.T) {
+	newRequest := func(user string) *http.Request {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Auth-User", user)
+
+		return req
+	}
+
+	partition, cacheable := newTestRequestCall(getForwardAuthConfig(""), newRequest("john")).getCachePartition()
+	assert.True(t, cacheable)
+	assert.Empty(t, partition)
+
+	conf := getForwardAuthConfig("http://auth.example.com")
+
+	partition1, cacheable := newTestRequestCall(conf, newRequest("john")).getCachePartition()
+	assert.True(t, cacheable)
+	assert.Regexp(t, "^fwd:[0-9a-f]{64}$", partition1)
+
+	partition2, _ := newTestRequestCall(conf, newRequest("jane")).getCachePartition()
+	assert.NotEqual(t, partition1, partition2)
+
+	// Without response headers, by credentials.
+	conf.Server.ForwardAuth.ResponseHeaders = nil
+
+	req1 := httptest.NewRequest("GET", "/", nil)
+	req1.Header.Set("Authorization", "Bearer token1")
+	req2 := httptest.NewRequest("GET", "/", nil)
+	req2.Header.Set("Authorization", "Bearer token2")
+
+	partition1, _ = newTestRequestCall(conf, req1).getCachePartition()
+	partition2, _ = newTestRequestCall(conf, req2).getCachePartition()
+	assert.NotEqual(t, partition1, partition2)
+}
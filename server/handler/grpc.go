@@ -0,0 +1,162 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"time"
+
+	"github.com/fabiocicerchia/go-proxy-cache/logger"
+	"github.com/fabiocicerchia/go-proxy-cache/server/balancer"
+	"github.com/fabiocicerchia/go-proxy-cache/server/cache"
+	"github.com/fabiocicerchia/go-proxy-cache/server/concurrency"
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry"
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry/metrics"
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry/tracing"
+)
+
+// GRPCContentType - Content type of the gRPC calls (gRPC-Web excluded).
+const GRPCContentType = "application/grpc"
+
+// GRPCStatusHeader - Status of the gRPC call, sent as trailer (or header
+// when there's no response body).
+const GRPCStatusHeader = "Grpc-Status"
+
+// IsGRPCRequest - Checks whether the request is a gRPC call, e.g. with
+// content type application/grpc or application/grpc+proto.
+func IsGRPCRequest(req *http.Request) bool {
+	contentType := req.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, GRPCContentType) {
+		return false
+	}
+
+	suffix := contentType[len(GRPCContentType):]
+
+	return suffix == "" || suffix[0] == '+' || suffix[0] == ';'
+}
+
+// IsGRPC - Checks whether the current request is a gRPC call.
+func (rc RequestCall) IsGRPC() bool {
+	return IsGRPCRequest(&rc.Request)
+}
+
+// getGRPCStatus - Returns the status of the gRPC call, from the trailers (or
+// the headers, on the trailers-only responses). It must be called after the
+// response body has been read.
+func getGRPCStatus(res *http.Response) string {
+	if status := res.Trailer.Get(GRPCStatusHeader); status != "" {
+		return status
+	}
+
+	return res.Header.Get(GRPCStatusHeader)
+}
+
+// HandleGRPCRequestAndProxy - Proxies the gRPC calls to backend server: the
+// messages are streamed (never buffered nor cached) and the trailers are
+// forwarded.
+func (rc RequestCall) HandleGRPCRequestAndProxy(ctx context.Context) {
+	tracingSpan := tracing.NewChildSpan(ctx, "handler.handle_grpc_request_and_proxy")
+	defer tracingSpan.End()
+
+	endpoint := rc.GetUpstreamNode()
+	proxyURL, err := rc.getUpstreamURLForNode(endpoint)
+	if err != nil {
+		tracing.SetErrorAndFail(tracingSpan, err, "internal error")
+
+		rc.GetLogger().Errorf("Cannot process Upstream URL: %s", err.Error())
+		return
+	}
+
+	proxyTransport, err := rc.getProxyTransport()
+	if err != nil {
+		tracing.SetErrorAndFail(tracingSpan, err, "internal error")
+
+		rc.GetLogger().Errorf("Cannot load the upstream TLS configuration: %s", err)
+		rc.SendBadGateway(ctx)
+		return
+	}
+
+	balancerID := rc.GetBalancerID()
+
+	release, err := concurrency.Acquire(ctx, balancerID, endpoint)
+	if err != nil {
+		tracing.AddErrorToSpan(tracingSpan, err)
+
+		rc.shedRequest(ctx, err)
+		return
+	}
+	defer release()
+
+	telemetry.From(ctx).RegisterRequestUpstream(proxyURL, false, cache.StatusLabel[cache.StatusNA])
+
+	proxy := httputil.NewSingleHostReverseProxy(&proxyURL)
+	proxy.Transport = proxyTransport
+	// Every message is sent right away.
+	proxy.FlushInterval = -1
+
+	originalDirector := proxy.Director
+	gpcDirector := rc.ProxyDirector(ctx)
+	proxy.Director = func(req *http.Request) {
+		originalDirector(req)
+		gpcDirector(req)
+	}
+
+	var upstreamRes *http.Response
+	proxy.ModifyResponse = func(res *http.Response) error {
+		upstreamRes = res
+		rc.Response.StatusCode = res.StatusCode
+		rc.applyResponseHeaderRules(res.Header)
+
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		rc.GetLogger().Errorf("gRPC call to %s failed: %s", proxyURL.Host, err)
+
+		rc.Response.StatusCode = http.StatusBadGateway
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	var responseTime time.Duration
+
+	balancer.RequestStarted(balancerID, endpoint)
+	// Released even when the proxy panics (e.g. the client went away).
+	defer func() {
+		if responseTime == 0 {
+			responseTime = time.Since(rc.RequestTime)
+		}
+
+		balancer.RequestDone(balancerID, endpoint, responseTime)
+	}()
+
+	// Straight to the client, bypassing the buffering of the response.
+	proxy.ServeHTTP(rc.Response.ResponseWriter, &rc.Request)
+
+	responseTime = time.Since(rc.RequestTime)
+
+	telemetry.From(ctx).RegisterStatusCode(rc.Response.StatusCode)
+
+	if upstreamRes != nil {
+		status := getGRPCStatus(upstreamRes)
+		if status == "" {
+			status = "unknown"
+		}
+
+		metrics.IncGRPCStatus(rc.GetHostname(), rc.GetUpstreamHost(), status)
+		metrics.IncUpstreamServerResponses(rc.Response.StatusCode, rc.GetHostname(), rc.GetUpstreamHost())
+		metrics.IncUpstreamServerResponseTime(rc.GetHostname(), rc.GetUpstreamHost(), float64(responseTime.Milliseconds()))
+	}
+
+	if enableLoggingRequest {
+		logger.LogRequest(rc.Request, rc.Response.StatusCode, 0, rc.ReqID, cache.StatusNA)
+	}
+}
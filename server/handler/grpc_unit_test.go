@@ -0,0 +1,121 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/balancer"
+)
+
+func TestIsGRPCRequest(t *testing.T) {
+	for contentType, expected := range map[string]bool{
+		"application/grpc":                true,
+		"application/grpc+proto":          true,
+		"application/grpc; charset=utf-8": true,
+		"application/grpc-web":            false,
+		"application/grpc-web-text":       false,
+		"application/json":                false,
+		"":                                false,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+		req.Header.Set("Content-Type", contentType)
+
+		assert.Equal(t, expected, IsGRPCRequest(req), contentType)
+	}
+}
+
+func TestGetUpstreamProtocols(t *testing.T) {
+	protocols := getUpstreamProtocols("")
+	assert.True(t, protocols.HTTP1())
+	assert.False(t, protocols.HTTP2())
+
+	protocols = getUpstreamProtocols(config.UpstreamProtocolH2)
+	assert.True(t, protocols.HTTP1())
+	assert.True(t, protocols.HTTP2())
+	assert.False(t, protocols.UnencryptedHTTP2())
+
+	protocols = getUpstreamProtocols(config.UpstreamProtocolH2C)
+	assert.False(t, protocols.HTTP1())
+	assert.True(t, protocols.UnencryptedHTTP2())
+}
+
+func TestGRPCIsNotCacheable(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/pkg.Service/Method", nil)
+	req.Header.Set("Content-Type", "application/grpc")
+
+	_, cacheable := NewRequestCall(httptest.NewRecorder(), req).getCachePartition()
+	assert.False(t, cacheable)
+}
+
+func TestHandleGRPCRequestAndProxyOverH2C(t *testing.T) {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.Header().Set("X-Proto", r.Proto)
+		w.WriteHeader(http.StatusOK)
+
+		_, _ = w.Write(body)
+		w.(http.Flusher).Flush()
+
+		w.Header().Set("Grpc-Status", "5")
+		w.Header().Set("Grpc-Message", "not found")
+	}))
+	upstream.Config.Protocols = &http.Protocols{}
+	upstream.Config.Protocols.SetHTTP1(true)
+	upstream.Config.Protocols.SetUnencryptedHTTP2(true)
+	upstream.Start()
+	defer upstream.Close()
+
+	endpoint := strings.TrimPrefix(upstream.URL, "http://")
+	upstreamConfig := config.Upstream{
+		Host:      "grpc.example.com",
+		Scheme:    "http",
+		Endpoints: []string{endpoint},
+		Protocol:  config.UpstreamProtocolH2C,
+	}
+	balancer.InitRoundRobin(upstreamConfig.GetDomainID(), upstreamConfig, false)
+
+	req := httptest.NewRequest(http.MethodPost, "http://grpc.example.com/pkg.Service/Method", strings.NewReader("message"))
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+
+	recorder := httptest.NewRecorder()
+	rc := NewRequestCall(recorder, req)
+	rc.DomainConfig = config.Configuration{Server: config.Server{Upstream: upstreamConfig}}
+
+	rc.HandleGRPCRequestAndProxy(context.Background())
+
+	res := recorder.Result()
+	body, _ := io.ReadAll(res.Body)
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, http.StatusOK, rc.Response.StatusCode)
+	assert.Equal(t, "HTTP/2.0", res.Header.Get("X-Proto"))
+	assert.Equal(t, "message", string(body))
+	assert.Equal(t, "5", res.Trailer.Get("Grpc-Status"))
+	assert.Equal(t, "not found", res.Trailer.Get("Grpc-Message"))
+
+	// Nothing has been buffered.
+	assert.Equal(t, 0, rc.Response.Content.Len())
+}
@@ -46,6 +46,8 @@ func HandleRequest(res http.ResponseWriter, req *http.Request) {
 
 	telemetry.From(ctx).RegisterRequestCall(rc.ReqID, rc.Request, rc.GetRequestURL(), rc.GetScheme(), rc.IsWebSocket())
 
+	rc.setAltSvcHeader()
+
 	if rc.Request.Method == http.MethodConnect {
 		if enableLoggingRequest {
 			logger.LogRequest(rc.Request, rc.Response.StatusCode, rc.Response.Content.Len(), rc.ReqID, cache.StatusNA)
@@ -56,18 +58,47 @@ func HandleRequest(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if rc.IsAccessDenied(ctx) {
+		return
+	}
+
 	if rc.GetScheme() == SchemeHTTP && rc.DomainConfig.Server.Upstream.HTTP2HTTPS {
 		rc.RedirectToHTTPS(ctx)
 		return
 	}
 
+	if rc.IsClientCertDenied(ctx) {
+		return
+	}
+
+	if rc.IsRateLimited(ctx) {
+		return
+	}
+
 	if rc.Request.Method == HttpMethodPurge {
 		rc.HandlePurge(ctx)
 		return
 	}
 
+	if rc.IsForwardAuthDenied(ctx) {
+		return
+	}
+
+	// The HTTP requests are redirected through the cache.
+	if rc.Redirect != nil && (rc.IsWebSocket() || rc.IsGRPC()) {
+		rc.serveRedirect(ctx)
+
+		if enableLoggingRequest {
+			logger.LogRequest(rc.Request, rc.Response.StatusCode, rc.Response.Content.Len(), rc.ReqID, cache.StatusNA)
+		}
+
+		return
+	}
+
 	if rc.IsWebSocket() {
 		rc.HandleWSRequestAndProxy(ctx)
+	} else if rc.IsGRPC() {
+		rc.HandleGRPCRequestAndProxy(ctx)
 	} else {
 		rc.HandleHTTPRequestAndProxy(ctx)
 	}
@@ -100,5 +131,12 @@ func initRequestParams(ctx context.Context, res http.ResponseWriter, req *http.R
 		return RequestCall{}, fmt.Errorf("Request for %s (listening on :%s) is not allowed (mostly likely it's a configuration mismatch).", rc.Request.Host, listeningPort)
 	}
 
+	rc.applyRewrites()
+	rc.applyLocation()
+
+	if clientIP := rc.GetClientIP(); clientIP != rc.GetRemoteIP() {
+		rc.Request = *logger.WithClientIP(&rc.Request, clientIP)
+	}
+
 	return rc, nil
 }
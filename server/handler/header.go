@@ -0,0 +1,107 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/response"
+)
+
+// getHeaderVariables - Returns the variables available in the header rules values.
+func (rc RequestCall) getHeaderVariables() map[string]string {
+	location := ""
+	if rc.Location != nil {
+		location = rc.Location.Name
+	}
+
+	return map[string]string{
+		"$cache_status":   rc.Response.Header().Get(response.CacheStatusHeader),
+		"$client_ip":      rc.GetClientIP(),
+		"$host":           rc.GetHostname(),
+		"$location":       location,
+		"$request_id":     rc.ReqID,
+		"$request_method": rc.Request.Method,
+		"$request_uri":    rc.Request.URL.RequestURI(),
+		"$scheme":         rc.GetScheme(),
+	}
+}
+
+// newHeaderReplacer - When escaping, the "$" in the values is doubled so it
+// is not expanded as a regex group by the replace action.
+func newHeaderReplacer(variables map[string]string, escape bool) *strings.Replacer {
+	oldnew := make([]string, 0, len(variables)*2)
+	for k, v := range variables {
+		if escape {
+			v = strings.ReplaceAll(v, "$", "$$")
+		}
+		oldnew = append(oldnew, k, v)
+	}
+
+	return strings.NewReplacer(oldnew...)
+}
+
+// applyHeaderRules - Applies the rules, in order, to the headers.
+func applyHeaderRules(h http.Header, rules []config.HeaderRule, variables map[string]string) {
+	if len(rules) == 0 {
+		return
+	}
+
+	replacer := newHeaderReplacer(variables, false)
+
+	for _, rule := range rules {
+		switch rule.Action {
+		case config.HeaderActionAdd:
+			h.Add(rule.Name, replacer.Replace(rule.Value))
+		case config.HeaderActionSet:
+			h.Set(rule.Name, replacer.Replace(rule.Value))
+		case config.HeaderActionRemove:
+			h.Del(rule.Name)
+		case config.HeaderActionReplace:
+			pattern := rule.GetPattern()
+			values := h.Values(rule.Name)
+			if pattern == nil || len(values) == 0 {
+				continue
+			}
+
+			value := newHeaderReplacer(variables, true).Replace(rule.Value)
+
+			h.Del(rule.Name)
+			for _, v := range values {
+				h.Add(rule.Name, pattern.ReplaceAllString(v, value))
+			}
+		}
+	}
+}
+
+// getHeaderRules - Returns the domain rules followed by the location ones.
+func (rc RequestCall) getHeaderRules() config.Headers {
+	headers := rc.DomainConfig.Server.Headers
+	if rc.Location == nil {
+		return headers
+	}
+
+	return config.Headers{
+		Request:  append(append([]config.HeaderRule{}, headers.Request...), rc.Location.Headers.Request...),
+		Response: append(append([]config.HeaderRule{}, headers.Response...), rc.Location.Headers.Response...),
+	}
+}
+
+// applyRequestHeaderRules - Rewrites the headers of the upstream request.
+func (rc RequestCall) applyRequestHeaderRules(req *http.Request) {
+	applyHeaderRules(req.Header, rc.getHeaderRules().Request, rc.getHeaderVariables())
+}
+
+// applyResponseHeaderRules - Rewrites the headers sent to the client.
+func (rc RequestCall) applyResponseHeaderRules(h http.Header) {
+	applyHeaderRules(h, rc.getHeaderRules().Response, rc.getHeaderVariables())
+}
@@ -0,0 +1,107 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/response"
+)
+
+func getHeadersConfig() config.Configuration {
+	conf := config.Configuration{}
+	conf.CopyOverWith(config.Configuration{
+		Server: config.Server{
+			Headers: config.Headers{
+				Request: []config.HeaderRule{
+					{Action: config.HeaderActionSet, Name: "X-Client", Value: "$client_ip/$request_id"},
+					{Action: config.HeaderActionRemove, Name: "Cookie"},
+				},
+				Response: []config.HeaderRule{
+					{Action: config.HeaderActionAdd, Name: "X-Cache", Value: "$cache_status"},
+					{Action: config.HeaderActionRemove, Name: "Server"},
+					{Action: config.HeaderActionReplace, Name: "Location", Pattern: `^https?://backend(/.*)$`, Value: "$scheme://$host$1"},
+				},
+			},
+			Locations: config.Locations{
+				{
+					Prefix: "/api/",
+					Headers: config.Headers{
+						Response: []config.HeaderRule{
+							{Action: config.HeaderActionSet, Name: "X-Location", Value: "$location"},
+						},
+					},
+				},
+			},
+		},
+	}, nil)
+
+	return conf
+}
+
+func TestApplyRequestHeaderRules(t *testing.T) {
+	rc := newTestRequestCall(getHeadersConfig(), httptest.NewRequest("GET", "/", nil))
+	rc.ReqID = "abc"
+
+	req := &http.Request{Header: http.Header{"Cookie": []string{"a=b"}}}
+	rc.applyRequestHeaderRules(req)
+
+	assert.Equal(t, "192.0.2.1/abc", req.Header.Get("X-Client"))
+	assert.Empty(t, req.Header.Get("Cookie"))
+}
+
+func TestApplyResponseHeaderRules(t *testing.T) {
+	rc := newTestRequestCall(getHeadersConfig(), httptest.NewRequest("GET", "/", nil))
+	rc.Response.Header().Set(response.CacheStatusHeader, response.CacheStatusHeaderHit)
+
+	h := http.Header{
+		"Server":   []string{"nginx"},
+		"Location": []string{"http://backend/path?q=$1"},
+	}
+	rc.applyResponseHeaderRules(h)
+
+	assert.Equal(t, response.CacheStatusHeaderHit, h.Get("X-Cache"))
+	assert.Empty(t, h.Get("Server"))
+	assert.Equal(t, "http://example.com/path?q=$1", h.Get("Location"))
+	assert.Empty(t, h.Get("X-Location"))
+}
+
+func TestApplyResponseHeaderRulesWithLocation(t *testing.T) {
+	rc := newTestRequestCall(getHeadersConfig(), httptest.NewRequest("GET", "/api/users", nil))
+
+	h := http.Header{}
+	rc.applyResponseHeaderRules(h)
+
+	assert.Equal(t, "/api/", h.Get("X-Location"))
+	assert.Equal(t, []string{""}, h.Values("X-Cache"))
+}
+
+func TestApplyHeaderRulesEscapesVariables(t *testing.T) {
+	rules := []config.HeaderRule{
+		{Action: config.HeaderActionSet, Name: "X-Original", Value: "value"},
+	}
+	conf := config.Configuration{}
+	conf.CopyOverWith(config.Configuration{Server: config.Server{Headers: config.Headers{Response: append(rules,
+		config.HeaderRule{Action: config.HeaderActionReplace, Name: "X-Original", Pattern: "value", Value: "$request_uri"},
+	)}}}, nil)
+
+	h := http.Header{}
+	applyHeaderRules(h, conf.Server.Headers.Response, map[string]string{"$request_uri": "/$1"})
+
+	assert.Equal(t, "/$1", h.Get("X-Original"))
+}
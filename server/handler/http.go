@@ -20,7 +20,9 @@ import (
 
 	"github.com/fabiocicerchia/go-proxy-cache/config"
 	"github.com/fabiocicerchia/go-proxy-cache/logger"
+	"github.com/fabiocicerchia/go-proxy-cache/server/balancer"
 	"github.com/fabiocicerchia/go-proxy-cache/server/cache"
+	"github.com/fabiocicerchia/go-proxy-cache/server/concurrency"
 	"github.com/fabiocicerchia/go-proxy-cache/server/response"
 	"github.com/fabiocicerchia/go-proxy-cache/server/storage"
 	"github.com/fabiocicerchia/go-proxy-cache/server/transport"
@@ -68,7 +70,12 @@ func (rc RequestCall) HandleHTTPRequestAndProxy(ctx context.Context) {
 
 	if cached == cache.StatusMiss {
 		rc.Response.Header().Set(response.CacheStatusHeader, response.CacheStatusHeaderMiss)
-		rc.serveReverseProxyHTTP(ctx)
+
+		if rc.Redirect != nil {
+			rc.serveRedirect(ctx)
+		} else {
+			rc.serveReverseProxyHTTP(ctx)
+		}
 	}
 
 	if enableLoggingRequest {
@@ -78,6 +85,10 @@ func (rc RequestCall) HandleHTTPRequestAndProxy(ctx context.Context) {
 }
 
 func (rc RequestCall) serveCachedContent(ctx context.Context) int {
+	if _, cacheable := rc.getCachePartition(); !cacheable {
+		return cache.StatusMiss
+	}
+
 	tracingSpan := tracing.NewChildSpan(ctx, "handler.serve_cached_content")
 	defer tracingSpan.End()
 
@@ -101,7 +112,7 @@ func (rc RequestCall) serveCachedContent(ctx context.Context) int {
 
 	telemetry.From(ctx).RegisterWholeResponse(rc.ReqID, rc.Request, rc.Response.StatusCode, rc.Response.Content.Len(), rc.RequestTime, rc.GetScheme(), cached == cache.StatusHit, uriObj.Stale)
 
-	transport.ServeCachedResponse(rc.Request.Context(), rc.Response, uriObj)
+	transport.ServeCachedResponse(rc.Request.Context(), rc.Response, uriObj, rc.applyResponseHeaderRules)
 
 	return cached
 }
@@ -110,7 +121,8 @@ func (rc RequestCall) serveReverseProxyHTTP(ctx context.Context) {
 	tracingSpan := tracing.NewChildSpan(ctx, "handler.serve_reverse_proxy_http")
 	defer tracingSpan.End()
 
-	proxyURL, err := rc.GetUpstreamURL()
+	endpoint := rc.GetUpstreamNode()
+	proxyURL, err := rc.getUpstreamURLForNode(endpoint)
 	if err != nil {
 		tracing.SetErrorAndFail(tracingSpan, err, "internal error")
 
@@ -118,6 +130,26 @@ func (rc RequestCall) serveReverseProxyHTTP(ctx context.Context) {
 		return
 	}
 
+	proxyTransport, err := rc.getProxyTransport()
+	if err != nil {
+		tracing.SetErrorAndFail(tracingSpan, err, "internal error")
+
+		rc.GetLogger().Errorf("Cannot load the upstream TLS configuration: %s", err)
+		rc.SendBadGateway(ctx)
+		return
+	}
+
+	balancerID := rc.GetBalancerID()
+
+	release, err := concurrency.Acquire(ctx, balancerID, endpoint)
+	if err != nil {
+		tracing.AddErrorToSpan(tracingSpan, err)
+
+		rc.shedRequest(ctx, err)
+		return
+	}
+	defer release()
+
 	escapedURL := strings.Replace(rc.Request.URL.String(), "\n", "", -1)
 	escapedURL = strings.Replace(escapedURL, "\r", "", -1)
 
@@ -128,7 +160,7 @@ func (rc RequestCall) serveReverseProxyHTTP(ctx context.Context) {
 	telemetry.From(ctx).RegisterRequestUpstream(proxyURL, enableCachedResponse, cache.StatusLabel[cache.StatusMiss])
 
 	proxy := httputil.NewSingleHostReverseProxy(&proxyURL)
-	proxy.Transport = rc.patchProxyTransport()
+	proxy.Transport = proxyTransport
 
 	originalDirector := proxy.Director
 	gpcDirector := rc.ProxyDirector(ctx)
@@ -139,8 +171,37 @@ func (rc RequestCall) serveReverseProxyHTTP(ctx context.Context) {
 		gpcDirector(req)
 	}
 
+	proxy.ModifyResponse = rc.streamResponse(proxy, endpoint)
+
+	// The same timing feeds both the metrics and the latency-aware balancer.
+	var responseTime time.Duration
+
+	balancer.RequestStarted(balancerID, endpoint)
+	// Released even when the proxy panics (e.g. the client went away).
+	defer func() {
+		if responseTime == 0 {
+			responseTime = time.Since(rc.RequestTime)
+		}
+
+		balancer.RequestDone(balancerID, endpoint, responseTime)
+	}()
+
 	serveNotModified := rc.GetResponseWithETag(ctx, proxy)
+
+	responseTime = time.Since(rc.RequestTime)
+
+	// Already sent, never cached.
+	if rc.Response.IsStreaming() {
+		telemetry.From(ctx).RegisterStatusCode(rc.Response.StatusCode)
+
+		metrics.IncUpstreamServerResponses(rc.Response.StatusCode, rc.GetHostname(), rc.GetUpstreamHost())
+		metrics.IncUpstreamServerResponseTime(rc.GetHostname(), rc.GetUpstreamHost(), float64(responseTime.Milliseconds()))
+
+		return
+	}
+
 	if serveNotModified {
+		rc.applyResponseHeaderRules(rc.Response.Header())
 		rc.SendNotModifiedResponse(ctx)
 		return
 	}
@@ -149,25 +210,33 @@ func (rc RequestCall) serveReverseProxyHTTP(ctx context.Context) {
 		WrapResponseForGZip(rc.Response, &rc.Request)
 	}
 
+	// The DTO is built before any client-only header is added.
+	rcDTO := ConvertToRequestCallDTO(rc)
+
+	rc.setStickyCookie(endpoint)
+	rc.applyResponseHeaderRules(rc.Response.Header())
+
 	rc.SendResponse(ctx)
-	rc.storeResponse(ctx)
+	rc.storeResponse(ctx, rcDTO)
 
 	metrics.IncUpstreamServerResponses(rc.Response.StatusCode, rc.GetHostname(), rc.GetUpstreamHost())
 	len, _ := strconv.ParseFloat(rc.Response.Header().Get("Content-Length"), 64)
 	metrics.IncUpstreamServerSent(rc.GetHostname(), rc.GetUpstreamHost(), len)
-	metrics.IncUpstreamServerResponseTime(rc.GetHostname(), rc.GetUpstreamHost(), float64(time.Since(rc.RequestTime).Milliseconds()))
+	metrics.IncUpstreamServerResponseTime(rc.GetHostname(), rc.GetUpstreamHost(), float64(responseTime.Milliseconds()))
 }
 
-func (rc RequestCall) storeResponse(ctx context.Context) {
+func (rc RequestCall) storeResponse(ctx context.Context, rcDTO storage.RequestCallDTO) {
 	if !enableStoringResponse {
 		return
 	}
 
+	if _, cacheable := rc.getCachePartition(); !cacheable {
+		return
+	}
+
 	tracingSpan := tracing.NewChildSpan(ctx, "handler.store_response")
 	defer tracingSpan.End()
 
-	rcDTO := ConvertToRequestCallDTO(rc)
-
 	escapedURL := strings.Replace(rc.Request.URL.String(), "\n", "", -1)
 	escapedURL = strings.Replace(escapedURL, "\r", "", -1)
 
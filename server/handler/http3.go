@@ -0,0 +1,67 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+// AltSvcHeader - Announces the alternative services (e.g. HTTP/3).
+const AltSvcHeader = "Alt-Svc"
+
+// HttpVersion3 - The value for the HTTP/3 protocol.
+const HttpVersion3 = 3
+
+// getAltSvc - Returns the announcement of HTTP/3 on the HTTPS port, empty
+// when not enabled or not needed (plain HTTP or already on HTTP/3).
+func (rc RequestCall) getAltSvc() string {
+	http3 := rc.DomainConfig.Server.TLS.HTTP3
+	if !http3.Enabled || rc.Request.TLS == nil || rc.Request.ProtoMajor >= HttpVersion3 {
+		return ""
+	}
+
+	maxAge := http3.AltSvcMaxAge
+	if maxAge <= 0 {
+		maxAge = config.DefaultHTTP3AltSvcMaxAge
+	}
+
+	return fmt.Sprintf(`h3=":%s"; ma=%d`, rc.DomainConfig.Server.Port.HTTPS, int64(maxAge.Seconds()))
+}
+
+// setAltSvcHeader - Announces HTTP/3 to the client.
+func (rc RequestCall) setAltSvcHeader() {
+	if altSvc := rc.getAltSvc(); altSvc != "" {
+		rc.Response.Header().Add(AltSvcHeader, altSvc)
+	}
+}
+
+// removeAltSvcHeader - Removes the announcement of HTTP/3 (keeping the
+// upstream's ones), as it depends on the request and must not be cached.
+func (rc RequestCall) removeAltSvcHeader(h http.Header) {
+	altSvc := rc.getAltSvc()
+	if altSvc == "" {
+		return
+	}
+
+	values := []string{}
+	for _, v := range h.Values(AltSvcHeader) {
+		if v != altSvc {
+			values = append(values, v)
+		}
+	}
+
+	h.Del(AltSvcHeader)
+	for _, v := range values {
+		h.Add(AltSvcHeader, v)
+	}
+}
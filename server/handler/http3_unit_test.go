@@ -0,0 +1,95 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+func TestGetAltSvc(t *testing.T) {
+	enabled := config.HTTP3{Enabled: true, AltSvcMaxAge: time.Hour}
+
+	tests := []struct {
+		name       string
+		http3      config.HTTP3
+		protoMajor int
+		tlsState   *tls.ConnectionState
+		expected   string
+	}{
+		{"http/1.1", enabled, 1, &tls.ConnectionState{}, `h3=":8443"; ma=3600`},
+		{"http/2", enabled, 2, &tls.ConnectionState{}, `h3=":8443"; ma=3600`},
+		{"default max age", config.HTTP3{Enabled: true}, 2, &tls.ConnectionState{}, `h3=":8443"; ma=86400`},
+		{"not enabled", config.HTTP3{}, 2, &tls.ConnectionState{}, ""},
+		{"plain http", enabled, 1, nil, ""},
+		{"already on http/3", enabled, 3, &tls.ConnectionState{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+			req.ProtoMajor = tt.protoMajor
+			req.TLS = tt.tlsState
+
+			rc := newTestRequestCall(config.Configuration{
+				Server: config.Server{
+					Port: config.Port{HTTP: "80", HTTPS: "8443"},
+					TLS:  config.TLS{HTTP3: tt.http3},
+				},
+			}, req)
+
+			assert.Equal(t, tt.expected, rc.getAltSvc())
+		})
+	}
+}
+
+func TestAltSvcHeaderIsNotCached(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	req.ProtoMajor = 2
+
+	rc := newTestRequestCall(config.Configuration{
+		Server: config.Server{
+			Port: config.Port{HTTP: "80", HTTPS: "8443"},
+			TLS:  config.TLS{HTTP3: config.HTTP3{Enabled: true, AltSvcMaxAge: time.Hour}},
+		},
+	}, req)
+
+	rc.setAltSvcHeader()
+	rc.Response.Header().Add(AltSvcHeader, `h3=":443"; ma=60`) // from the upstream
+
+	assert.Equal(t, []string{`h3=":8443"; ma=3600`, `h3=":443"; ma=60`}, rc.Response.Header().Values(AltSvcHeader))
+
+	rcDTO := ConvertToRequestCallDTO(rc)
+	assert.Equal(t, []string{`h3=":443"; ma=60`}, rcDTO.CacheObject.CurrentURIObject.ResponseHeaders.Values(AltSvcHeader))
+
+	// The response is untouched.
+	assert.Equal(t, []string{`h3=":8443"; ma=3600`, `h3=":443"; ma=60`}, rc.Response.Header().Values(AltSvcHeader))
+}
+
+func TestGetListeningPortOverUDP(t *testing.T) {
+	ctxTCP := context.WithValue(context.Background(), http.LocalAddrContextKey, &net.TCPAddr{Port: 443})
+	ctxUDP := context.WithValue(context.Background(), http.LocalAddrContextKey, &net.UDPAddr{Port: 8443})
+
+	assert.Equal(t, "443", getListeningPort(ctxTCP))
+	assert.Equal(t, "8443", getListeningPort(ctxUDP))
+	assert.Equal(t, "", getListeningPort(context.Background()))
+}
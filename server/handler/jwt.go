@@ -0,0 +1,81 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+type jwtAuthKey struct{}
+
+// JWTAuth - Identifies the caller of a request authenticated by a JWT.
+type JWTAuth struct {
+	Subject string
+	// Public - The response can be shared across the users.
+	Public bool
+	// Headers - Carry the claims, they're sent to the upstream.
+	Headers http.Header
+}
+
+// WithJWTAuth - Stores the details of the validated token in the request context.
+func WithJWTAuth(req *http.Request, auth JWTAuth) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), jwtAuthKey{}, auth))
+}
+
+func getJWTAuth(req http.Request) (JWTAuth, bool) {
+	auth, ok := req.Context().Value(jwtAuthKey{}).(JWTAuth)
+
+	return auth, ok
+}
+
+// applyJWTHeaders - Replaces the client-supplied copies of the claims headers
+// with the ones of the validated token (if any).
+func (rc RequestCall) applyJWTHeaders(req *http.Request) {
+	for _, name := range rc.DomainConfig.Jwt.ClaimsHeaders {
+		req.Header.Del(name)
+	}
+
+	auth, _ := getJWTAuth(rc.Request)
+	for name, values := range auth.Headers {
+		req.Header[name] = values
+	}
+}
+
+// getCachePartition - Authenticated responses are never shared across the
+// users: unless public, they're cached per subject (not cached at all without
+// a subject), and per forward auth user.
+func (rc RequestCall) getCachePartition() (string, bool) {
+	// The gRPC calls, the WebSockets and the streams are never cached.
+	if rc.IsGRPC() || rc.IsWebSocket() || rc.IsStreaming() {
+		return "", false
+	}
+
+	var partitions []string
+
+	auth, ok := getJWTAuth(rc.Request)
+	if ok && !auth.Public {
+		if auth.Subject == "" {
+			return "", false
+		}
+
+		sum := sha256.Sum256([]byte(auth.Subject))
+		partitions = append(partitions, "sub:"+hex.EncodeToString(sum[:]))
+	}
+
+	if partition := rc.getForwardAuthCachePartition(); partition != "" {
+		partitions = append(partitions, partition)
+	}
+
+	return strings.Join(partitions, "|"), true
+}
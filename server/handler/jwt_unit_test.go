@@ -0,0 +1,103 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/cache"
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+// claimsHeadersConfig - Forwards the sub and roles claims.
+var claimsHeadersConfig = config.Configuration{
+	Jwt: config.Jwt{
+		ClaimsHeaders: map[string]string{
+			"sub":   "X-User-Id",
+			"roles": "X-User-Roles",
+		},
+	},
+}
+
+func TestApplyJWTHeaders(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-User-Id", "spoofed")
+	req.Header.Set("X-User-Roles", "admin")
+	req = WithJWTAuth(req, JWTAuth{Subject: "user-1", Headers: http.Header{"X-User-Id": []string{"user-1"}}})
+
+	rc := newTestRequestCall(claimsHeadersConfig, req)
+
+	upstreamReq := rc.Request.Clone(rc.Request.Context())
+	rc.applyJWTHeaders(upstreamReq)
+
+	assert.Equal(t, []string{"user-1"}, upstreamReq.Header.Values("X-User-Id"))
+	assert.Empty(t, upstreamReq.Header.Values("X-User-Roles"))
+}
+
+func TestApplyJWTHeadersWithoutToken(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("X-User-Id", "spoofed")
+	req.Header.Set("X-Other", "value")
+
+	rc := newTestRequestCall(claimsHeadersConfig, req)
+
+	upstreamReq := rc.Request.Clone(rc.Request.Context())
+	rc.applyJWTHeaders(upstreamReq)
+
+	assert.Empty(t, upstreamReq.Header.Values("X-User-Id"))
+	assert.Equal(t, "value", upstreamReq.Header.Get("X-Other"))
+}
+
+func TestGetCachePartition(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+
+	partition, cacheable := newTestRequestCall(config.Configuration{}, req).getCachePartition()
+	assert.True(t, cacheable)
+	assert.Empty(t, partition)
+
+	partition, cacheable = newTestRequestCall(config.Configuration{}, WithJWTAuth(req, JWTAuth{Subject: "user-1", Public: true})).getCachePartition()
+	assert.True(t, cacheable)
+	assert.Empty(t, partition)
+
+	partition1, cacheable := newTestRequestCall(config.Configuration{}, WithJWTAuth(req, JWTAuth{Subject: "user-1"})).getCachePartition()
+	assert.True(t, cacheable)
+	assert.Regexp(t, "^sub:[0-9a-f]{64}$", partition1)
+
+	partition2, _ := newTestRequestCall(config.Configuration{}, WithJWTAuth(req, JWTAuth{Subject: "user-2"})).getCachePartition()
+	assert.NotEqual(t, partition1, partition2)
+
+	_, cacheable = newTestRequestCall(config.Configuration{}, WithJWTAuth(req, JWTAuth{})).getCachePartition()
+	assert.False(t, cacheable)
+}
+
+func TestCacheKeyPartitionedBySubject(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/", nil)
+
+	rc1 := newTestRequestCall(config.Configuration{}, WithJWTAuth(req, JWTAuth{Subject: "user-1"}))
+	rc2 := newTestRequestCall(config.Configuration{}, WithJWTAuth(req, JWTAuth{Subject: "user-2"}))
+	rcPublic := newTestRequestCall(config.Configuration{}, WithJWTAuth(req, JWTAuth{Subject: "user-1", Public: true}))
+
+	key1 := cache.StorageKey(ConvertToRequestCallDTO(rc1).CacheObject.CurrentURIObject, []string{})
+	key2 := cache.StorageKey(ConvertToRequestCallDTO(rc2).CacheObject.CurrentURIObject, []string{})
+	keyPublic := cache.StorageKey(ConvertToRequestCallDTO(rcPublic).CacheObject.CurrentURIObject, []string{})
+
+	assert.NotEqual(t, key1, key2)
+	assert.NotEqual(t, key1, keyPublic)
+	assert.NotContains(t, key1, "user-1")
+	assert.True(t, strings.HasPrefix(key1, keyPublic))
+}
@@ -0,0 +1,65 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/fabiocicerchia/go-proxy-cache/utils"
+)
+
+// applyLocation - Overrides the upstream and cache settings with the ones of
+// the location matching the request path (if any).
+func (rc *RequestCall) applyLocation() {
+	location, found := rc.DomainConfig.Server.Locations.Find(rc.Request.URL.Path)
+	if !found {
+		return
+	}
+
+	rc.GetLogger().Debugf("Matched location: %s", location.Name)
+
+	rc.Location = &location
+	rc.DomainConfig.Server.Upstream = location.Upstream
+	rc.DomainConfig.Cache = location.Cache
+}
+
+// GetBalancerID - Returns the ID of the load balancer serving the request.
+func (rc RequestCall) GetBalancerID() string {
+	if rc.Location != nil {
+		return rc.Location.GetBalancerID()
+	}
+
+	return rc.DomainConfig.Server.Upstream.GetDomainID()
+}
+
+// stripLocationPrefix - Removes the location prefix from the upstream request path.
+func (rc RequestCall) stripLocationPrefix(req *http.Request) {
+	if rc.Location == nil || !rc.Location.StripPrefix || rc.Location.Prefix == "" {
+		return
+	}
+
+	prefix := strings.TrimSuffix(rc.Location.Prefix, "/")
+
+	req.URL.Path = stripPathPrefix(req.URL.Path, prefix)
+	if req.URL.RawPath != "" {
+		req.URL.RawPath = stripPathPrefix(req.URL.RawPath, prefix)
+	}
+}
+
+// stripPathPrefix - Removes the prefix from the path, only on a segment
+// boundary (e.g. "/api" is removed from "/api/users" but not from "/apis").
+func stripPathPrefix(path string, prefix string) string {
+	if !utils.HasPathPrefix(path, prefix) {
+		return path
+	}
+
+	return "/" + strings.TrimPrefix(path[len(prefix):], "/")
+}
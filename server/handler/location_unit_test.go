@@ -0,0 +1,204 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/balancer"
+)
+
+func getLocationsConfig() config.Configuration {
+	conf := config.Configuration{
+		Server: config.Server{
+			Upstream: config.Upstream{
+				Host:               "example.com",
+				Scheme:             "https",
+				BalancingAlgorithm: "round-robin",
+				Endpoints:          []string{"web1", "web2"},
+			},
+		},
+		Cache: config.Cache{
+			Hosts: []string{"localhost:6379"},
+			TTL:   60,
+		},
+	}
+
+	conf.CopyOverWith(config.Configuration{
+		Server: config.Server{
+			Locations: config.Locations{
+				{
+					Prefix:      "/api/",
+					StripPrefix: true,
+					Upstream:    config.Upstream{Endpoints: []string{"api1"}},
+					Cache:       config.Cache{TTL: 5, Hosts: []string{"ignored:6379"}},
+				},
+				{
+					Name:     "assets",
+					Regex:    `\.(css|js)$`,
+					Upstream: config.Upstream{Endpoints: []string{"assets1"}, Host: "ignored.com"},
+				},
+			},
+		},
+	}, nil)
+
+	return conf
+}
+
+func TestLocationsInheritDomainSettings(t *testing.T) {
+	locations := getLocationsConfig().Server.Locations
+
+	assert.Len(t, locations, 2)
+
+	assert.Equal(t, "/api/", locations[0].Name)
+	assert.Equal(t, "example.com", locations[0].Upstream.Host)
+	assert.Equal(t, "https", locations[0].Upstream.Scheme)
+	assert.Equal(t, "round-robin", locations[0].Upstream.BalancingAlgorithm)
+	assert.Equal(t, []string{"api1"}, locations[0].Upstream.Endpoints)
+	assert.Equal(t, 5, locations[0].Cache.TTL)
+	assert.Equal(t, []string{"localhost:6379"}, locations[0].Cache.Hosts)
+
+	assert.Equal(t, "assets", locations[1].Name)
+	assert.Equal(t, "example.com", locations[1].Upstream.Host)
+	assert.Equal(t, 60, locations[1].Cache.TTL)
+}
+
+func TestApplyLocation(t *testing.T) {
+	conf := getLocationsConfig()
+
+	rc := newTestRequestCall(conf, httptest.NewRequest("GET", "/api/users", nil))
+	assert.NotNil(t, rc.Location)
+	assert.Equal(t, []string{"api1"}, rc.DomainConfig.Server.Upstream.Endpoints)
+	assert.Equal(t, "example.com@@https@@/api/", rc.GetBalancerID())
+
+	rc = newTestRequestCall(conf, httptest.NewRequest("GET", "/static/app.js", nil))
+	assert.NotNil(t, rc.Location)
+	assert.Equal(t, []string{"assets1"}, rc.DomainConfig.Server.Upstream.Endpoints)
+	assert.Equal(t, "example.com@@https@@assets", rc.GetBalancerID())
+
+	rc = newTestRequestCall(conf, httptest.NewRequest("GET", "/index.html", nil))
+	assert.Nil(t, rc.Location)
+	assert.Equal(t, []string{"web1", "web2"}, rc.DomainConfig.Server.Upstream.Endpoints)
+	assert.Equal(t, "example.com@@https", rc.GetBalancerID())
+}
+
+func TestLocationUpstreamNode(t *testing.T) {
+	conf := getLocationsConfig()
+
+	balancer.InitRoundRobin(conf.Server.Upstream.GetDomainID(), conf.Server.Upstream, false)
+	for _, location := range conf.Server.Locations {
+		balancer.InitRoundRobin(location.GetBalancerID(), location.Upstream, false)
+	}
+
+	assert.Equal(t, "api1", newTestRequestCall(conf, httptest.NewRequest("GET", "/api/users", nil)).GetUpstreamNode())
+	assert.Equal(t, "assets1", newTestRequestCall(conf, httptest.NewRequest("GET", "/app.css", nil)).GetUpstreamNode())
+	assert.Regexp(t, "^web[12]$", newTestRequestCall(conf, httptest.NewRequest("GET", "/", nil)).GetUpstreamNode())
+}
+
+func TestStickySessionPerLocation(t *testing.T) {
+	conf := getLocationsConfig()
+
+	sticky := config.StickySession{Enabled: true, Secret: "secret"}
+	conf.Server.Upstream.StickySession = sticky
+	balancer.InitRoundRobin(conf.Server.Upstream.GetDomainID(), conf.Server.Upstream, false)
+	for i := range conf.Server.Locations {
+		conf.Server.Locations[i].Upstream.StickySession = sticky
+		balancer.InitRoundRobin(conf.Server.Locations[i].GetBalancerID(), conf.Server.Locations[i].Upstream, false)
+	}
+
+	getCookie := func(rc RequestCall) *http.Cookie {
+		rc.setStickyCookie(rc.GetUpstreamNode())
+
+		cookies := rc.Response.ResponseWriter.(*httptest.ResponseRecorder).Result().Cookies()
+		assert.Len(t, cookies, 1)
+
+		return cookies[0]
+	}
+
+	domainCookie := getCookie(newTestRequestCall(conf, httptest.NewRequest("GET", "/", nil)))
+	assert.Equal(t, config.DefaultStickySessionCookieName, domainCookie.Name)
+
+	// The domain's cookie doesn't affect the location's one.
+	req := httptest.NewRequest("GET", "/api/users", nil)
+	req.AddCookie(domainCookie)
+
+	apiCookie := getCookie(newTestRequestCall(conf, req))
+	assert.Regexp(t, "^"+config.DefaultStickySessionCookieName+"_[0-9a-f]{8}$", apiCookie.Name)
+
+	assetsCookie := getCookie(newTestRequestCall(conf, httptest.NewRequest("GET", "/app.css", nil)))
+	assert.NotEqual(t, apiCookie.Name, assetsCookie.Name)
+
+	// Back to the location, the client is still pinned.
+	req = httptest.NewRequest("GET", "/api/users", nil)
+	req.AddCookie(domainCookie)
+	req.AddCookie(apiCookie)
+	req.AddCookie(assetsCookie)
+
+	node, ok := newTestRequestCall(conf, req).getStickyNode()
+	assert.True(t, ok)
+	assert.Equal(t, "api1", node)
+}
+
+func TestStripLocationPrefix(t *testing.T) {
+	conf := getLocationsConfig()
+
+	rc := newTestRequestCall(conf, httptest.NewRequest("GET", "/api/users", nil))
+	req := &http.Request{URL: &url.URL{Path: "/api/users"}}
+	rc.stripLocationPrefix(req)
+	assert.Equal(t, "/users", req.URL.Path)
+
+	req = &http.Request{URL: &url.URL{Path: "/api"}}
+	rc.stripLocationPrefix(req)
+	assert.Equal(t, "/", req.URL.Path)
+
+	// Regex locations are never stripped.
+	rc = newTestRequestCall(conf, httptest.NewRequest("GET", "/static/app.js", nil))
+	req = &http.Request{URL: &url.URL{Path: "/static/app.js"}}
+	rc.stripLocationPrefix(req)
+	assert.Equal(t, "/static/app.js", req.URL.Path)
+}
+
+func TestLocationPrefixMatchesSegments(t *testing.T) {
+	conf := getLocationsConfig()
+	conf.CopyOverWith(config.Configuration{
+		Server: config.Server{
+			Locations: config.Locations{
+				{Prefix: "/v1", StripPrefix: true, Upstream: config.Upstream{Endpoints: []string{"v1"}}},
+			},
+		},
+	}, nil)
+
+	rc := newTestRequestCall(conf, httptest.NewRequest("GET", "/v1/users", nil))
+	assert.NotNil(t, rc.Location)
+
+	req := &http.Request{URL: &url.URL{Path: "/v1/users"}}
+	rc.stripLocationPrefix(req)
+	assert.Equal(t, "/users", req.URL.Path)
+
+	req = &http.Request{URL: &url.URL{Path: "/v1"}}
+	rc.stripLocationPrefix(req)
+	assert.Equal(t, "/", req.URL.Path)
+
+	// Another segment starting with the prefix.
+	rc = newTestRequestCall(conf, httptest.NewRequest("GET", "/v10/users", nil))
+	assert.Nil(t, rc.Location)
+
+	rc = newTestRequestCall(conf, httptest.NewRequest("GET", "/apis", nil))
+	assert.Nil(t, rc.Location)
+}
@@ -17,10 +17,10 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
-	"github.com/yhat/wsutil"
 
 	"github.com/fabiocicerchia/go-proxy-cache/config"
 	"github.com/fabiocicerchia/go-proxy-cache/logger"
+	"github.com/fabiocicerchia/go-proxy-cache/server/access"
 	"github.com/fabiocicerchia/go-proxy-cache/server/response"
 	"github.com/fabiocicerchia/go-proxy-cache/telemetry"
 	"github.com/fabiocicerchia/go-proxy-cache/utils"
@@ -45,6 +45,10 @@ type RequestCall struct {
 	Response     *response.LoggedResponseWriter
 	Request      http.Request
 	DomainConfig config.Configuration
+	// Location - The location matching the request, nil when none does.
+	Location *config.Location
+	// Redirect - Set when a rewrite rule redirects the request.
+	Redirect *Redirect
 }
 
 // GetLogger - Get logger instance with RequestID.
@@ -121,6 +125,20 @@ func (rc RequestCall) GetHostname() string {
 	return utils.StripPort(rc.Request.Host)
 }
 
+// GetRemoteIP - Returns the IP address of the peer (the client, or the last proxy).
+func (rc RequestCall) GetRemoteIP() string {
+	return utils.StripPort(rc.Request.RemoteAddr)
+}
+
+// GetClientIP - Returns the IP address of the client, taken from the
+// Forwarded (or X-Forwarded-For) header when the request comes through
+// trusted proxies.
+func (rc RequestCall) GetClientIP() string {
+	trustedProxies := access.Load().GetTrustedProxies(rc.DomainConfig.Server.Upstream.GetDomainID())
+
+	return access.ResolveClientIP(rc.GetRemoteIP(), rc.Request.Header, trustedProxies, rc.DomainConfig.Server.TrustedProxiesHeader)
+}
+
 // GetScheme - Returns current request scheme.
 // For server requests the URL is parsed from the URI supplied on the
 // Request-Line as stored in RequestURI. For most requests, fields other than
@@ -144,7 +162,7 @@ func (rc RequestCall) GetScheme() string {
 
 // IsWebSocket - Checks whether a request is a websocket.
 func (rc RequestCall) IsWebSocket() bool {
-	return wsutil.IsWebSocketRequest(&rc.Request) // TODO: don't like the reference
+	return IsWebSocketRequest(&rc.Request)
 }
 
 // SendNotImplemented - Sends a 501 response status code.
@@ -161,6 +179,14 @@ func (rc RequestCall) SendMethodNotAllowed(ctx context.Context) {
 	telemetry.From(ctx).RegisterStatusCode(http.StatusMethodNotAllowed)
 }
 
+// SendBadGateway - Sends a 502 response status code.
+func (rc RequestCall) SendBadGateway(ctx context.Context) {
+	rc.Response.ForceWriteHeader(http.StatusBadGateway)
+	_ = rc.Response.WriteBody(http.StatusText(http.StatusBadGateway) + "\n")
+
+	telemetry.From(ctx).RegisterStatusCode(http.StatusBadGateway)
+}
+
 // SendNotModifiedResponse - Sends a 304 response status code.
 func (rc RequestCall) SendNotModifiedResponse(ctx context.Context) {
 	rc.Response.SendNotModifiedResponse()
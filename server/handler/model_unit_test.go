@@ -0,0 +1,32 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+// newTestRequestCall - Returns the request call for the domain's
+// configuration, with the rewrites and the location applied (like
+// initRequestParams does).
+func newTestRequestCall(conf config.Configuration, req *http.Request) RequestCall {
+	rc := NewRequestCall(httptest.NewRecorder(), req)
+	rc.DomainConfig = conf
+	rc.applyRewrites()
+	rc.applyLocation()
+
+	return rc
+}
@@ -18,10 +18,10 @@ import (
 
 	"github.com/fabiocicerchia/go-proxy-cache/config"
 	"github.com/fabiocicerchia/go-proxy-cache/logger"
+	"github.com/fabiocicerchia/go-proxy-cache/server/access"
 	"github.com/fabiocicerchia/go-proxy-cache/server/cache"
 	"github.com/fabiocicerchia/go-proxy-cache/server/storage"
 	"github.com/fabiocicerchia/go-proxy-cache/telemetry"
-	"github.com/fabiocicerchia/go-proxy-cache/utils"
 )
 
 // isPurgeAuthorized - Checks whether a PURGE request is allowed based on the
@@ -44,8 +44,9 @@ func (rc RequestCall) isPurgeAuthorized() bool {
 	}
 
 	if len(purge.AllowedIPs) > 0 {
-		// Use the direct connection IP, not the spoofable X-Forwarded-For header.
-		clientIP := net.ParseIP(utils.StripPort(rc.Request.RemoteAddr))
+		// The forwarding headers are taken into account only when set by the
+		// trusted proxies, otherwise they could be spoofed.
+		clientIP := net.ParseIP(rc.GetClientIP())
 		if clientIP == nil || !isIPAllowed(clientIP, purge.AllowedIPs) {
 			return false
 		}
@@ -56,25 +57,7 @@ func (rc RequestCall) isPurgeAuthorized() bool {
 
 // isIPAllowed - Reports whether ip matches any entry (single IP or CIDR) in the allowlist.
 func isIPAllowed(ip net.IP, allowed []string) bool {
-	for _, entry := range allowed {
-		entry = strings.TrimSpace(entry)
-		if entry == "" {
-			continue
-		}
-
-		if strings.Contains(entry, "/") {
-			if _, cidr, err := net.ParseCIDR(entry); err == nil && cidr.Contains(ip) {
-				return true
-			}
-			continue
-		}
-
-		if parsed := net.ParseIP(entry); parsed != nil && parsed.Equal(ip) {
-			return true
-		}
-	}
-
-	return false
+	return access.NewList(allowed).Contains(ip)
 }
 
 // HandlePurge - Purges the cache for the requested URI.
@@ -83,7 +66,7 @@ func (rc RequestCall) HandlePurge(ctx context.Context) {
 		rc.Response.ForceWriteHeader(http.StatusForbidden)
 		_ = rc.Response.WriteBody("KO")
 
-		rc.GetLogger().Warnf("Unauthorized PURGE attempt from %s", utils.StripPort(rc.Request.RemoteAddr))
+		rc.GetLogger().Warnf("Unauthorized PURGE attempt from %s", rc.GetClientIP())
 
 		telemetry.From(ctx).RegisterStatusCode(http.StatusForbidden)
 
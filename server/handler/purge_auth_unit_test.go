@@ -20,6 +20,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/access"
 )
 
 func TestIsIPAllowed(t *testing.T) {
@@ -106,3 +107,27 @@ func TestIsPurgeAuthorizedBothMustPass(t *testing.T) {
 	rc.Request.RemoteAddr = "1.2.3.4:5678"
 	assert.True(t, rc.isPurgeAuthorized())
 }
+
+func TestIsPurgeAuthorizedBehindTrustedProxy(t *testing.T) {
+	rc := RequestCall{DomainConfig: config.Configuration{}}
+	rc.DomainConfig.Server.Purge = config.Purge{AllowedIPs: []string{"1.2.3.0/24"}}
+	rc.DomainConfig.Server.TrustedProxies = []string{"10.0.0.1"}
+	rc.Request = http.Request{RemoteAddr: "10.0.0.1:1234", Header: http.Header{}}
+	rc.Request.Header.Set("X-Forwarded-For", "1.2.3.4")
+
+	// The proxy is not trusted yet.
+	assert.False(t, rc.isPurgeAuthorized())
+
+	access.Store(access.NewSnapshot(rc.DomainConfig))
+	defer access.Store(&access.Snapshot{})
+
+	assert.True(t, rc.isPurgeAuthorized())
+
+	rc.Request.Header.Set("X-Forwarded-For", "9.9.9.9")
+	assert.False(t, rc.isPurgeAuthorized())
+
+	// Spoofed header from an untrusted peer.
+	rc.Request.RemoteAddr = "9.9.9.9:1234"
+	rc.Request.Header.Set("X-Forwarded-For", "1.2.3.4")
+	assert.False(t, rc.isPurgeAuthorized())
+}
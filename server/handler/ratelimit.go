@@ -0,0 +1,107 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/logger"
+	"github.com/fabiocicerchia/go-proxy-cache/server/cache"
+	"github.com/fabiocicerchia/go-proxy-cache/server/ratelimit"
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry"
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry/metrics"
+)
+
+// getRateLimit - Returns the rate limit and the scope of its counters: a
+// location with its own rate limit doesn't share the domain's counters.
+func (rc RequestCall) getRateLimit() (config.RateLimit, string) {
+	if rc.Location != nil && rc.Location.RateLimit.Enabled {
+		return rc.Location.RateLimit, rc.Location.GetBalancerID()
+	}
+
+	return rc.DomainConfig.Server.RateLimit, rc.DomainConfig.Server.Upstream.GetDomainID()
+}
+
+// getRateLimitKey - Identifies the client, falling back on its IP when the
+// configured key is missing from the request.
+func (rc RequestCall) getRateLimitKey(rateLimit config.RateLimit) string {
+	value := ""
+
+	switch rateLimit.Key {
+	case config.RateLimitKeyHeader:
+		value = rc.Request.Header.Get(rateLimit.Header)
+	case config.RateLimitKeyAPIKey:
+		header := rateLimit.Header
+		if header == "" {
+			header = config.DefaultRateLimitAPIKeyHeader
+		}
+
+		value = rc.Request.Header.Get(header)
+		if value == "" {
+			value = rc.Request.URL.Query().Get("api_key")
+		}
+	case config.RateLimitKeyJWTSubject:
+		// Only a verified token (i.e. by the JWT middleware) identifies the client.
+		auth, _ := getJWTAuth(rc.Request)
+		value = auth.Subject
+	}
+
+	if value == "" {
+		return config.RateLimitKeyIP + ":" + rc.GetClientIP()
+	}
+
+	return rateLimit.Key + ":" + value
+}
+
+func toSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// IsRateLimited - Checks the rate limit, when exceeded a 429 is sent.
+func (rc RequestCall) IsRateLimited(ctx context.Context) bool {
+	rateLimit, scope := rc.getRateLimit()
+	if !rateLimit.Enabled {
+		return false
+	}
+
+	res := ratelimit.Allow(ctx, rc.DomainConfig.Server.Upstream.GetDomainID(), scope, rateLimit, rc.getRateLimitKey(rateLimit))
+	if res.Fallback {
+		metrics.IncRateLimitFallback(rc.GetHostname())
+	}
+
+	if res.Allowed {
+		metrics.IncRateLimitAllowed(rc.GetHostname())
+		return false
+	}
+
+	metrics.IncRateLimitLimited(rc.GetHostname())
+	rc.GetLogger().Infof("Rate limit exceeded for %s", rc.GetClientIP())
+
+	rc.Response.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	rc.Response.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	rc.Response.Header().Set("RateLimit-Reset", toSeconds(res.Reset))
+	rc.Response.Header().Set("Retry-After", toSeconds(res.RetryAfter))
+
+	rc.Response.ForceWriteHeader(http.StatusTooManyRequests)
+	_ = rc.Response.WriteBody(http.StatusText(http.StatusTooManyRequests) + "\n")
+
+	telemetry.From(ctx).RegisterStatusCode(http.StatusTooManyRequests)
+
+	if enableLoggingRequest {
+		logger.LogRequest(rc.Request, http.StatusTooManyRequests, 0, rc.ReqID, cache.StatusNA)
+	}
+
+	return true
+}
@@ -0,0 +1,103 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+func TestGetRateLimitKey(t *testing.T) {
+	token := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1"}`)) + "."
+
+	tests := []struct {
+		name     string
+		target   string
+		header   http.Header
+		rule     config.RateLimit
+		expected string
+	}{
+		{"ip", "/", http.Header{}, config.RateLimit{Key: config.RateLimitKeyIP}, "ip:192.168.1.1"},
+		{"header", "/", http.Header{"X-Tenant": []string{"acme"}}, config.RateLimit{Key: config.RateLimitKeyHeader, Header: "X-Tenant"}, "header:acme"},
+		{"missing header", "/", http.Header{}, config.RateLimit{Key: config.RateLimitKeyHeader, Header: "X-Tenant"}, "ip:192.168.1.1"},
+		{"api key", "/", http.Header{"X-Api-Key": []string{"k1"}}, config.RateLimit{Key: config.RateLimitKeyAPIKey}, "api_key:k1"},
+		{"api key in query", "/?api_key=k2", http.Header{}, config.RateLimit{Key: config.RateLimitKeyAPIKey}, "api_key:k2"},
+		{"unverified jwt", "/", http.Header{"Authorization": []string{"Bearer " + token}}, config.RateLimit{Key: config.RateLimitKeyJWTSubject}, "ip:192.168.1.1"},
+		{"invalid jwt", "/", http.Header{"Authorization": []string{"Bearer invalid"}}, config.RateLimit{Key: config.RateLimitKeyJWTSubject}, "ip:192.168.1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.target, nil)
+			req.RemoteAddr = "192.168.1.1:12345"
+			req.Header = tt.header
+
+			rc := newTestRequestCall(config.Configuration{Server: config.Server{RateLimit: tt.rule}}, req)
+			assert.Equal(t, tt.expected, rc.getRateLimitKey(tt.rule))
+		})
+	}
+}
+
+func TestGetRateLimitKeyVerifiedJWTSubject(t *testing.T) {
+	rule := config.RateLimit{Key: config.RateLimitKeyJWTSubject}
+
+	rc := newTestRequestCall(config.Configuration{Server: config.Server{RateLimit: rule}}, httptest.NewRequest("GET", "/", nil))
+	rc.Request = *WithJWTAuth(&rc.Request, JWTAuth{Subject: "user-1"})
+
+	assert.Equal(t, "jwt_sub:user-1", rc.getRateLimitKey(rule))
+}
+
+func TestIsRateLimited(t *testing.T) {
+	rule := config.RateLimit{
+		Enabled: true,
+		Limit:   1,
+		Period:  time.Minute,
+		Key:     config.RateLimitKeyHeader,
+		Header:  "X-Client",
+	}
+	conf := config.Configuration{Server: config.Server{RateLimit: rule}}
+	req := httptest.NewRequest("GET", "/", nil)
+	// Own counters at every run (e.g. with -count).
+	req.Header.Set("X-Client", "TestIsRateLimited-"+strconv.FormatInt(time.Now().UnixNano(), 10))
+
+	rc := newTestRequestCall(conf, req)
+	assert.False(t, rc.IsRateLimited(context.Background()))
+
+	rc = newTestRequestCall(conf, req)
+	recorder := rc.Response.ResponseWriter.(*httptest.ResponseRecorder)
+	assert.True(t, rc.IsRateLimited(context.Background()))
+
+	assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	assert.Equal(t, "1", recorder.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", recorder.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "60", recorder.Header().Get("Retry-After"))
+}
+
+func TestIsRateLimitedDisabled(t *testing.T) {
+	rule := config.RateLimit{Limit: 1, Period: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		rc := newTestRequestCall(config.Configuration{Server: config.Server{RateLimit: rule}}, httptest.NewRequest("GET", "/", nil))
+		assert.False(t, rc.IsRateLimited(context.Background()))
+	}
+}
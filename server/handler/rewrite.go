@@ -0,0 +1,105 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry"
+)
+
+// Redirect - Redirect to be sent to the client instead of proxying the request.
+type Redirect struct {
+	URL        string
+	StatusCode int
+}
+
+// splitReplacement - Splits the path from the query string, the original
+// query string is kept when the replacement has none.
+func splitReplacement(replacement string, originalQuery string) (string, string) {
+	path, query, found := strings.Cut(replacement, "?")
+	if !found {
+		return path, originalQuery
+	}
+
+	return path, query
+}
+
+// applyRewrites - Evaluates the rewrite rules: the first matching one either
+// rewrites the request path (so it affects the location and the cache key)
+// or marks the request to be redirected.
+func (rc *RequestCall) applyRewrites() {
+	for _, rule := range rc.DomainConfig.Server.Rewrites {
+		replacement, ok := rule.Apply(rc.GetHostname(), rc.Request.URL.Path, rc.Request.URL.RawQuery, rc.Request.Header)
+		if !ok {
+			continue
+		}
+
+		path, query := splitReplacement(replacement, rc.Request.URL.RawQuery)
+
+		if rule.IsRedirect() {
+			target := path
+			if query != "" {
+				target += "?" + query
+			}
+
+			rc.GetLogger().Debugf("Rewrite rule %s redirects to %s", rule.Match, target)
+			rc.Redirect = &Redirect{URL: target, StatusCode: rule.Redirect}
+
+			return
+		}
+
+		rc.GetLogger().Debugf("Rewrite rule %s rewrites the path to %s", rule.Match, path)
+
+		// The URL is shared with the original request, so it's copied.
+		rewrittenURL := *rc.Request.URL
+		rewrittenURL.Path = path
+		rewrittenURL.RawPath = ""
+		rewrittenURL.RawQuery = query
+		rc.Request.URL = &rewrittenURL
+		rc.Request.RequestURI = rewrittenURL.RequestURI()
+
+		return
+	}
+}
+
+// GetRewrittenPath - Returns the path after the rewrite rules, the request is
+// not altered (e.g. to match it before the request is handled).
+func (rc RequestCall) GetRewrittenPath() string {
+	rc.applyRewrites()
+
+	return rc.Request.URL.Path
+}
+
+// serveRedirect - Sends the redirect, it's buffered like any upstream
+// response so it goes through the cache pipeline.
+func (rc RequestCall) serveRedirect(ctx context.Context) {
+	escapedURL := strings.Replace(rc.Redirect.URL, "\n", "", -1)
+	escapedURL = strings.Replace(escapedURL, "\r", "", -1)
+
+	rc.GetLogger().Infof("Redirect to: %s", escapedURL)
+
+	http.Redirect(rc.Response, &rc.Request, rc.Redirect.URL, rc.Redirect.StatusCode)
+
+	if targetURL, err := url.Parse(rc.Redirect.URL); err == nil {
+		telemetry.From(ctx).RegisterRedirect(*targetURL)
+	}
+
+	// The DTO is built before any client-only header is added.
+	rcDTO := ConvertToRequestCallDTO(rc)
+
+	rc.applyResponseHeaderRules(rc.Response.Header())
+
+	rc.SendResponse(ctx)
+	rc.storeResponse(ctx, rcDTO)
+}
@@ -0,0 +1,137 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+func getRewritesConfig() config.Configuration {
+	conf := config.Configuration{}
+	conf.CopyOverWith(config.Configuration{
+		Server: config.Server{
+			Rewrites: config.Rewrites{
+				{
+					Match:       `^/old/(.*)$`,
+					Replacement: "/new/$1",
+					Redirect:    http.StatusMovedPermanently,
+				},
+				{
+					Match:       `^/mobile/(.*)$`,
+					Replacement: "https://m.example.com/$1?from=desktop",
+					Redirect:    http.StatusFound,
+					Conditions: config.RewriteCondition{
+						Headers: map[string]string{"User-Agent": "(?i)mobile"},
+					},
+				},
+				{
+					Match:       `^/products/([0-9]+)$`,
+					Replacement: "/catalog/item/$1",
+					Conditions: config.RewriteCondition{
+						Host:  `^example\.com$`,
+						Query: `(^|&)lang=`,
+					},
+				},
+			},
+		},
+	}, nil)
+
+	return conf
+}
+
+func TestRewriteRedirect(t *testing.T) {
+	rc := newTestRequestCall(getRewritesConfig(), httptest.NewRequest("GET", "/old/page?a=1", nil))
+
+	assert.NotNil(t, rc.Redirect)
+	assert.Equal(t, "/new/page?a=1", rc.Redirect.URL)
+	assert.Equal(t, http.StatusMovedPermanently, rc.Redirect.StatusCode)
+	assert.Equal(t, "/old/page", rc.Request.URL.Path)
+}
+
+func TestRewriteRedirectWithConditions(t *testing.T) {
+	req := httptest.NewRequest("GET", "/mobile/page?a=1", nil)
+	req.Header.Set("User-Agent", "Mobile Safari")
+
+	rc := newTestRequestCall(getRewritesConfig(), req)
+
+	assert.NotNil(t, rc.Redirect)
+	assert.Equal(t, "https://m.example.com/page?from=desktop", rc.Redirect.URL)
+	assert.Equal(t, http.StatusFound, rc.Redirect.StatusCode)
+
+	req = httptest.NewRequest("GET", "/mobile/page", nil)
+	req.Header.Set("User-Agent", "Firefox")
+
+	rc = newTestRequestCall(getRewritesConfig(), req)
+	assert.Nil(t, rc.Redirect)
+	assert.Equal(t, "/mobile/page", rc.Request.URL.Path)
+}
+
+func TestRewriteInternal(t *testing.T) {
+	rc := newTestRequestCall(getRewritesConfig(), httptest.NewRequest("GET", "/products/42?lang=en", nil))
+
+	assert.Nil(t, rc.Redirect)
+	assert.Equal(t, "/catalog/item/42", rc.Request.URL.Path)
+	assert.Equal(t, "lang=en", rc.Request.URL.RawQuery)
+	assert.Equal(t, "https://example.com/catalog/item/42?lang=en", func() string {
+		u := rc.GetRequestURL()
+		u.Scheme = "https"
+		return u.String()
+	}())
+
+	// Query condition not met.
+	rc = newTestRequestCall(getRewritesConfig(), httptest.NewRequest("GET", "/products/42", nil))
+	assert.Equal(t, "/products/42", rc.Request.URL.Path)
+}
+
+func TestServeRedirectIsBuffered(t *testing.T) {
+	rc := newTestRequestCall(getRewritesConfig(), httptest.NewRequest("GET", "/old/page", nil))
+	recorder := rc.Response.ResponseWriter.(*httptest.ResponseRecorder)
+
+	rc.serveRedirect(context.Background())
+
+	assert.Equal(t, http.StatusMovedPermanently, rc.Response.StatusCode)
+	assert.NotEmpty(t, rc.Response.Content)
+	assert.Equal(t, http.StatusMovedPermanently, recorder.Code)
+	assert.Equal(t, "/new/page", recorder.Header().Get("Location"))
+}
+
+func TestHandleRequestRedirectsWebSocketAndGRPC(t *testing.T) {
+	defer func() { config.Config = config.Configuration{} }()
+
+	conf := getRewritesConfig()
+	conf.Server.Upstream.Host = "redirects.example.com"
+	config.Config = conf
+
+	ws := httptest.NewRequest("GET", "http://redirects.example.com/old/chat", nil)
+	ws.Header.Set("Connection", "Upgrade")
+	ws.Header.Set("Upgrade", "websocket")
+
+	grpc := httptest.NewRequest("POST", "http://redirects.example.com/old/service", nil)
+	grpc.Header.Set("Content-Type", GRPCContentType)
+
+	for _, req := range []*http.Request{ws, grpc} {
+		w := httptest.NewRecorder()
+		HandleRequest(w, req)
+
+		assert.Equal(t, http.StatusMovedPermanently, w.Code)
+		assert.Equal(t, "/new/"+path.Base(req.URL.Path), w.Header().Get("Location"))
+	}
+}
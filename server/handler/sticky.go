@@ -0,0 +1,144 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/balancer"
+	"github.com/fabiocicerchia/go-proxy-cache/utils"
+)
+
+// stickySeparator - Separates the node ID from its signature in the cookie value.
+const stickySeparator = "."
+
+// stickyFallbackSecret - Signing key used when no secret is configured.
+var stickyFallbackSecret = generateStickySecret()
+
+func generateStickySecret() []byte {
+	secret := make([]byte, 32)
+	_, _ = rand.Read(secret)
+
+	return secret
+}
+
+func getStickySecret(sticky config.StickySession) []byte {
+	if sticky.Secret == "" {
+		return stickyFallbackSecret
+	}
+
+	return []byte(sticky.Secret)
+}
+
+// getStickyCookieName - Every location has its own cookie (named after its
+// balancer), so moving across the locations doesn't reset the stickiness.
+func (rc RequestCall) getStickyCookieName() string {
+	name := utils.IfEmpty(rc.DomainConfig.Server.Upstream.StickySession.CookieName, config.DefaultStickySessionCookieName)
+	if rc.Location == nil {
+		return name
+	}
+
+	sum := sha256.Sum256([]byte(rc.GetBalancerID()))
+
+	return name + "_" + hex.EncodeToString(sum[:4])
+}
+
+func signStickyValue(secret []byte, nodeID string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(nodeID))
+
+	return nodeID + stickySeparator + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyStickyValue - Returns the node ID when the signature is valid.
+func verifyStickyValue(secret []byte, value string) (string, bool) {
+	nodeID, _, found := strings.Cut(value, stickySeparator)
+	if !found || nodeID == "" {
+		return "", false
+	}
+
+	// Constant-time comparison to avoid leaking the signature via timing.
+	if !hmac.Equal([]byte(value), []byte(signStickyValue(secret, nodeID))) {
+		return "", false
+	}
+
+	return nodeID, true
+}
+
+func getStickySameSite(value string) http.SameSite {
+	switch strings.ToLower(value) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteDefaultMode
+	}
+}
+
+// getStickyNode - Returns the node referenced by the sticky cookie, as long as
+// the cookie is valid and the node is still healthy.
+func (rc RequestCall) getStickyNode() (string, bool) {
+	sticky := rc.DomainConfig.Server.Upstream.StickySession
+	if !sticky.Enabled {
+		return "", false
+	}
+
+	cookie, err := rc.Request.Cookie(rc.getStickyCookieName())
+	if err != nil {
+		return "", false
+	}
+
+	nodeID, ok := verifyStickyValue(getStickySecret(sticky), cookie.Value)
+	if !ok {
+		rc.GetLogger().Debugf("Invalid sticky session cookie, a new node will be picked.")
+		return "", false
+	}
+
+	return balancer.GetStickyNode(rc.GetBalancerID(), nodeID)
+}
+
+// setStickyCookie - Issues the sticky cookie for the picked node, unless the
+// client already holds a valid one for the same node.
+func (rc RequestCall) setStickyCookie(endpoint string) {
+	upstream := rc.DomainConfig.Server.Upstream
+	sticky := upstream.StickySession
+	if !sticky.Enabled || !balancer.HasNode(rc.GetBalancerID(), endpoint) {
+		return
+	}
+
+	if current, ok := rc.getStickyNode(); ok && current == endpoint {
+		return
+	}
+
+	cookie := &http.Cookie{
+		Name:     rc.getStickyCookieName(),
+		Value:    signStickyValue(getStickySecret(sticky), balancer.GetNodeID(endpoint)),
+		Path:     utils.IfEmpty(sticky.Path, "/"),
+		Domain:   sticky.Domain,
+		Secure:   sticky.Secure,
+		HttpOnly: sticky.HTTPOnly,
+		SameSite: getStickySameSite(sticky.SameSite),
+	}
+	if sticky.TTL > 0 {
+		cookie.MaxAge = int(sticky.TTL.Seconds())
+	}
+
+	http.SetCookie(rc.Response, cookie)
+}
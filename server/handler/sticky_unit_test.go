@@ -0,0 +1,129 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/balancer"
+)
+
+func TestStickyValueSignature(t *testing.T) {
+	secret := []byte("secret")
+
+	value := signStickyValue(secret, "abcdef")
+
+	nodeID, ok := verifyStickyValue(secret, value)
+	assert.True(t, ok)
+	assert.Equal(t, "abcdef", nodeID)
+
+	_, ok = verifyStickyValue([]byte("another"), value)
+	assert.False(t, ok)
+
+	_, ok = verifyStickyValue(secret, "abcdef")
+	assert.False(t, ok)
+
+	_, ok = verifyStickyValue(secret, "abcdeg"+value[len("abcdef"):])
+	assert.False(t, ok)
+}
+
+func TestStickySessionPinsNode(t *testing.T) {
+	upstream := config.Upstream{
+		Host:      "example.com",
+		Scheme:    "https",
+		Endpoints: []string{"server1", "server2", "server3"},
+		StickySession: config.StickySession{
+			Enabled: true,
+			Secret:  "secret",
+			TTL:     time.Hour,
+		},
+	}
+	balancer.InitRoundRobin(upstream.GetDomainID(), upstream, false)
+
+	conf := config.Configuration{Server: config.Server{Upstream: upstream}}
+
+	rc := newTestRequestCall(conf, httptest.NewRequest("GET", "/", nil))
+	endpoint := rc.GetUpstreamNode()
+	rc.setStickyCookie(endpoint)
+
+	cookies := (&http.Response{Header: rc.Response.Header()}).Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, config.DefaultStickySessionCookieName, cookies[0].Name)
+	assert.Equal(t, 3600, cookies[0].MaxAge)
+	assert.Equal(t, "/", cookies[0].Path)
+	assert.NotContains(t, cookies[0].Value, endpoint)
+
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookies[0])
+
+		rc = newTestRequestCall(conf, req)
+		assert.Equal(t, endpoint, rc.GetUpstreamNode())
+
+		// Valid cookie for the same node, no need to issue it again.
+		rc.setStickyCookie(endpoint)
+		assert.Empty(t, rc.Response.Header().Get("Set-Cookie"))
+	}
+}
+
+func TestStickySessionHonorsCookie(t *testing.T) {
+	upstream := config.Upstream{
+		Host:          "example.org",
+		Scheme:        "https",
+		Endpoints:     []string{"server1", "server2"},
+		StickySession: config.StickySession{Enabled: true, Secret: "secret"},
+	}
+	domainID := upstream.GetDomainID()
+	balancer.InitRoundRobin(domainID, upstream, false)
+
+	cookie := &http.Cookie{
+		Name:  config.DefaultStickySessionCookieName,
+		Value: signStickyValue([]byte("secret"), balancer.GetNodeID("server1")),
+	}
+
+	conf := config.Configuration{Server: config.Server{Upstream: upstream}}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+
+	rc := newTestRequestCall(conf, req)
+	assert.Equal(t, "server1", rc.GetUpstreamNode())
+
+	// Forged cookie is ignored.
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: config.DefaultStickySessionCookieName, Value: balancer.GetNodeID("server2") + ".forged"})
+
+	rc = newTestRequestCall(conf, req)
+	_, ok := rc.getStickyNode()
+	assert.False(t, ok)
+}
+
+func TestStickySessionDisabled(t *testing.T) {
+	upstream := config.Upstream{
+		Host:      "example.net",
+		Scheme:    "https",
+		Endpoints: []string{"server1"},
+	}
+	balancer.InitRoundRobin(upstream.GetDomainID(), upstream, false)
+
+	rc := newTestRequestCall(config.Configuration{Server: config.Server{Upstream: upstream}}, httptest.NewRequest("GET", "/", nil))
+	rc.setStickyCookie(rc.GetUpstreamNode())
+
+	assert.Empty(t, rc.Response.Header().Get("Set-Cookie"))
+}
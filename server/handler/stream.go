@@ -0,0 +1,182 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+// streamCloseTimeout - Time allowed to end the stream after its max duration.
+const streamCloseTimeout = 5 * time.Second
+
+// getStreamContentTypes - Returns the streamed content types (lowercase).
+func getStreamContentTypes(stream config.Stream) []string {
+	contentTypes := []string{}
+
+	for _, v := range stream.ContentTypes {
+		if v = strings.ToLower(strings.TrimSpace(v)); v != "" {
+			contentTypes = append(contentTypes, v)
+		}
+	}
+
+	if len(contentTypes) == 0 {
+		contentTypes = append(contentTypes, config.DefaultStreamContentType)
+	}
+
+	return contentTypes
+}
+
+// isStreamContentType - Checks whether the content type (parameters
+// excluded) is a streamed one.
+func isStreamContentType(stream config.Stream, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	for _, v := range getStreamContentTypes(stream) {
+		if mediaType == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsStreaming - Checks whether every response is streamed (by config, the
+// other ones are detected by their content type).
+func (rc RequestCall) IsStreaming() bool {
+	return rc.DomainConfig.Server.Upstream.Stream.Enabled
+}
+
+// IsStreamingRequest - Checks whether the response is expected to be
+// streamed (or the connection upgraded), before the request is processed
+// (e.g. to bypass the handler's timeout). Only the configured streams are
+// expected (the client cannot opt in), their location is matched on the
+// original path.
+func IsStreamingRequest(req *http.Request) bool {
+	if IsGRPCRequest(req) || IsWebSocketRequest(req) {
+		return true
+	}
+
+	scheme := SchemeHTTP
+	if req.TLS != nil {
+		scheme = SchemeHTTPS
+	}
+
+	domainConfig, found := config.DomainConf(req.Host, scheme)
+	if !found {
+		return false
+	}
+
+	if location, ok := domainConfig.Server.Locations.Find(req.URL.Path); ok {
+		return location.Upstream.Stream.Enabled
+	}
+
+	return domainConfig.Server.Upstream.Stream.Enabled
+}
+
+// streamBody - Ends the stream (as completed) when nothing is received for
+// the idle timeout, or after the max duration.
+type streamBody struct {
+	io.ReadCloser
+	idleTimeout time.Duration
+	idleTimer   *time.Timer
+	maxTimer    *time.Timer
+	expired     atomic.Bool
+}
+
+func newStreamBody(body io.ReadCloser, stream config.Stream) *streamBody {
+	b := &streamBody{ReadCloser: body, idleTimeout: stream.IdleTimeout}
+
+	if stream.IdleTimeout > 0 {
+		b.idleTimer = time.AfterFunc(stream.IdleTimeout, b.expire)
+	}
+
+	if stream.MaxDuration > 0 {
+		b.maxTimer = time.AfterFunc(stream.MaxDuration, b.expire)
+	}
+
+	return b
+}
+
+// expire - Closes the upstream's body, unblocking the pending read.
+func (b *streamBody) expire() {
+	b.expired.Store(true)
+	_ = b.ReadCloser.Close()
+}
+
+// Read - Reads from the upstream, postponing the idle timeout on data.
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && b.expired.Load() {
+		return n, io.EOF
+	}
+
+	if n > 0 && b.idleTimer != nil {
+		b.idleTimer.Reset(b.idleTimeout)
+	}
+
+	return n, err
+}
+
+// Close - Stops the timeouts and closes the upstream's body.
+func (b *streamBody) Close() error {
+	if b.idleTimer != nil {
+		b.idleTimer.Stop()
+	}
+
+	if b.maxTimer != nil {
+		b.maxTimer.Stop()
+	}
+
+	return b.ReadCloser.Close()
+}
+
+// streamResponse - Returns the proxy's ModifyResponse, switching the
+// streamed responses to be sent right away (flushing every chunk) with
+// the stream's timeouts.
+// The client-only headers are added here, as they're sent straight away.
+func (rc RequestCall) streamResponse(proxy *httputil.ReverseProxy, endpoint string) func(*http.Response) error {
+	return func(res *http.Response) error {
+		stream := rc.DomainConfig.Server.Upstream.Stream
+		if !stream.Enabled && !isStreamContentType(stream, res.Header.Get("Content-Type")) {
+			return nil
+		}
+
+		rc.GetLogger().Debugf("Streaming the response (content type: %s)", res.Header.Get("Content-Type"))
+
+		rc.Response.StartStreaming()
+		proxy.FlushInterval = -1
+
+		rc.setStickyCookie(endpoint)
+		rc.applyResponseHeaderRules(res.Header)
+
+		// The server's write timeout is replaced by the stream's max duration
+		// (plus the time needed to end it).
+		deadline := time.Time{}
+		if stream.MaxDuration > 0 {
+			deadline = time.Now().Add(stream.MaxDuration + streamCloseTimeout)
+		}
+		_ = http.NewResponseController(rc.Response.ResponseWriter).SetWriteDeadline(deadline)
+
+		res.Body = newStreamBody(res.Body, stream)
+
+		return nil
+	}
+}
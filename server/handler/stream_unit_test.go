@@ -0,0 +1,189 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/balancer"
+)
+
+func TestIsStreamContentType(t *testing.T) {
+	stream := config.Stream{}
+
+	assert.True(t, isStreamContentType(stream, "text/event-stream"))
+	assert.True(t, isStreamContentType(stream, "Text/Event-Stream; charset=utf-8"))
+	assert.False(t, isStreamContentType(stream, "text/html"))
+	assert.False(t, isStreamContentType(stream, ""))
+
+	stream.ContentTypes = []string{"application/x-ndjson"}
+
+	assert.True(t, isStreamContentType(stream, "application/x-ndjson"))
+	assert.False(t, isStreamContentType(stream, "text/event-stream"))
+}
+
+func TestAcceptHeaderDoesNotStream(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/page", nil)
+	req.Header.Set("Accept", "text/html, text/event-stream;q=0.9")
+
+	rc := newTestRequestCall(config.Configuration{}, req)
+	assert.False(t, rc.IsStreaming())
+	assert.False(t, IsStreamingRequest(req))
+
+	_, cacheable := rc.getCachePartition()
+	assert.True(t, cacheable)
+}
+
+func TestStreamingIsNotCacheable(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/poll", nil)
+
+	rc := newTestRequestCall(config.Configuration{Server: config.Server{Upstream: config.Upstream{
+		Stream: config.Stream{Enabled: true},
+	}}}, req)
+
+	assert.True(t, rc.IsStreaming())
+
+	_, cacheable := rc.getCachePartition()
+	assert.False(t, cacheable)
+}
+
+// serveStream - Proxies the requests through serveReverseProxyHTTP to the
+// upstream, with the given stream's settings.
+func serveStream(t *testing.T, upstream *httptest.Server, stream config.Stream) *httptest.Server {
+	endpoint := strings.TrimPrefix(upstream.URL, "http://")
+	upstreamConfig := config.Upstream{
+		Host:      "sse.example.com",
+		Scheme:    "http",
+		Endpoints: []string{endpoint},
+		Stream:    stream,
+	}
+	balancer.InitRoundRobin(upstreamConfig.GetDomainID(), upstreamConfig, false)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Host = "sse.example.com"
+
+		rc := NewRequestCall(w, r)
+		rc.DomainConfig = config.Configuration{Server: config.Server{Upstream: upstreamConfig}}
+
+		rc.serveReverseProxyHTTP(context.Background())
+
+		assert.Equal(t, 0, rc.Response.Content.Len())
+	}))
+}
+
+func TestServeReverseProxyHTTPStreamsEvents(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+
+		<-release
+		fmt.Fprint(w, "data: second\n\n")
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	front := serveStream(t, upstream, config.Stream{})
+	defer front.Close()
+
+	res, err := http.Get(front.URL + "/events")
+	assert.Nil(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	// The first event is received while the upstream is still open.
+	line, err := bufio.NewReader(res.Body).ReadString('\n')
+	assert.Nil(t, err)
+	assert.Equal(t, "data: first\n", line)
+}
+
+func TestServeReverseProxyHTTPStreamIdleTimeout(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(w, "pending")
+		w.(http.Flusher).Flush()
+
+		<-release
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	front := serveStream(t, upstream, config.Stream{Enabled: true, IdleTimeout: 100 * time.Millisecond})
+	defer front.Close()
+
+	start := time.Now()
+	res, err := http.Get(front.URL + "/poll")
+	assert.Nil(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+
+	assert.Equal(t, "pending", string(body))
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestServeReverseProxyHTTPStreamMaxDuration(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-release:
+				return
+			case <-ticker.C:
+				fmt.Fprint(w, ": ping\n\n")
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	defer upstream.Close()
+	defer close(release)
+
+	front := serveStream(t, upstream, config.Stream{IdleTimeout: time.Minute, MaxDuration: 200 * time.Millisecond})
+	defer front.Close()
+
+	start := time.Now()
+	res, err := http.Get(front.URL + "/events")
+	assert.Nil(t, err)
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	assert.Nil(t, err)
+
+	assert.Contains(t, string(body), ": ping\n\n")
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
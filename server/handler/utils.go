@@ -11,7 +11,6 @@ package handler
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -19,6 +18,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/rs/dnscache"
 
@@ -27,6 +27,7 @@ import (
 	"github.com/fabiocicerchia/go-proxy-cache/logger"
 	"github.com/fabiocicerchia/go-proxy-cache/server/balancer"
 	"github.com/fabiocicerchia/go-proxy-cache/server/storage"
+	srvtls "github.com/fabiocicerchia/go-proxy-cache/server/tls"
 	"github.com/fabiocicerchia/go-proxy-cache/telemetry/metrics"
 	"github.com/fabiocicerchia/go-proxy-cache/telemetry/tracing"
 	"github.com/fabiocicerchia/go-proxy-cache/utils"
@@ -37,13 +38,28 @@ const RequestIDHeader = "X-Go-Proxy-Cache-Request-ID"
 
 var r *dnscache.Resolver = &dnscache.Resolver{}
 
+// transports - The HTTP transports by upstream pool.
+var transports sync.Map
+
+// proxyTransport - HTTP transport, with the generation of the upstream TLS
+// files it has been built with.
+type proxyTransport struct {
+	transport  *http.Transport
+	generation uint64
+}
+
 // ConvertToRequestCallDTO - Generates a storage DTO containing request, response and cache settings.
 func ConvertToRequestCallDTO(rc RequestCall) storage.RequestCallDTO {
 	responseHeaders := http.Header{}
 	if rc.Response != nil {
-		responseHeaders = rc.Response.Header()
+		// Snapshot: headers added afterwards for the client only (e.g. the
+		// sticky session cookie) must not end up in the cache.
+		responseHeaders = rc.Response.Header().Clone()
+		rc.removeAltSvcHeader(responseHeaders)
 	}
 
+	partition, _ := rc.getCachePartition()
+
 	return storage.RequestCallDTO{
 		ReqID:    rc.ReqID,
 		Response: *rc.Response,
@@ -60,6 +76,7 @@ func ConvertToRequestCallDTO(rc RequestCall) storage.RequestCallDTO {
 				RequestHeaders:  rc.Request.Header,
 				ResponseHeaders: responseHeaders,
 				Content:         rc.Response.Content,
+				Partition:       partition,
 			},
 		},
 	}
@@ -68,9 +85,11 @@ func ConvertToRequestCallDTO(rc RequestCall) storage.RequestCallDTO {
 func getListeningPort(ctx context.Context) string {
 	listeningPort := ""
 
-	localAddrContextKey := ctx.Value(http.LocalAddrContextKey)
-	if localAddrContextKey != nil {
-		srvAddr := localAddrContextKey.(*net.TCPAddr)
+	// TCP for HTTP/1.1 and HTTP/2, UDP for HTTP/3.
+	switch srvAddr := ctx.Value(http.LocalAddrContextKey).(type) {
+	case *net.TCPAddr:
+		listeningPort = strconv.Itoa(srvAddr.Port)
+	case *net.UDPAddr:
 		listeningPort = strconv.Itoa(srvAddr.Port)
 	}
 
@@ -87,13 +106,85 @@ func isLegitPort(port config.Port, listeningPort string) bool {
 	return port.HTTP == listeningPort || port.HTTPS == listeningPort
 }
 
-func (rc RequestCall) patchProxyTransport() *http.Transport {
+// getProxyTransport - Returns the transport shared by the requests sent to
+// the same upstream pool, so the connections (and their limits) are shared too.
+// It's rebuilt once the upstream TLS files are reloaded, and never stored
+// when they cannot be loaded.
+func (rc RequestCall) getProxyTransport() (*http.Transport, error) {
+	balancerID := rc.GetBalancerID()
+	generation := srvtls.UpstreamGeneration()
+
+	stored, ok := transports.Load(balancerID)
+	if ok && stored.(*proxyTransport).generation == generation {
+		return stored.(*proxyTransport).transport, nil
+	}
+
+	transport, err := rc.patchProxyTransport()
+	if err != nil {
+		return nil, err
+	}
+	transport.Protocols = getUpstreamProtocols(rc.DomainConfig.Server.Upstream.Protocol)
+
+	current := &proxyTransport{transport: transport, generation: generation}
+
+	for {
+		stored, loaded := transports.LoadOrStore(balancerID, current)
+		if !loaded {
+			return transport, nil
+		}
+
+		previous := stored.(*proxyTransport)
+		if previous.generation >= generation {
+			return previous.transport, nil
+		}
+
+		if transports.CompareAndSwap(balancerID, previous, current) {
+			previous.transport.CloseIdleConnections()
+
+			return transport, nil
+		}
+	}
+}
+
+// getUpstreamProtocols - Returns the protocols to the upstream: HTTP/2 is
+// negotiated over TLS (falling back on HTTP/1.1), while h2c uses HTTP/2
+// only (without upgrade).
+func getUpstreamProtocols(protocol string) *http.Protocols {
+	protocols := &http.Protocols{}
+
+	switch protocol {
+	case config.UpstreamProtocolH2:
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	case config.UpstreamProtocolH2C:
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	default:
+		protocols.SetHTTP1(true)
+	}
+
+	return protocols
+}
+
+func (rc RequestCall) patchProxyTransport() (*http.Transport, error) {
+	maxConnsPerHost := rc.DomainConfig.Server.Upstream.Concurrency.MaxConnsPerHost
+	if maxConnsPerHost == 0 {
+		maxConnsPerHost = DefaultTransportMaxConnsPerHost
+	}
+
+	upstream := rc.DomainConfig.Server.Upstream
+
+	tlsConfig, err := srvtls.UpstreamConfig(upstream.TLS, upstream.InsecureBridge)
+	if err != nil {
+		return nil, err
+	}
+
 	// G402 (CWE-295): TLS InsecureSkipVerify may be true. (Confidence: LOW, Severity: HIGH)
 	// It can be ignored as it is customisable, but the default is false.
 	return &http.Transport{
 		MaxIdleConns:        DefaultTransportMaxIdleConns,
 		MaxIdleConnsPerHost: DefaultTransportMaxIdleConnsPerHost,
-		MaxConnsPerHost:     DefaultTransportMaxConnsPerHost,
+		MaxConnsPerHost:     maxConnsPerHost,
 		DialContext: func(ctx context.Context, network string, address string) (conn net.Conn, err error) {
 			// DNS Cache
 			host, port, err := net.SplitHostPort(address)
@@ -118,10 +209,8 @@ func (rc RequestCall) patchProxyTransport() *http.Transport {
 			return d.DialContext(ctx, network, address)
 		},
 		DisableKeepAlives: false,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: rc.DomainConfig.Server.Upstream.InsecureBridge,
-		},
-	} // #nosec
+		TLSClientConfig:   tlsConfig,
+	}, nil // #nosec
 }
 
 func getOverridePort(host string, port string, scheme string) string {
@@ -147,13 +236,30 @@ func getOverridePort(host string, port string, scheme string) string {
 
 // GetUpstreamURL - Get the URL based on the upstream.
 func (rc RequestCall) GetUpstreamURL() (url.URL, error) {
+	return rc.getUpstreamURLForNode(rc.GetUpstreamNode())
+}
+
+// GetUpstreamNode - Returns the backend endpoint selected for the request,
+// honoring the sticky session (if any) before the balancing algorithm.
+func (rc RequestCall) GetUpstreamNode() string {
+	upstream := rc.DomainConfig.Server.Upstream
+
+	if endpoint, ok := rc.getStickyNode(); ok {
+		return endpoint
+	}
+
+	hostname := upstream.Host + getOverridePort(upstream.Host, upstream.Port, rc.GetScheme())
+
+	return balancer.GetUpstreamNode(rc.GetBalancerID(), rc.GetClientIP(), hostname)
+}
+
+func (rc RequestCall) getUpstreamURLForNode(balancedEndpoint string) (url.URL, error) {
 	upstream := rc.DomainConfig.Server.Upstream
 	overridePort := getOverridePort(upstream.Host, upstream.Port, rc.GetScheme())
 
 	// Override Hostname with Destination Hostname.
 	hostname := upstream.Host + overridePort
 
-	balancedEndpoint := balancer.GetUpstreamNode(upstream.GetDomainID(), rc.GetRequestURL(), hostname)
 	if !strings.Contains(balancedEndpoint, "://") {
 		// Ref: https://github.com/golang/go/issues/19297#issuecomment-282651469
 		balancedEndpoint = fmt.Sprintf("//%s", balancedEndpoint)
@@ -228,9 +334,7 @@ func (rc RequestCall) ProxyDirector(ctx context.Context) func(req *http.Request)
 		req.Header.Set(RequestIDHeader, rc.ReqID)
 
 		previousXForwardedFor := rc.Request.Header.Get("X-Forwarded-For")
-		clientIP := utils.StripPort(rc.Request.RemoteAddr)
-
-		xForwardedFor := net.ParseIP(clientIP).String()
+		xForwardedFor := net.ParseIP(rc.GetRemoteIP()).String()
 		if previousXForwardedFor != "" {
 			xForwardedFor = previousXForwardedFor + ", " + xForwardedFor
 		}
@@ -239,6 +343,14 @@ func (rc RequestCall) ProxyDirector(ctx context.Context) func(req *http.Request)
 
 		req.Host = upstreamHost
 
+		rc.stripLocationPrefix(req)
+
+		rc.applyJWTHeaders(req)
+
+		rc.applyClientCertHeaders(req)
+
+		rc.applyRequestHeaderRules(req)
+
 		tracing.Inject(ctx, req)
 	}
 }
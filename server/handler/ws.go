@@ -11,19 +11,59 @@ package handler
 
 import (
 	"context"
+	"io"
 	"net/http"
+	"net/http/httputil"
+	"path"
 	"strings"
-
-	"github.com/yhat/wsutil"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/fabiocicerchia/go-proxy-cache/logger"
 	"github.com/fabiocicerchia/go-proxy-cache/server/cache"
 	"github.com/fabiocicerchia/go-proxy-cache/telemetry"
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry/metrics"
 	"github.com/fabiocicerchia/go-proxy-cache/telemetry/tracing"
 )
 
+// wsConnections - Open WebSocket connections, per domain.
+var wsConnections sync.Map
+
+// IsWebSocketRequest - Checks whether the request is a WebSocket upgrade.
+func IsWebSocketRequest(req *http.Request) bool {
+	return headerContainsToken(req.Header, "Connection", "upgrade") &&
+		headerContainsToken(req.Header, "Upgrade", "websocket")
+}
+
+// headerContainsToken - Checks whether the comma-separated header contains
+// the token (case-insensitive).
+func headerContainsToken(h http.Header, key string, token string) bool {
+	for _, value := range h.Values(key) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 // HandleWSRequestAndProxy - Handles the websocket requests and proxies to backend server.
 func (rc RequestCall) HandleWSRequestAndProxy(ctx context.Context) {
+	if rc.IsWebSocketOriginDenied(ctx) {
+		return
+	}
+
+	release, ok := rc.acquireWebSocket()
+	if !ok {
+		rc.GetLogger().Warnf("Too many WebSocket connections to %s", rc.GetHostname())
+		rc.rejectWebSocket(ctx, http.StatusServiceUnavailable, "limit")
+		return
+	}
+	defer release()
+
 	rc.serveReverseProxyWS(ctx)
 
 	if enableLoggingRequest {
@@ -31,6 +71,61 @@ func (rc RequestCall) HandleWSRequestAndProxy(ctx context.Context) {
 	}
 }
 
+// IsWebSocketOriginDenied - Rejects (with 403) the origins not allowed.
+func (rc RequestCall) IsWebSocketOriginDenied(ctx context.Context) bool {
+	origin := rc.Request.Header.Get("Origin")
+	if isWebSocketOriginAllowed(rc.DomainConfig.Server.WebSocket.AllowedOrigins, origin) {
+		return false
+	}
+
+	rc.GetLogger().Warnf("WebSocket origin not allowed: %s", strings.ReplaceAll(origin, "\n", ""))
+	rc.rejectWebSocket(ctx, http.StatusForbidden, "origin")
+
+	return true
+}
+
+// isWebSocketOriginAllowed - Checks the origin against the allowed ones (if
+// any), the requests without origin are always allowed.
+func isWebSocketOriginAllowed(allowedOrigins []string, origin string) bool {
+	if len(allowedOrigins) == 0 || origin == "" {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	for _, v := range allowedOrigins {
+		if ok, _ := path.Match(strings.ToLower(strings.TrimSpace(v)), origin); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// acquireWebSocket - Reserves a connection for the domain, returning false
+// when there are already too many.
+func (rc RequestCall) acquireWebSocket() (func(), bool) {
+	domainID := rc.DomainConfig.Server.Upstream.GetDomainID()
+	value, _ := wsConnections.LoadOrStore(domainID, &atomic.Int64{})
+	counter := value.(*atomic.Int64)
+
+	maxConnections := int64(rc.DomainConfig.Server.WebSocket.MaxConnections)
+	if open := counter.Add(1); maxConnections > 0 && open > maxConnections {
+		counter.Add(-1)
+		return nil, false
+	}
+
+	return func() { counter.Add(-1) }, true
+}
+
+func (rc RequestCall) rejectWebSocket(ctx context.Context, statusCode int, reason string) {
+	metrics.IncWebSocketRejected(rc.GetHostname(), reason)
+
+	rc.Response.ForceWriteHeader(statusCode)
+	_ = rc.Response.WriteBody(http.StatusText(statusCode) + "\n")
+
+	telemetry.From(ctx).RegisterStatusCode(statusCode)
+}
+
 func (rc RequestCall) serveReverseProxyWS(ctx context.Context) {
 	tracingSpan := tracing.NewChildSpan(ctx, "handler.serve_reverse_proxy_ws")
 	defer tracingSpan.End()
@@ -50,7 +145,24 @@ func (rc RequestCall) serveReverseProxyWS(ctx context.Context) {
 
 	telemetry.From(ctx).RegisterRequestUpstream(proxyURL, enableCachedResponse, cache.StatusLabel[cache.StatusMiss])
 
-	proxy := wsutil.NewSingleHostReverseProxy(&proxyURL)
+	// The handshake is an HTTP request.
+	switch proxyURL.Scheme {
+	case SchemeWS:
+		proxyURL.Scheme = SchemeHTTP
+	case SchemeWSS:
+		proxyURL.Scheme = SchemeHTTPS
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(&proxyURL)
+	// The upgrade requires HTTP/1.1 (whatever the upstream protocol is).
+	proxy.Transport, err = rc.patchProxyTransport()
+	if err != nil {
+		tracing.SetErrorAndFail(tracingSpan, err, "internal error")
+
+		rc.GetLogger().Errorf("Cannot load the upstream TLS configuration: %s", err)
+		rc.SendBadGateway(ctx)
+		return
+	}
 
 	originalDirector := proxy.Director
 	gpcDirector := rc.ProxyDirector(ctx)
@@ -61,9 +173,35 @@ func (rc RequestCall) serveReverseProxyWS(ctx context.Context) {
 		gpcDirector(req)
 	}
 
-	transport := rc.patchProxyTransport()
-	proxy.Dial = transport.Dial //nolint:staticcheck SA1019
-	proxy.TLSClientConfig = transport.TLSClientConfig
+	var conn *wsConn
+	proxy.ModifyResponse = func(res *http.Response) error {
+		if res.StatusCode != http.StatusSwitchingProtocols {
+			return nil
+		}
+
+		rc.Response.StatusCode = res.StatusCode
+
+		// The server's timeouts are replaced by the connection's ones.
+		controller := http.NewResponseController(rc.Response.ResponseWriter)
+		_ = controller.SetReadDeadline(time.Time{})
+		_ = controller.SetWriteDeadline(time.Time{})
+
+		// Otherwise the proxy fails the upgrade.
+		if body, ok := res.Body.(io.ReadWriteCloser); ok {
+			conn = rc.newWSConn(body)
+			res.Body = conn
+		}
+
+		return nil
+	}
+
+	// Nothing is buffered: the handshake's errors are sent right away, then
+	// the connection is hijacked.
+	rc.Response.StartStreaming()
 
 	proxy.ServeHTTP(rc.Response, &rc.Request)
+
+	if conn != nil {
+		conn.Done()
+	}
 }
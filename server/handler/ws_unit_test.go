@@ -0,0 +1,212 @@
+//go:build all || unit
+// +build all unit
+
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/server/balancer"
+)
+
+func TestIsWebSocketRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/chat", nil)
+	assert.False(t, IsWebSocketRequest(req))
+
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "WebSocket")
+	assert.True(t, IsWebSocketRequest(req))
+
+	req.Header.Set("Upgrade", "h2c")
+	assert.False(t, IsWebSocketRequest(req))
+}
+
+func TestIsWebSocketOriginAllowed(t *testing.T) {
+	allowedOrigins := []string{"https://example.com", "https://*.example.org"}
+
+	assert.True(t, isWebSocketOriginAllowed(nil, "https://evil.com"))
+	assert.True(t, isWebSocketOriginAllowed(allowedOrigins, ""))
+	assert.True(t, isWebSocketOriginAllowed(allowedOrigins, "https://example.com"))
+	assert.True(t, isWebSocketOriginAllowed(allowedOrigins, "https://WWW.example.org"))
+	assert.False(t, isWebSocketOriginAllowed(allowedOrigins, "http://example.com"))
+	assert.False(t, isWebSocketOriginAllowed(allowedOrigins, "https://example.org"))
+	assert.False(t, isWebSocketOriginAllowed(allowedOrigins, "https://evil.com"))
+}
+
+func TestWSFrameReader(t *testing.T) {
+	messages := 0
+	codes := []int{}
+	f := &wsFrameReader{onMessage: func() { messages++ }, onClose: func(code int) { codes = append(codes, code) }}
+
+	// Masked text frame, fragmented (first frame + continuation), sent byte by byte.
+	frames := []byte{0x01, 0x83, 1, 2, 3, 4, 'a' ^ 1, 'b' ^ 2, 'c' ^ 3}
+	frames = append(frames, 0x80, 0x02, 'd', 'e')
+	for _, b := range frames {
+		f.Feed([]byte{b})
+	}
+	assert.Equal(t, 1, messages)
+	assert.True(t, f.AtBoundary())
+
+	// Ping, then a binary frame with 16-bit length.
+	f.Feed([]byte{0x89, 0x00})
+	f.Feed(append([]byte{0x82, 126, 0x01, 0x00}, make([]byte, 256)...))
+	assert.Equal(t, 2, messages)
+
+	// Close frames: masked with code, without code.
+	f.Feed(wsCloseFrame(4000, true))
+	f.Feed([]byte{0x88, 0x00})
+	assert.Equal(t, []int{4000, wsCloseNoStatus}, codes)
+
+	// Partial header.
+	f.Feed([]byte{0x81})
+	assert.False(t, f.AtBoundary())
+}
+
+// serveWS - Proxies the WebSocket connections through HandleWSRequestAndProxy
+// to an upstream echoing the frames back (each host has its own limits).
+func TestGetCloseCodeLabel(t *testing.T) {
+	assert.Equal(t, "1000", getCloseCodeLabel(1000))
+	assert.Equal(t, "1006", getCloseCodeLabel(wsCloseAbnormal))
+	assert.Equal(t, "1015", getCloseCodeLabel(1015))
+	assert.Equal(t, "other", getCloseCodeLabel(1004))
+	assert.Equal(t, "other", getCloseCodeLabel(1016))
+	assert.Equal(t, "other", getCloseCodeLabel(2999))
+	assert.Equal(t, "3000-3999", getCloseCodeLabel(3001))
+	assert.Equal(t, "4000-4999", getCloseCodeLabel(4999))
+	assert.Equal(t, "other", getCloseCodeLabel(65535))
+}
+
+func serveWS(host string, webSocket config.WebSocket) (*httptest.Server, func()) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		_ = brw.Flush()
+
+		_, _ = io.Copy(conn, brw)
+	}))
+
+	upstreamConfig := config.Upstream{
+		Host:      host,
+		Scheme:    "ws",
+		Endpoints: []string{strings.TrimPrefix(upstream.URL, "http://")},
+	}
+	balancer.InitRoundRobin(upstreamConfig.GetDomainID(), upstreamConfig, false)
+
+	front := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := NewRequestCall(w, r)
+		rc.DomainConfig = config.Configuration{Server: config.Server{Upstream: upstreamConfig, WebSocket: webSocket}}
+
+		rc.HandleWSRequestAndProxy(context.Background())
+	}))
+
+	return front, func() {
+		front.Close()
+		upstream.Close()
+	}
+}
+
+// dialWS - Opens a WebSocket connection, returning the handshake's response.
+func dialWS(t *testing.T, front *httptest.Server, origin string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(front.URL, "http://"))
+	assert.Nil(t, err)
+
+	_, err = conn.Write([]byte("GET /chat HTTP/1.1\r\nHost: ws.example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nOrigin: " + origin + "\r\n\r\n"))
+	assert.Nil(t, err)
+
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	assert.Nil(t, err)
+
+	return conn, br, res
+}
+
+func TestHandleWSRequestAndProxyEchoes(t *testing.T) {
+	front, closeAll := serveWS("echo.example.com", config.WebSocket{})
+	defer closeAll()
+
+	conn, br, res := dialWS(t, front, "https://example.com")
+	defer conn.Close()
+
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+
+	frame := []byte{0x81, 0x85, 1, 2, 3, 4, 'h' ^ 1, 'e' ^ 2, 'l' ^ 3, 'l' ^ 4, 'o' ^ 1}
+	_, err := conn.Write(frame)
+	assert.Nil(t, err)
+
+	echo := make([]byte, len(frame))
+	_, err = io.ReadFull(br, echo)
+	assert.Nil(t, err)
+	assert.Equal(t, frame, echo)
+}
+
+func TestHandleWSRequestAndProxyIdleTimeout(t *testing.T) {
+	front, closeAll := serveWS("idle.example.com", config.WebSocket{IdleTimeout: 100 * time.Millisecond})
+	defer closeAll()
+
+	conn, br, res := dialWS(t, front, "")
+	defer conn.Close()
+
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+
+	// The client is told the server is going away, then disconnected.
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	data, err := io.ReadAll(br)
+	assert.Nil(t, err)
+	assert.Equal(t, wsCloseFrame(wsCloseGoingAway, false), data)
+}
+
+func TestHandleWSRequestAndProxyMaxConnections(t *testing.T) {
+	front, closeAll := serveWS("limit.example.com", config.WebSocket{MaxConnections: 1})
+	defer closeAll()
+
+	conn, _, res := dialWS(t, front, "")
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+
+	conn2, _, res := dialWS(t, front, "")
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	conn2.Close()
+
+	// The slot is released once the connection is closed.
+	conn.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	conn3, _, res := dialWS(t, front, "")
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+	conn3.Close()
+}
+
+func TestHandleWSRequestAndProxyDeniesOrigin(t *testing.T) {
+	front, closeAll := serveWS("origin.example.com", config.WebSocket{AllowedOrigins: []string{"https://example.com"}})
+	defer closeAll()
+
+	conn, _, res := dialWS(t, front, "https://evil.com")
+	defer conn.Close()
+
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+}
@@ -0,0 +1,362 @@
+package handler
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fabiocicerchia/go-proxy-cache/telemetry/metrics"
+)
+
+// wsOpcodeClose - Close frame's opcode (RFC 6455, Section 5.2), the control
+// frames have the opcodes from it onwards.
+const wsOpcodeClose = 0x8
+
+// WebSocket close codes (RFC 6455, Section 7.4.1).
+const (
+	// wsCloseGoingAway - Sent when the connection times out.
+	wsCloseGoingAway = 1001
+	// wsCloseNoStatus - Close frame without code.
+	wsCloseNoStatus = 1005
+	// wsCloseAbnormal - Connection closed without close frame.
+	wsCloseAbnormal = 1006
+)
+
+// getCloseCodeLabel - Returns the metric's label of the close code: the
+// codes registered by the RFC (and IANA) as they are, the others by range
+// (so the clients can't flood the metrics with their own codes).
+func getCloseCodeLabel(code int) string {
+	switch {
+	case code >= 1000 && code <= 1015 && code != 1004:
+		return strconv.Itoa(code)
+	case code >= 3000 && code <= 3999:
+		return "3000-3999"
+	case code >= 4000 && code <= 4999:
+		return "4000-4999"
+	}
+
+	return "other"
+}
+
+// Directions of the WebSocket traffic.
+const (
+	wsDirectionUpstream   = "upstream"
+	wsDirectionDownstream = "downstream"
+)
+
+// wsFrameReader - Follows the frames in one direction of the connection,
+// tracking the messages and the close codes (the data is not altered).
+type wsFrameReader struct {
+	header    []byte
+	inPayload bool
+	fin       bool
+	opcode    byte
+	mask      []byte
+	remaining uint64
+	offset    uint64
+	payload   []byte
+	onMessage func()
+	onClose   func(code int)
+}
+
+// wsHeaderLen - Returns the length of the frame's header (it needs the
+// first two bytes).
+func wsHeaderLen(header []byte) int {
+	if len(header) < 2 {
+		return 2
+	}
+
+	n := 2
+	switch header[1] & 0x7f {
+	case 126:
+		n += 2
+	case 127:
+		n += 8
+	}
+
+	if header[1]&0x80 != 0 {
+		n += 4
+	}
+
+	return n
+}
+
+// Feed - Processes the data sent in the direction.
+func (f *wsFrameReader) Feed(p []byte) {
+	for len(p) > 0 {
+		if !f.inPayload {
+			f.header = append(f.header, p[0])
+			p = p[1:]
+
+			if len(f.header) == wsHeaderLen(f.header) {
+				f.parseHeader()
+			}
+
+			continue
+		}
+
+		n := f.remaining
+		if uint64(len(p)) < n {
+			n = uint64(len(p))
+		}
+
+		// Only the close code is needed from the payload.
+		for i := uint64(0); i < n && f.opcode == wsOpcodeClose && len(f.payload) < 2; i++ {
+			b := p[i]
+			if f.mask != nil {
+				b ^= f.mask[(f.offset+i)%4]
+			}
+			f.payload = append(f.payload, b)
+		}
+
+		f.offset += n
+		f.remaining -= n
+		p = p[n:]
+
+		if f.remaining == 0 {
+			f.inPayload = false
+			f.frameDone()
+		}
+	}
+}
+
+func (f *wsFrameReader) parseHeader() {
+	h := f.header
+
+	f.fin = h[0]&0x80 != 0
+	f.opcode = h[0] & 0x0f
+	f.remaining = uint64(h[1] & 0x7f)
+
+	offset := 2
+	switch f.remaining {
+	case 126:
+		f.remaining = uint64(binary.BigEndian.Uint16(h[2:4]))
+		offset = 4
+	case 127:
+		f.remaining = binary.BigEndian.Uint64(h[2:10])
+		offset = 10
+	}
+
+	f.mask = nil
+	if h[1]&0x80 != 0 {
+		f.mask = append([]byte{}, h[offset:offset+4]...)
+	}
+
+	f.header = f.header[:0]
+	f.offset = 0
+	f.payload = f.payload[:0]
+
+	if f.remaining == 0 {
+		f.frameDone()
+		return
+	}
+
+	f.inPayload = true
+}
+
+func (f *wsFrameReader) frameDone() {
+	if f.opcode == wsOpcodeClose {
+		code := wsCloseNoStatus
+		if len(f.payload) == 2 {
+			code = int(binary.BigEndian.Uint16(f.payload))
+		}
+
+		f.onClose(code)
+		return
+	}
+
+	// Data frames (or their last continuation), the control ones are skipped.
+	if f.fin && f.opcode < wsOpcodeClose {
+		f.onMessage()
+	}
+}
+
+// AtBoundary - Checks whether a frame can be sent (i.e. none is in progress).
+func (f *wsFrameReader) AtBoundary() bool {
+	return !f.inPayload && len(f.header) == 0
+}
+
+// wsCloseFrame - Returns a close frame with the code, the ones sent to the
+// upstream are masked (as a client).
+func wsCloseFrame(code int, masked bool) []byte {
+	payload := []byte{byte(code >> 8), byte(code)}
+
+	if !masked {
+		return append([]byte{0x80 | wsOpcodeClose, byte(len(payload))}, payload...)
+	}
+
+	key := make([]byte, 4)
+	_, _ = rand.Read(key)
+
+	frame := append([]byte{0x80 | wsOpcodeClose, 0x80 | byte(len(payload))}, key...)
+	for i, b := range payload {
+		frame = append(frame, b^key[i%4])
+	}
+
+	return frame
+}
+
+// wsConn - Upgraded connection to the upstream: it's read for the client
+// (downstream) and written for the upstream. It tracks the traffic and
+// closes the connection (with a going away close frame, on both sides)
+// after its idle timeout or max lifetime.
+type wsConn struct {
+	io.ReadWriteCloser
+	server      string
+	upstream    string
+	idleTimeout time.Duration
+	idleTimer   *time.Timer
+	maxTimer    *time.Timer
+	expired     atomic.Bool
+	closeOnce   sync.Once
+	writeMu     sync.Mutex
+	toUpstream  *wsFrameReader
+	toClient    *wsFrameReader
+	closeFrame  []byte
+	closeQueued bool
+}
+
+func (rc RequestCall) newWSConn(conn io.ReadWriteCloser) *wsConn {
+	webSocket := rc.DomainConfig.Server.WebSocket
+
+	c := &wsConn{
+		ReadWriteCloser: conn,
+		server:          rc.GetHostname(),
+		upstream:        rc.GetUpstreamHost(),
+		idleTimeout:     webSocket.IdleTimeout,
+	}
+
+	c.toUpstream = &wsFrameReader{onMessage: c.onMessage(wsDirectionUpstream), onClose: c.recordClose}
+	c.toClient = &wsFrameReader{onMessage: c.onMessage(wsDirectionDownstream), onClose: c.recordClose}
+
+	if webSocket.IdleTimeout > 0 {
+		c.idleTimer = time.AfterFunc(webSocket.IdleTimeout, c.expire)
+	}
+
+	if webSocket.MaxLifetime > 0 {
+		c.maxTimer = time.AfterFunc(webSocket.MaxLifetime, c.expire)
+	}
+
+	metrics.IncWebSocketConnections(c.server, c.upstream)
+
+	return c
+}
+
+func (c *wsConn) onMessage(direction string) func() {
+	return func() {
+		metrics.IncWebSocketMessages(c.server, c.upstream, direction)
+	}
+}
+
+// recordClose - Tracks the first close code of the connection.
+func (c *wsConn) recordClose(code int) {
+	c.closeOnce.Do(func() {
+		metrics.IncWebSocketCloseCode(c.server, c.upstream, getCloseCodeLabel(code))
+	})
+}
+
+// expire - Says goodbye to the upstream and closes its connection, the
+// pending read sends the close frame to the client.
+func (c *wsConn) expire() {
+	c.expired.Store(true)
+	c.recordClose(wsCloseGoingAway)
+
+	c.writeMu.Lock()
+	if c.toUpstream.AtBoundary() {
+		_, _ = c.ReadWriteCloser.Write(wsCloseFrame(wsCloseGoingAway, true))
+	}
+	c.writeMu.Unlock()
+
+	_ = c.ReadWriteCloser.Close()
+}
+
+// touch - Postpones the idle timeout.
+func (c *wsConn) touch() {
+	if c.idleTimer != nil {
+		c.idleTimer.Reset(c.idleTimeout)
+	}
+}
+
+// Read - Reads from the upstream for the client.
+func (c *wsConn) Read(p []byte) (int, error) {
+	if c.closeFrame != nil {
+		n := copy(p, c.closeFrame)
+		if c.closeFrame = c.closeFrame[n:]; len(c.closeFrame) == 0 {
+			c.closeFrame = nil
+		}
+
+		return n, nil
+	}
+
+	n, err := c.ReadWriteCloser.Read(p)
+	if n > 0 {
+		c.toClient.Feed(p[:n])
+		metrics.IncWebSocketBytes(c.server, c.upstream, wsDirectionDownstream, float64(n))
+		c.touch()
+	}
+
+	if err == nil || !c.expired.Load() {
+		return n, err
+	}
+
+	if n > 0 {
+		return n, nil
+	}
+
+	if !c.closeQueued && c.toClient.AtBoundary() {
+		c.closeQueued = true
+		c.closeFrame = wsCloseFrame(wsCloseGoingAway, false)
+
+		return c.Read(p)
+	}
+
+	return 0, io.EOF
+}
+
+// Write - Writes to the upstream for the client.
+func (c *wsConn) Write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	n, err := c.ReadWriteCloser.Write(p)
+	if n > 0 {
+		c.toUpstream.Feed(p[:n])
+		metrics.IncWebSocketBytes(c.server, c.upstream, wsDirectionUpstream, float64(n))
+		c.touch()
+	}
+
+	return n, err
+}
+
+// Close - Stops the timeouts and closes the upstream's connection.
+func (c *wsConn) Close() error {
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+	}
+
+	if c.maxTimer != nil {
+		c.maxTimer.Stop()
+	}
+
+	return c.ReadWriteCloser.Close()
+}
+
+// Done - Tracks the end of the connection (once proxied).
+func (c *wsConn) Done() {
+	c.recordClose(wsCloseAbnormal)
+
+	metrics.DecWebSocketConnections(c.server, c.upstream)
+}
@@ -0,0 +1,63 @@
+//go:build all || unit
+// +build all unit
+
+package server
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInitHTTP3ServerSharesHandlerAndTLSConfig(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto+" "+r.Host)
+	})
+
+	// Only used for its (self-signed) certificate.
+	ts := httptest.NewUnstartedServer(handler)
+	ts.StartTLS()
+	defer ts.Close()
+
+	srvHTTPS := &http.Server{Addr: ":0", Handler: handler, TLSConfig: ts.TLS.Clone()}
+	srvHTTP3 := InitHTTP3Server(srvHTTPS)
+
+	assert.Equal(t, []string{http3.NextProtoH3}, srvHTTP3.TLSConfig.NextProtos)
+	assert.NotEqual(t, []string{http3.NextProtoH3}, srvHTTPS.TLSConfig.NextProtos)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	go func() { _ = srvHTTP3.Serve(conn) }()
+	defer srvHTTP3.Close()
+
+	client := &http.Client{
+		Transport: &http3.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // #nosec G402
+		},
+	}
+
+	res, err := client.Get("https://" + conn.LocalAddr().String() + "/")
+	assert.Nil(t, err)
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, 3, res.ProtoMajor)
+	assert.Equal(t, "HTTP/3.0 "+conn.LocalAddr().String(), string(body))
+}
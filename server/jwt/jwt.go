@@ -9,11 +9,14 @@ import (
 	"github.com/fabiocicerchia/go-proxy-cache/server/handler"
 	"github.com/fabiocicerchia/go-proxy-cache/utils/slice"
 	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 )
 
 var errJwkCacheNotInitialized = errors.New("JWKS cache not initialized")
 
+var errUnknownIssuer = errors.New("no provider trusted for the token issuer")
+
 func errorJson(resp http.ResponseWriter, statuscode int, error *config.JwtError) {
 	// Headers must be set before WriteHeader is called, otherwise they are
 	// ignored and the client never receives the correct Content-Type.
@@ -30,44 +33,107 @@ func logJWTErrorAndAbort(w http.ResponseWriter, err error, jwtConfig *config.Jwt
 	return http.ErrAbortHandler
 }
 
-func ValidateJWT(w http.ResponseWriter, r *http.Request, keySet jwk.Set, jwtConfig *config.Jwt) error {
-	token, err := jwt.ParseRequest(r,
-		jwt.WithKeySet(keySet),
+// ValidateJWT - Validates the token (signature, expiry, issuer, audience,
+// required claims and scope, also the ones of the matching rule), returning
+// it when valid.
+func ValidateJWT(w http.ResponseWriter, r *http.Request, keySet jwk.Set, jwtConfig *config.Jwt) (jwt.Token, error) {
+	options := []jwt.ParseOption{
+		// The static keys have neither kid nor algorithm.
+		jwt.WithKeySet(keySet, jws.WithRequireKid(false), jws.WithInferAlgorithmFromKey(true)),
 		jwt.WithValidate(true),
 		jwt.WithTypedClaim("scope", json.RawMessage{}),
 		jwt.WithTypedClaim("scp", json.RawMessage{}),
-	)
+	}
+	if jwtConfig.Issuer != "" {
+		options = append(options, jwt.WithIssuer(jwtConfig.Issuer))
+	}
+
+	token, err := jwt.ParseRequest(r, options...)
 	if err != nil {
-		return logJWTErrorAndAbort(w, err, jwtConfig)
+		return nil, logJWTErrorAndAbort(w, err, jwtConfig)
 	}
 
 	if err := jwt.Validate(token); err != nil {
-		return logJWTErrorAndAbort(w, err, jwtConfig)
+		return nil, logJWTErrorAndAbort(w, err, jwtConfig)
+	}
+
+	if len(jwtConfig.Audiences) > 0 && !haveAllowedAudience(token.Audience(), jwtConfig.Audiences) {
+		errorJson(w, http.StatusUnauthorized, &config.JwtError{ErrorCode: "InvalidAudience", ErrorDescription: "Invalid Audience"})
+		return nil, http.ErrAbortHandler
+	}
+
+	requiredClaims, allowedScopes := getRequirements(jwtConfig, r)
+
+	if claim, ok := haveRequiredClaims(token, requiredClaims); !ok {
+		errorJson(w, http.StatusUnauthorized, &config.JwtError{ErrorCode: "InvalidClaim", ErrorDescription: "Invalid Claim: " + claim})
+		return nil, http.ErrAbortHandler
 	}
 
 	scopes := getScopes(token)
-	haveAllowedScope := haveAllowedScope(scopes, jwtConfig.AllowedScopes)
+	haveAllowedScope := haveAllowedScope(scopes, allowedScopes)
 	if !haveAllowedScope {
 		errorJson(w, http.StatusUnauthorized, &config.JwtError{ErrorCode: "InvalidScope", ErrorDescription: "Invalid Scope"})
-		return http.ErrAbortHandler
+		return nil, http.ErrAbortHandler
 	}
 
-	return nil
+	return token, nil
 }
 
-func getKeySet(w http.ResponseWriter, jwtConfig *config.Jwt) (jwk.Set, error) {
-	// Fail closed: a configured JWKS URL with an uninitialised cache is a
-	// misconfiguration, not a reason to bypass validation.
-	if jwtConfig.JwkCache == nil {
-		return nil, logJWTErrorAndAbort(w, errJwkCacheNotInitialized, jwtConfig)
+// getRequirements - Returns the required claims and the allowed scopes: the
+// rule matching the request adds its claims and replaces the scopes.
+func getRequirements(jwtConfig *config.Jwt, r *http.Request) (map[string]string, []string) {
+	rule, found := jwtConfig.GetRule(r.Method, r.URL.Path)
+	if !found {
+		return jwtConfig.RequiredClaims, jwtConfig.AllowedScopes
 	}
 
-	keySet, err := jwtConfig.JwkCache.Get(jwtConfig.Context, jwtConfig.JwksUrl)
-	if err != nil {
-		return keySet, logJWTErrorAndAbort(w, err, jwtConfig)
+	requiredClaims := make(map[string]string, len(jwtConfig.RequiredClaims)+len(rule.Claims))
+	for k, v := range jwtConfig.RequiredClaims {
+		requiredClaims[k] = v
+	}
+	for k, v := range rule.Claims {
+		requiredClaims[k] = v
+	}
+
+	allowedScopes := jwtConfig.AllowedScopes
+	if len(rule.Scopes) > 0 {
+		allowedScopes = rule.Scopes
+	}
+
+	return requiredClaims, allowedScopes
+}
+
+// getKeySet - Returns the keys of the providers trusted for the token's
+// issuer, only the one matching the token's kid (when found).
+func getKeySet(w http.ResponseWriter, r *http.Request, jwtConfig *config.Jwt) (jwk.Set, error) {
+	issuer, keyID := peekToken(r)
+
+	providers := selectProviders(jwtConfig.GetProviders(), issuer)
+	if len(providers) == 0 {
+		return nil, logJWTErrorAndAbort(w, errUnknownIssuer, jwtConfig)
 	}
 
-	return keySet, nil
+	keySet := jwk.NewSet()
+	for _, v := range providers {
+		if v.JwksUrl != "" {
+			// Fail closed: a configured JWKS URL with an uninitialised cache is a
+			// misconfiguration, not a reason to bypass validation.
+			if jwtConfig.JwkCache == nil {
+				return nil, logJWTErrorAndAbort(w, errJwkCacheNotInitialized, jwtConfig)
+			}
+
+			remoteKeySet, err := jwtConfig.JwkCache.Get(jwtConfig.Context, v.JwksUrl)
+			if err != nil {
+				return nil, logJWTErrorAndAbort(w, err, jwtConfig)
+			}
+
+			addKeys(keySet, remoteKeySet)
+		}
+
+		addKeys(keySet, v.GetKeySet())
+	}
+
+	return selectKey(keySet, keyID), nil
 }
 
 func JWTHandler(next http.Handler) http.Handler {
@@ -75,22 +141,38 @@ func JWTHandler(next http.Handler) http.Handler {
 		rc := handler.NewRequestCall(w, r)
 		domainConfig, isDomainFound := config.DomainConf(r.Host, rc.GetScheme())
 
-		// JWT validation applies only when a JWKS URL is configured for the
-		// matched domain. Without this guard every request on a JWT-less setup
-		// hit getKeySet with a nil JwkCache (panic) or an empty JWKS URL
-		// (unconditional 401), taking the whole proxy down.
-		jwtEnabled := isDomainFound && domainConfig.Jwt.JwksUrl != ""
+		// JWT validation applies only when a JWKS URL (or a provider) is
+		// configured for the matched domain. Without this guard every request
+		// on a JWT-less setup hit getKeySet with a nil JwkCache (panic) or an
+		// empty JWKS URL (unconditional 401), taking the whole proxy down.
+		jwtEnabled := isDomainFound && domainConfig.Jwt.IsEnabled()
+
+		// The exclusions and the rules are matched like the locations, i.e.
+		// on the rewritten path.
+		path := r.URL.Path
+		if jwtEnabled {
+			rc.DomainConfig = domainConfig
+			path = rc.GetRewrittenPath()
+		}
 
-		if jwtEnabled && !IsExcluded(domainConfig.Jwt.ExcludedPaths, r.URL.Path) {
-			keySet, err := getKeySet(w, &domainConfig.Jwt)
+		if jwtEnabled && !IsExcluded(domainConfig.Jwt.ExcludedPaths, path) {
+			keySet, err := getKeySet(w, r, &domainConfig.Jwt)
 			if err != nil {
 				return
 			}
 
-			err = ValidateJWT(w, r, keySet, &domainConfig.Jwt)
+			token, err := ValidateJWT(w, withPath(r, path), keySet, &domainConfig.Jwt)
 			if err != nil {
 				return
 			}
+
+			rule, _ := domainConfig.Jwt.GetRule(r.Method, path)
+
+			r = handler.WithJWTAuth(r, handler.JWTAuth{
+				Subject: token.Subject(),
+				Public:  rule.Public,
+				Headers: getClaimsHeaders(token, domainConfig.Jwt.ClaimsHeaders),
+			})
 		}
 
 		next.ServeHTTP(w, r)
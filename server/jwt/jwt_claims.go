@@ -0,0 +1,108 @@
+package jwt
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/fabiocicerchia/go-proxy-cache/utils/slice"
+)
+
+func haveAllowedAudience(audiences []string, allowedAudiences []string) bool {
+	for _, v := range allowedAudiences {
+		if slice.ContainsString(audiences, v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// haveRequiredClaims - Checks the claims' values (an array claim must contain
+// the value), returning the first failing claim.
+func haveRequiredClaims(token jwt.Token, requiredClaims map[string]string) (string, bool) {
+	names := make([]string, 0, len(requiredClaims))
+	for k := range requiredClaims {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, found := token.Get(name)
+		if !found {
+			return name, false
+		}
+
+		expected := requiredClaims[name]
+		if expected != "" && !slice.ContainsString(getClaimValues(value), expected) {
+			return name, false
+		}
+	}
+
+	return "", true
+}
+
+// getClaimValues - Converts a claim to a list of strings (one per item when
+// it's an array).
+func getClaimValues(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			values = append(values, getClaimValues(item)...)
+		}
+
+		return values
+	case json.RawMessage:
+		var raw interface{}
+		if err := json.Unmarshal(v, &raw); err != nil {
+			return []string{}
+		}
+
+		return getClaimValues(raw)
+	case time.Time:
+		return []string{strconv.FormatInt(v.Unix(), 10)}
+	case map[string]interface{}:
+		encoded, _ := json.Marshal(v)
+
+		return []string{string(encoded)}
+	default:
+		return []string{fmt.Sprint(v)}
+	}
+}
+
+// getClaimsHeaders - Returns the headers carrying the mapped claims of the
+// token (the missing claims are skipped), array claims are comma-separated.
+func getClaimsHeaders(token jwt.Token, claimsHeaders map[string]string) http.Header {
+	header := http.Header{}
+
+	for claim, name := range claimsHeaders {
+		value, found := token.Get(claim)
+		if !found {
+			continue
+		}
+
+		header.Set(name, strings.Join(getClaimValues(value), ","))
+	}
+
+	return header
+}
@@ -0,0 +1,95 @@
+package jwt
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+// peekToken - Returns the issuer and the key ID of the (not yet verified)
+// bearer token, used only to pick its keys.
+func peekToken(r *http.Request) (string, string) {
+	authorization := r.Header.Get("Authorization")
+	if len(authorization) < len("Bearer ") || !strings.EqualFold(authorization[:len("Bearer ")], "Bearer ") {
+		return "", ""
+	}
+
+	raw := []byte(strings.TrimSpace(authorization[len("Bearer "):]))
+
+	keyID := ""
+	if msg, err := jws.Parse(raw); err == nil && len(msg.Signatures()) > 0 {
+		keyID = msg.Signatures()[0].ProtectedHeaders().KeyID()
+	}
+
+	issuer := ""
+	if token, err := jwt.ParseInsecure(raw); err == nil {
+		issuer = token.Issuer()
+	}
+
+	return issuer, keyID
+}
+
+// selectProviders - Returns the providers of the issuer, or the issuer-less
+// ones when no provider matches.
+func selectProviders(providers []config.JwtProvider, issuer string) []config.JwtProvider {
+	matching := []config.JwtProvider{}
+	fallback := []config.JwtProvider{}
+
+	for _, v := range providers {
+		switch v.Issuer {
+		case "":
+			fallback = append(fallback, v)
+		case issuer:
+			matching = append(matching, v)
+		}
+	}
+
+	if len(matching) > 0 {
+		return matching
+	}
+
+	return fallback
+}
+
+func addKeys(dst jwk.Set, src jwk.Set) {
+	if src == nil {
+		return
+	}
+
+	for i := 0; i < src.Len(); i++ {
+		key, _ := src.Key(i)
+		_ = dst.AddKey(key)
+	}
+}
+
+// selectKey - Narrows the keys to the one with the token's kid, all of them
+// are tried when the kid is missing (or unknown, e.g. static keys).
+func selectKey(keySet jwk.Set, keyID string) jwk.Set {
+	if keyID == "" {
+		return keySet
+	}
+
+	key, found := keySet.LookupKeyID(keyID)
+	if !found {
+		return keySet
+	}
+
+	selected := jwk.NewSet()
+	_ = selected.AddKey(key)
+
+	return selected
+}
@@ -0,0 +1,198 @@
+//go:build all || unit
+// +build all unit
+
+package jwt
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+func generatePublicKeyPEM(t *testing.T) (*rsa.PrivateKey, string) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	assert.Nil(t, err)
+
+	return privateKey, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func signProviderTestToken(t *testing.T, issuer string, alg jwa.SignatureAlgorithm, key interface{}) string {
+	token := jwt.New()
+	_ = token.Set(jwt.IssuerKey, issuer)
+	_ = token.Set(jwt.ExpirationKey, time.Now().Add(1*time.Hour))
+	_ = token.Set("scope", []string{"scope1"})
+
+	signed, err := jwt.Sign(token, jwt.WithKey(alg, key))
+	assert.Nil(t, err)
+
+	return string(signed)
+}
+
+func validateWithProviders(providers []config.JwtProvider, token string) (int, error) {
+	jwtConfig := config.Jwt{
+		AllowedScopes: []string{"scope1"},
+		Providers:     providers,
+		Logger:        log.New(),
+	}
+	config.InitJWT(&jwtConfig)
+
+	req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+	req.Header.Add("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+
+	keySet, err := getKeySet(w, req, &jwtConfig)
+	if err != nil {
+		return w.Code, err
+	}
+
+	_, err = ValidateJWT(w, req, keySet, &jwtConfig)
+
+	return w.Code, err
+}
+
+func TestProviderWithSecret(t *testing.T) {
+	providers := []config.JwtProvider{{Issuer: "hmac", Secret: "s3cr3t"}}
+
+	_, err := validateWithProviders(providers, signProviderTestToken(t, "hmac", jwa.HS256, []byte("s3cr3t")))
+	assert.Nil(t, err)
+
+	_, err = validateWithProviders(providers, signProviderTestToken(t, "hmac", jwa.HS512, []byte("s3cr3t")))
+	assert.Nil(t, err)
+
+	code, err := validateWithProviders(providers, signProviderTestToken(t, "hmac", jwa.HS256, []byte("wrong")))
+	assert.NotNil(t, err)
+	assert.Equal(t, 401, code)
+}
+
+func TestProviderWithInlinePublicKey(t *testing.T) {
+	privateKey, publicKeyPEM := generatePublicKeyPEM(t)
+	providers := []config.JwtProvider{{Issuer: "pem", PublicKeys: []string{publicKeyPEM}}}
+
+	_, err := validateWithProviders(providers, signProviderTestToken(t, "pem", jwa.RS256, privateKey))
+	assert.Nil(t, err)
+
+	otherKey, _ := generatePublicKeyPEM(t)
+	_, err = validateWithProviders(providers, signProviderTestToken(t, "pem", jwa.RS256, otherKey))
+	assert.NotNil(t, err)
+}
+
+func TestProviderWithPublicKeyFile(t *testing.T) {
+	privateKey, publicKeyPEM := generatePublicKeyPEM(t)
+
+	file := filepath.Join(t.TempDir(), "public.pem")
+	assert.Nil(t, os.WriteFile(file, []byte(publicKeyPEM), 0o600))
+
+	providers := []config.JwtProvider{{PublicKeys: []string{file}}}
+
+	_, err := validateWithProviders(providers, signProviderTestToken(t, "any", jwa.RS256, privateKey))
+	assert.Nil(t, err)
+}
+
+func TestProviderSelectedByIssuer(t *testing.T) {
+	privateKeyA, publicKeyA := generatePublicKeyPEM(t)
+	privateKeyB, publicKeyB := generatePublicKeyPEM(t)
+
+	providers := []config.JwtProvider{
+		{Issuer: "issuer-a", PublicKeys: []string{publicKeyA}},
+		{Issuer: "issuer-b", PublicKeys: []string{publicKeyB}},
+	}
+
+	_, err := validateWithProviders(providers, signProviderTestToken(t, "issuer-a", jwa.RS256, privateKeyA))
+	assert.Nil(t, err)
+
+	_, err = validateWithProviders(providers, signProviderTestToken(t, "issuer-b", jwa.RS256, privateKeyB))
+	assert.Nil(t, err)
+
+	// Signed by a trusted key, but not the issuer's one.
+	_, err = validateWithProviders(providers, signProviderTestToken(t, "issuer-a", jwa.RS256, privateKeyB))
+	assert.NotNil(t, err)
+
+	req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+	req.Header.Add("Authorization", "Bearer "+signProviderTestToken(t, "issuer-c", jwa.RS256, privateKeyA))
+	w := httptest.NewRecorder()
+
+	_, err = getKeySet(w, req, &config.Jwt{Providers: providers, Logger: log.New()})
+	assert.NotNil(t, err)
+	assert.Equal(t, 401, w.Code)
+	assert.Contains(t, w.Body.String(), errUnknownIssuer.Error())
+}
+
+func TestProviderIssuerLessFallback(t *testing.T) {
+	privateKeyA, publicKeyA := generatePublicKeyPEM(t)
+	privateKeyB, publicKeyB := generatePublicKeyPEM(t)
+
+	providers := []config.JwtProvider{
+		{Issuer: "issuer-a", PublicKeys: []string{publicKeyA}},
+		{PublicKeys: []string{publicKeyB}},
+	}
+
+	_, err := validateWithProviders(providers, signProviderTestToken(t, "issuer-c", jwa.RS256, privateKeyB))
+	assert.Nil(t, err)
+
+	_, err = validateWithProviders(providers, signProviderTestToken(t, "issuer-c", jwa.RS256, privateKeyA))
+	assert.NotNil(t, err)
+}
+
+func TestProviderSelectedByKeyID(t *testing.T) {
+	privateKey1, _ := rsa.GenerateKey(rand.Reader, 2048)
+	privateKey2, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key1, keySet1, _ := generateTestJWKSingleKey(privateKey1, &privateKey1.PublicKey, "kid-1")
+	key2, keySet2, _ := generateTestJWKSingleKey(privateKey2, &privateKey2.PublicKey, "kid-2")
+
+	jwks1, _ := json.Marshal(keySet1)
+	jwks2, _ := json.Marshal(keySet2)
+
+	providers := []config.JwtProvider{{Issuer: "jwk", PublicKeys: []string{string(jwks1), string(jwks2)}}}
+
+	_, err := validateWithProviders(providers, signProviderTestToken(t, "jwk", jwa.RS256, key2))
+	assert.Nil(t, err)
+
+	_, err = validateWithProviders(providers, signProviderTestToken(t, "jwk", jwa.RS256, key1))
+	assert.Nil(t, err)
+
+	// The kid selects the key: another key cannot verify it.
+	forged, _ := jwk.FromRaw(privateKey1)
+	_ = forged.Set(jwk.KeyIDKey, "kid-2")
+	_, err = validateWithProviders(providers, signProviderTestToken(t, "jwk", jwa.RS256, forged))
+	assert.NotNil(t, err)
+}
+
+func TestSelectProviders(t *testing.T) {
+	providers := []config.JwtProvider{
+		{Issuer: "a", Secret: "1"},
+		{Secret: "2"},
+		{Issuer: "a", Secret: "3"},
+	}
+
+	assert.Equal(t, []config.JwtProvider{providers[0], providers[2]}, selectProviders(providers, "a"))
+	assert.Equal(t, []config.JwtProvider{providers[1]}, selectProviders(providers, "b"))
+	assert.Equal(t, []config.JwtProvider{providers[1]}, selectProviders(providers, ""))
+	assert.Empty(t, selectProviders(providers[:1], "b"))
+}
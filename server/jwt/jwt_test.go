@@ -17,11 +17,14 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"encoding/json"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
@@ -82,7 +85,7 @@ func TestValidateJWTWithoutAnyToken(t *testing.T) {
 	publicKey := &privateKey.PublicKey
 	_, keySet, _ := generateTestJWKMultipleKeys(privateKey, publicKey, "key-id-multiple", 1)
 
-	err := ValidateJWT(w, req, keySet, &jwtConfig)
+	_, err := ValidateJWT(w, req, keySet, &jwtConfig)
 
 	assert.NotNil(t, err)
 	assert.Equal(t, w.Code, 401, "No token provided status code should be 401")
@@ -100,7 +103,7 @@ func TestValidateJWTWithoutAnyKeySet(t *testing.T) {
 	w := httptest.NewRecorder()
 	req.Header.Add("Authorization", "Bearer "+scpExpiredToken)
 
-	_, err := getKeySet(w, &jwtConfig)
+	_, err := getKeySet(w, req, &jwtConfig)
 
 	assert.NotNil(t, err)
 	assert.Equal(t, w.Code, 401, "failed to unmarshal JWK set: EOF")
@@ -117,7 +120,7 @@ func TestValidateJWTWithAnExpiredToken(t *testing.T) {
 	w := httptest.NewRecorder()
 	req.Header.Add("Authorization", "Bearer "+scpExpiredToken)
 
-	err := ValidateJWT(w, req, keySet, &jwtConfig)
+	_, err := ValidateJWT(w, req, keySet, &jwtConfig)
 
 	assert.NotNil(t, err)
 	assert.Equal(t, w.Code, 401, "exp not satisfied")
@@ -135,7 +138,7 @@ func TestValidateJWTWithoutAnyScopeInTheConfig(t *testing.T) {
 	w := httptest.NewRecorder()
 	req.Header.Add("Authorization", "Bearer "+scopeGoodToken)
 
-	err := ValidateJWT(w, req, keySet, &jwtConfig)
+	_, err := ValidateJWT(w, req, keySet, &jwtConfig)
 
 	assert.NotNil(t, err)
 	assert.Equal(t, w.Code, 401, "Invalid Scope")
@@ -155,9 +158,9 @@ func TestValidateJWTWithScopeConfigAndScopeClaimToken(t *testing.T) {
 	w := httptest.NewRecorder()
 	req.Header.Add("Authorization", "Bearer "+scopeGoodToken)
 
-	keySet, err := getKeySet(w, &jwtConfig)
+	keySet, err := getKeySet(w, req, &jwtConfig)
 	assert.Nil(t, err)
-	err = ValidateJWT(w, req, keySet, &jwtConfig)
+	_, err = ValidateJWT(w, req, keySet, &jwtConfig)
 
 	assert.Nil(t, err)
 	assert.Equal(t, w.Code, 200, "Status OK")
@@ -177,9 +180,9 @@ func TestValidateJWTWithScopeConfigAndScpClaimToken(t *testing.T) {
 	w := httptest.NewRecorder()
 	req.Header.Add("Authorization", "Bearer "+scpGoodToken)
 
-	keySet, err := getKeySet(w, &jwtConfig)
+	keySet, err := getKeySet(w, req, &jwtConfig)
 	assert.Nil(t, err)
-	err = ValidateJWT(w, req, keySet, &jwtConfig)
+	_, err = ValidateJWT(w, req, keySet, &jwtConfig)
 
 	assert.Nil(t, err)
 	assert.Equal(t, w.Code, 200, "Status OK")
@@ -199,9 +202,9 @@ func TestValidateJWTWithMultipleKeysInKeySet(t *testing.T) {
 	w := httptest.NewRecorder()
 	req.Header.Add("Authorization", "Bearer "+scopeGoodTokenMultiple)
 
-	keySet, err := getKeySet(w, &jwtConfig)
+	keySet, err := getKeySet(w, req, &jwtConfig)
 	assert.Nil(t, err)
-	err = ValidateJWT(w, req, keySet, &jwtConfig)
+	_, err = ValidateJWT(w, req, keySet, &jwtConfig)
 
 	assert.Nil(t, err)
 	assert.Equal(t, w.Code, 200, "Status OK")
@@ -254,9 +257,10 @@ func TestRefreshKeySet(t *testing.T) {
 	config.InitJWT(&domainConf.Jwt)
 	config.Config.Domains["example_com"] = domainConf
 	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://example.com/foo", nil)
 	jwtConfig = domainConf.Jwt
 
-	keySet1, err := getKeySet(w, &jwtConfig)
+	keySet1, err := getKeySet(w, req, &jwtConfig)
 	assert.Nil(t, err)
 
 	ts.Close()
@@ -264,7 +268,7 @@ func TestRefreshKeySet(t *testing.T) {
 	ts = CreateTestServer(t, jsonJWKKeySetSingle2, jsonJWKKeySetMultiple2, 8081)
 	time.Sleep(time.Duration(2) * time.Second)
 
-	keySet2, err := getKeySet(w, &jwtConfig)
+	keySet2, err := getKeySet(w, req, &jwtConfig)
 	assert.Nil(t, err)
 
 	assert.NotEqualValues(t, keySet1, keySet2)
@@ -274,9 +278,233 @@ func TestRefreshKeySet(t *testing.T) {
 	ts = CreateTestServer(t, jsonJWKKeySetSingle3, jsonJWKKeySetMultiple3, 8081)
 	time.Sleep(time.Duration(2) * time.Second)
 
-	keySet3, err := getKeySet(w, &jwtConfig)
+	keySet3, err := getKeySet(w, req, &jwtConfig)
 	assert.Nil(t, err)
 
 	assert.NotEqualValues(t, keySet2, keySet3)
 	ts.Close()
 }
+
+func newClaimsTestToken(t *testing.T, claims map[string]interface{}) (string, jwk.Set) {
+	privateKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	key, keySet, _ := generateTestJWKSingleKey(privateKey, &privateKey.PublicKey, "key-id-claims")
+
+	token := jwt.New()
+	_ = token.Set(jwt.ExpirationKey, time.Now().Add(1*time.Hour))
+	_ = token.Set("scope", []string{"scope1"})
+	for k, v := range claims {
+		_ = token.Set(k, v)
+	}
+
+	signed, err := jwt.Sign(token, jwt.WithKey(jwa.RS256, key))
+	assert.Nil(t, err)
+
+	return string(signed), keySet
+}
+
+func TestValidateJWTClaims(t *testing.T) {
+	claims := map[string]interface{}{
+		jwt.IssuerKey:   "https://issuer.example.com",
+		jwt.AudienceKey: []string{"api", "web"},
+		jwt.SubjectKey:  "user-1",
+		"roles":         []string{"admin", "editor"},
+		"tenant":        "acme",
+		"verified":      true,
+	}
+
+	tests := []struct {
+		name      string
+		conf      config.Jwt
+		errorCode string
+	}{
+		{"valid", config.Jwt{
+			Issuer:         "https://issuer.example.com",
+			Audiences:      []string{"mobile", "web"},
+			RequiredClaims: map[string]string{"roles": "admin", "tenant": "acme", "verified": "true", "sub": ""},
+		}, ""},
+		{"wrong issuer", config.Jwt{Issuer: "https://other.example.com"}, "JsonWebTokenError"},
+		{"wrong audience", config.Jwt{Audiences: []string{"mobile"}}, "InvalidAudience"},
+		{"missing claim", config.Jwt{RequiredClaims: map[string]string{"email": ""}}, "InvalidClaim"},
+		{"wrong claim value", config.Jwt{RequiredClaims: map[string]string{"tenant": "other"}}, "InvalidClaim"},
+		{"missing array value", config.Jwt{RequiredClaims: map[string]string{"roles": "viewer"}}, "InvalidClaim"},
+	}
+
+	signed, keySet := newClaimsTestToken(t, claims)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			conf.AllowedScopes = []string{"scope1"}
+			conf.Logger = log.New()
+
+			req := httptest.NewRequest("GET", "http://example.com/foo", nil)
+			req.Header.Add("Authorization", "Bearer "+signed)
+			w := httptest.NewRecorder()
+
+			token, err := ValidateJWT(w, req, keySet, &conf)
+
+			if tt.errorCode == "" {
+				assert.Nil(t, err)
+				assert.Equal(t, "user-1", token.Subject())
+				return
+			}
+
+			assert.NotNil(t, err)
+			assert.Nil(t, token)
+			assert.Equal(t, 401, w.Code)
+			assert.Contains(t, w.Body.String(), tt.errorCode)
+		})
+	}
+}
+
+func TestGetClaimsHeaders(t *testing.T) {
+	signed, _ := newClaimsTestToken(t, map[string]interface{}{
+		jwt.SubjectKey: "user-1",
+		"roles":        []string{"admin", "editor"},
+		"level":        3,
+	})
+
+	token, err := jwt.ParseString(signed, jwt.WithVerify(false))
+	assert.Nil(t, err)
+
+	header := getClaimsHeaders(token, map[string]string{
+		"sub":     "X-User-Id",
+		"roles":   "X-User-Roles",
+		"level":   "X-User-Level",
+		"missing": "X-Missing",
+	})
+
+	assert.Equal(t, "user-1", header.Get("X-User-Id"))
+	assert.Equal(t, "admin,editor", header.Get("X-User-Roles"))
+	assert.Equal(t, "3", header.Get("X-User-Level"))
+	assert.NotContains(t, header, "X-Missing")
+}
+
+func TestValidateJWTRules(t *testing.T) {
+	signed, keySet := newClaimsTestToken(t, map[string]interface{}{
+		jwt.SubjectKey: "user-1",
+		"tenant":       "acme",
+	})
+
+	conf := config.Jwt{
+		AllowedScopes: []string{"scope1"},
+		Rules: []config.JwtRule{
+			{Prefix: "/admin/*", Methods: []string{"post", "DELETE"}, Scopes: []string{"admin:write"}},
+			{Prefix: "/tenant", Claims: map[string]string{"tenant": "other"}},
+			{Prefix: "/public", Public: true},
+		},
+		Logger: log.New(),
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		valid  bool
+	}{
+		{"GET", "/admin/users", true},
+		{"POST", "/admin/users", false},
+		{"DELETE", "/admin/users", false},
+		{"POST", "/admin", false},
+		{"POST", "/admin/", false},
+		{"POST", "/administrator", true},
+		{"GET", "/tenant/1", false},
+		{"GET", "/public", true},
+		{"GET", "/", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://example.com"+tt.path, nil)
+			req.Header.Add("Authorization", "Bearer "+signed)
+			w := httptest.NewRecorder()
+
+			_, err := ValidateJWT(w, req, keySet, &conf)
+			assert.Equal(t, tt.valid, err == nil)
+		})
+	}
+}
+
+func TestGetRequirements(t *testing.T) {
+	conf := &config.Jwt{
+		AllowedScopes:  []string{"read"},
+		RequiredClaims: map[string]string{"tenant": "acme", "verified": "true"},
+		Rules: []config.JwtRule{
+			{Prefix: "/admin", Scopes: []string{"admin"}, Claims: map[string]string{"tenant": "internal"}},
+			{Prefix: "/reports", Claims: map[string]string{"role": "analyst"}},
+		},
+	}
+
+	claims, scopes := getRequirements(conf, httptest.NewRequest("GET", "/admin", nil))
+	assert.Equal(t, map[string]string{"tenant": "internal", "verified": "true"}, claims)
+	assert.Equal(t, []string{"admin"}, scopes)
+
+	_, scopes = getRequirements(conf, httptest.NewRequest("GET", "/admin/", nil))
+	assert.Equal(t, []string{"admin"}, scopes)
+
+	_, scopes = getRequirements(conf, httptest.NewRequest("GET", "/administrator", nil))
+	assert.Equal(t, []string{"read"}, scopes)
+
+	claims, scopes = getRequirements(conf, httptest.NewRequest("GET", "/reports", nil))
+	assert.Equal(t, map[string]string{"tenant": "acme", "verified": "true", "role": "analyst"}, claims)
+	assert.Equal(t, []string{"read"}, scopes)
+
+	claims, scopes = getRequirements(conf, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, conf.RequiredClaims, claims)
+	assert.Equal(t, []string{"read"}, scopes)
+
+	// The domain's claims are untouched.
+	assert.Equal(t, "acme", conf.RequiredClaims["tenant"])
+}
+
+func TestJWTHandlerMatchesTheRewrittenPath(t *testing.T) {
+	defer func() { config.Config = config.Configuration{} }()
+
+	conf := config.Configuration{}
+	conf.CopyOverWith(config.Configuration{
+		Server: config.Server{
+			Upstream: config.Upstream{Host: "rewrites.example.com"},
+			Rewrites: config.Rewrites{
+				{Match: `^/legacy/(.*)$`, Replacement: "/admin/$1"},
+				{Match: `^/docs$`, Replacement: "/open/docs"},
+			},
+		},
+	}, nil)
+	conf.Jwt = config.Jwt{
+		AllowedScopes: []string{"scope1"},
+		ExcludedPaths: []string{`^/open/`},
+		Providers:     []config.JwtProvider{{Issuer: "hmac", Secret: "s3cr3t"}},
+		Rules:         []config.JwtRule{{Prefix: "/admin", Scopes: []string{"admin"}}},
+		Logger:        log.New(),
+	}
+	config.InitJWT(&conf.Jwt)
+	config.Config = conf
+
+	h := JWTHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		path   string
+		token  bool
+		status int
+	}{
+		{"/users", true, http.StatusOK},
+		// Rewritten to /admin/users, the rule requires another scope.
+		{"/legacy/users", true, http.StatusUnauthorized},
+		// Rewritten to an excluded path.
+		{"/docs", false, http.StatusOK},
+		{"/users", false, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "http://rewrites.example.com"+tt.path, nil)
+		if tt.token {
+			req.Header.Add("Authorization", "Bearer "+signProviderTestToken(t, "hmac", jwa.HS256, []byte("s3cr3t")))
+		}
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.status, w.Code, tt.path)
+	}
+}
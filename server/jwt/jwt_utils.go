@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"net/http"
 	"regexp"
 	"sync"
 )
@@ -29,6 +30,22 @@ func getCompiledPattern(pattern string) *regexp.Regexp {
 	return re
 }
 
+// withPath - Returns a shallow copy of the request with the path replaced.
+func withPath(r *http.Request, path string) *http.Request {
+	if path == r.URL.Path {
+		return r
+	}
+
+	u := *r.URL
+	u.Path = path
+	u.RawPath = ""
+
+	c := r.WithContext(r.Context())
+	c.URL = &u
+
+	return c
+}
+
 func IsExcluded(excludedPaths []string, requestPath string) bool {
 	for _, v := range excludedPaths {
 		re := getCompiledPattern(v)
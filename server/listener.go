@@ -0,0 +1,55 @@
+package server
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"net"
+
+	"github.com/pires/go-proxyproto"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+// newListener - Listens on the address, parsing the PROXY protocol header
+// (when enabled) before anything else, TLS handshake included.
+func newListener(addr string, proxyProtocol *config.ProxyProtocol) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil || proxyProtocol == nil {
+		return ln, err
+	}
+
+	return wrapProxyProtocol(ln, *proxyProtocol)
+}
+
+func wrapProxyProtocol(ln net.Listener, conf config.ProxyProtocol) (net.Listener, error) {
+	timeout := conf.ReadHeaderTimeout
+	if timeout == 0 {
+		timeout = config.DefaultProxyProtocolReadHeaderTimeout
+	}
+
+	proxyListener := &proxyproto.Listener{
+		Listener:          ln,
+		ReadHeaderTimeout: timeout,
+	}
+
+	// The header is required (from every source, by default).
+	if len(conf.TrustedSources) > 0 {
+		// The other sources can connect directly, without the header.
+		policy, err := proxyproto.PolicyFromRanges(conf.TrustedSources, proxyproto.REQUIRE, proxyproto.REJECT)
+		if err != nil {
+			_ = ln.Close()
+			return nil, err
+		}
+
+		proxyListener.ConnPolicy = policy
+	}
+
+	return proxyListener, nil
+}
@@ -0,0 +1,157 @@
+//go:build all || unit
+// +build all unit
+
+package server
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+func serveRemoteAddr(t *testing.T, proxyProtocol *config.ProxyProtocol) (string, func()) {
+	ln, err := newListener("127.0.0.1:0", proxyProtocol)
+	assert.Nil(t, err)
+
+	srv := &http.Server{
+		ReadHeaderTimeout: time.Second,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, r.RemoteAddr)
+		}),
+	}
+	go func() { _ = srv.Serve(ln) }()
+
+	return ln.Addr().String(), func() { _ = srv.Close() }
+}
+
+func doRequest(addr string, proxyHeader string) (string, error) {
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	_, err = fmt.Fprintf(conn, "%sGET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n", proxyHeader)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+
+	return string(body), err
+}
+
+func TestNewListenerWithoutProxyProtocol(t *testing.T) {
+	addr, stop := serveRemoteAddr(t, nil)
+	defer stop()
+
+	remoteAddr, err := doRequest(addr, "")
+	assert.Nil(t, err)
+	assert.Regexp(t, `^127\.0\.0\.1:\d+$`, remoteAddr)
+}
+
+func TestNewListenerWithProxyProtocol(t *testing.T) {
+	addr, stop := serveRemoteAddr(t, &config.ProxyProtocol{HTTP: true})
+	defer stop()
+
+	remoteAddr, err := doRequest(addr, "PROXY TCP4 1.2.3.4 5.6.7.8 1234 80\r\n")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.3.4:1234", remoteAddr)
+
+	// v2 (binary) header.
+	v2 := "\r\n\r\n\x00\r\nQUIT\n" + "\x21\x11\x00\x0c" + "\x05\x06\x07\x08" + "\x7f\x00\x00\x01" + "\x04\xd2\x00\x50"
+	remoteAddr, err = doRequest(addr, v2)
+	assert.Nil(t, err)
+	assert.Equal(t, "5.6.7.8:1234", remoteAddr)
+
+	// The header is required.
+	_, err = doRequest(addr, "")
+	assert.NotNil(t, err)
+}
+
+func TestNewListenerWithProxyProtocolTrustedSources(t *testing.T) {
+	addr, stop := serveRemoteAddr(t, &config.ProxyProtocol{HTTP: true, TrustedSources: []string{"127.0.0.0/8"}})
+	defer stop()
+
+	remoteAddr, err := doRequest(addr, "PROXY TCP4 1.2.3.4 5.6.7.8 1234 80\r\n")
+	assert.Nil(t, err)
+	assert.Equal(t, "1.2.3.4:1234", remoteAddr)
+
+	_, err = doRequest(addr, "")
+	assert.NotNil(t, err)
+
+	addr, stop = serveRemoteAddr(t, &config.ProxyProtocol{HTTP: true, TrustedSources: []string{"10.0.0.1"}})
+	defer stop()
+
+	// Not a trusted source: it can connect only directly.
+	_, err = doRequest(addr, "PROXY TCP4 1.2.3.4 5.6.7.8 1234 80\r\n")
+	assert.NotNil(t, err)
+
+	remoteAddr, err = doRequest(addr, "")
+	assert.Nil(t, err)
+	assert.Regexp(t, `^127\.0\.0\.1:\d+$`, remoteAddr)
+}
+
+func TestNewListenerWithInvalidTrustedSources(t *testing.T) {
+	_, err := newListener("127.0.0.1:0", &config.ProxyProtocol{HTTP: true, TrustedSources: []string{"invalid"}})
+	assert.NotNil(t, err)
+}
+
+func TestNewListenerWithProxyProtocolBeforeTLS(t *testing.T) {
+	ln, err := newListener("127.0.0.1:0", &config.ProxyProtocol{HTTPS: true})
+	assert.Nil(t, err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.RemoteAddr)
+	}))
+	srv.Listener = ln
+	srv.StartTLS()
+	defer srv.Close()
+
+	conn, err := net.DialTimeout("tcp", ln.Addr().String(), time.Second)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	_, err = io.WriteString(conn, "PROXY TCP4 1.2.3.4 5.6.7.8 1234 443\r\n")
+	assert.Nil(t, err)
+
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true}) // #nosec G402
+	_, err = io.WriteString(tlsConn, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n")
+	assert.Nil(t, err)
+
+	res, err := http.ReadResponse(bufio.NewReader(tlsConn), nil)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, "1.2.3.4:1234", string(body))
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"math"
+	"time"
+)
+
+// The same algorithms are implemented in Lua (for Redis) and in Go (for the
+// local fallback), so they must be kept in sync.
+
+// tokenBucket - Tokens are refilled continuously at a fixed rate, up to the
+// capacity, and every request takes one.
+type tokenBucket struct {
+	tokens float64
+	last   int64 // milliseconds
+}
+
+func (b *tokenBucket) take(capacity float64, rate float64, now int64) bool {
+	if b.last == 0 {
+		b.tokens = capacity
+		b.last = now
+	}
+
+	if elapsed := now - b.last; elapsed > 0 {
+		b.tokens = math.Min(capacity, b.tokens+float64(elapsed)*rate)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+
+	return false
+}
+
+// getTokenBucketResult - rate is expressed in tokens per millisecond.
+func getTokenBucketResult(allowed bool, tokens float64, capacity float64, rate float64) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     int(capacity),
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     toDuration((capacity - tokens) / rate),
+	}
+
+	if !allowed {
+		res.RetryAfter = toDuration((1 - tokens) / rate)
+	}
+
+	return res
+}
+
+// slidingWindow - Approximates a sliding window by weighting the counter of
+// the previous fixed window with the time left in the current one.
+type slidingWindow struct {
+	window   int64
+	current  int
+	previous int
+}
+
+func (w *slidingWindow) take(limit int, size int64, now int64) (bool, int64) {
+	window := now / size
+	elapsed := now - window*size
+
+	switch w.window {
+	case window:
+	case window - 1:
+		w.previous = w.current
+		w.current = 0
+	default:
+		w.previous = 0
+		w.current = 0
+	}
+	w.window = window
+
+	if estimateSlidingWindow(w.current+1, w.previous, size, elapsed) > float64(limit) {
+		return false, elapsed
+	}
+
+	w.current++
+
+	return true, elapsed
+}
+
+func estimateSlidingWindow(current int, previous int, size int64, elapsed int64) float64 {
+	return float64(previous)*float64(size-elapsed)/float64(size) + float64(current)
+}
+
+func getSlidingWindowResult(allowed bool, limit int, current int, previous int, size int64, elapsed int64) Result {
+	estimated := estimateSlidingWindow(current, previous, size, elapsed)
+
+	res := Result{
+		Allowed:   allowed,
+		Limit:     limit,
+		Remaining: int(math.Max(0, float64(limit)-math.Ceil(estimated))),
+		Reset:     time.Duration(size-elapsed) * time.Millisecond,
+	}
+
+	if allowed {
+		return res
+	}
+
+	// When the current window is already full, the next one is the earliest
+	// chance. Otherwise it's when the previous window weighs enough less.
+	retryAfter := size - elapsed
+	if current < limit && previous > 0 {
+		needed := int64(float64(size) * (1 - float64(limit-current-1)/float64(previous)))
+		if needed > elapsed && needed-elapsed < retryAfter {
+			retryAfter = needed - elapsed
+		}
+	}
+	res.RetryAfter = time.Duration(retryAfter) * time.Millisecond
+
+	return res
+}
+
+func toDuration(milliseconds float64) time.Duration {
+	return time.Duration(math.Ceil(math.Max(0, milliseconds))) * time.Millisecond
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"sync"
+	"time"
+)
+
+// maxLocalEntries - Amount of tracked clients before sweeping the expired ones.
+const maxLocalEntries = 100000
+
+type localEntry struct {
+	bucket    tokenBucket
+	window    slidingWindow
+	expiresAt time.Time
+}
+
+// localStore - Per-instance counters, used when Redis is not available.
+type localStore struct {
+	mu      sync.Mutex
+	entries map[string]*localEntry
+}
+
+var local = &localStore{entries: make(map[string]*localEntry)}
+
+func (s *localStore) get(key string, now time.Time, ttl time.Duration) *localEntry {
+	entry, ok := s.entries[key]
+	if !ok || now.After(entry.expiresAt) {
+		if len(s.entries) >= maxLocalEntries {
+			s.sweep(now)
+		}
+
+		entry = &localEntry{}
+		s.entries[key] = entry
+	}
+	entry.expiresAt = now.Add(ttl)
+
+	return entry
+}
+
+func (s *localStore) sweep(now time.Time) {
+	for k, v := range s.entries {
+		if now.After(v.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+}
+
+func (s *localStore) takeToken(key string, capacity float64, rate float64, ttl time.Duration) Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry := s.get(key, now, ttl)
+	allowed := entry.bucket.take(capacity, rate, now.UnixMilli())
+
+	return getTokenBucketResult(allowed, entry.bucket.tokens, capacity, rate)
+}
+
+func (s *localStore) takeWindow(key string, limit int, size int64) Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry := s.get(key, now, 2*time.Duration(size)*time.Millisecond)
+	allowed, elapsed := entry.window.take(limit, size, now.UnixMilli())
+
+	return getSlidingWindowResult(allowed, limit, entry.window.current, entry.window.previous, size, elapsed)
+}
@@ -0,0 +1,225 @@
+package ratelimit
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	goredislib "github.com/go-redis/redis/v8"
+
+	"github.com/fabiocicerchia/go-proxy-cache/cache/engine"
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/logger"
+	"github.com/fabiocicerchia/go-proxy-cache/utils"
+)
+
+// KeyPrefix - Prefix of the Redis keys holding the counters.
+const KeyPrefix = "RATELIMIT"
+
+// Result - Outcome of a rate limit check.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+	// Fallback - Checked by the local counters (Redis unavailable).
+	Fallback bool
+}
+
+// The Redis time is used, so the instances agree regardless of their clocks.
+var tokenBucketScript = goredislib.NewScript(`
+redis.replicate_commands()
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local ttl = tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1])
+local last = tonumber(state[2])
+if tokens == nil or last == nil then
+	tokens = capacity
+	last = now
+end
+
+if now > last then
+	tokens = math.min(capacity, tokens + (now - last) * rate)
+	last = now
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', last)
+redis.call('PEXPIRE', KEYS[1], ttl)
+
+return {allowed, tostring(tokens)}
+`)
+
+var slidingWindowScript = goredislib.NewScript(`
+redis.replicate_commands()
+local limit = tonumber(ARGV[1])
+local size = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local window = math.floor(now / size)
+local elapsed = now - window * size
+
+local state = redis.call('HMGET', KEYS[1], 'window', 'current', 'previous')
+local stored = tonumber(state[1])
+local current = tonumber(state[2]) or 0
+local previous = tonumber(state[3]) or 0
+if stored == window - 1 then
+	previous = current
+	current = 0
+elseif stored ~= window then
+	previous = 0
+	current = 0
+end
+
+local allowed = 0
+if previous * (size - elapsed) / size + current + 1 <= limit then
+	current = current + 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'window', window, 'current', current, 'previous', previous)
+redis.call('PEXPIRE', KEYS[1], size * 2)
+
+return {allowed, current, previous, elapsed}
+`)
+
+// getStorageKey - The client key is hashed (it could be a secret, e.g. an
+// API key) and used as hash tag, so it's cluster-safe.
+func getStorageKey(scope string, key string) string {
+	h := sha256.Sum256([]byte(key))
+
+	return KeyPrefix + utils.StringSeparatorOne + scope + utils.StringSeparatorOne + "{" + hex.EncodeToString(h[:]) + "}"
+}
+
+func getCapacity(rule config.RateLimit) float64 {
+	if rule.Burst > 0 {
+		return float64(rule.Burst)
+	}
+
+	return float64(rule.Limit)
+}
+
+// getRate - Tokens refilled per millisecond.
+func getRate(rule config.RateLimit) float64 {
+	return float64(rule.Limit) / float64(rule.Period.Milliseconds())
+}
+
+// Allow - Checks whether the client (identified by key) can send another
+// request. The scope separates the counters (e.g. per domain or location).
+// When Redis is not available (e.g. the circuit breaker is open) the check
+// falls back on the local counters.
+func Allow(ctx context.Context, connName string, scope string, rule config.RateLimit, key string) Result {
+	if rule.Limit <= 0 || rule.Period < time.Millisecond {
+		return Result{Allowed: true}
+	}
+
+	storageKey := getStorageKey(scope, key)
+
+	res, err := allowRedis(ctx, connName, storageKey, rule)
+	if err == nil {
+		return res
+	}
+
+	logger.GetGlobal().Debugf("Rate limit fallback on local counters: %s", err)
+
+	res = allowLocal(storageKey, rule)
+	res.Fallback = true
+
+	return res
+}
+
+func allowRedis(ctx context.Context, connName string, storageKey string, rule config.RateLimit) (Result, error) {
+	conn := engine.GetConn(connName)
+	if conn == nil {
+		return Result{}, fmt.Errorf("missing redis connection for %s", connName)
+	}
+
+	if rule.Algorithm == config.RateLimitSlidingWindow {
+		size := rule.Period.Milliseconds()
+
+		values, err := runScript(ctx, conn.Run, slidingWindowScript, 4, storageKey, rule.Limit, size)
+		if err != nil {
+			return Result{}, err
+		}
+
+		return getSlidingWindowResult(values[0] == "1", rule.Limit, atoi(values[1]), atoi(values[2]), size, int64(atoi(values[3]))), nil
+	}
+
+	capacity := getCapacity(rule)
+	rate := getRate(rule)
+	ttl := toDuration(capacity/rate) + time.Second
+
+	values, err := runScript(ctx, conn.Run, tokenBucketScript, 2, storageKey, capacity, rate, ttl.Milliseconds())
+	if err != nil {
+		return Result{}, err
+	}
+
+	tokens, err := strconv.ParseFloat(values[1], 64)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return getTokenBucketResult(values[0] == "1", tokens, capacity, rate), nil
+}
+
+type scriptRunner func(ctx context.Context, script *goredislib.Script, keys []string, args ...interface{}) (interface{}, error)
+
+// runScript - Returns the values of the array replied by the script as strings.
+func runScript(ctx context.Context, run scriptRunner, script *goredislib.Script, replySize int, key string, args ...interface{}) ([]string, error) {
+	reply, err := run(ctx, script, []string{key}, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	items, ok := reply.([]interface{})
+	if !ok || len(items) != replySize {
+		return nil, fmt.Errorf("unexpected rate limit reply: %v", reply)
+	}
+
+	values := make([]string, len(items))
+	for k, v := range items {
+		values[k] = fmt.Sprintf("%v", v)
+	}
+
+	return values, nil
+}
+
+func atoi(value string) int {
+	v, _ := strconv.Atoi(value)
+
+	return v
+}
+
+func allowLocal(storageKey string, rule config.RateLimit) Result {
+	if rule.Algorithm == config.RateLimitSlidingWindow {
+		return local.takeWindow(storageKey, rule.Limit, rule.Period.Milliseconds())
+	}
+
+	capacity := getCapacity(rule)
+	rate := getRate(rule)
+
+	return local.takeToken(storageKey, capacity, rate, toDuration(capacity/rate)+time.Second)
+}
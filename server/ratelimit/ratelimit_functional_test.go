@@ -0,0 +1,64 @@
+//go:build all || functional
+// +build all functional
+
+package ratelimit_test
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/cache/engine"
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/logger"
+	"github.com/fabiocicerchia/go-proxy-cache/server/ratelimit"
+	"github.com/fabiocicerchia/go-proxy-cache/utils"
+	circuit_breaker "github.com/fabiocicerchia/go-proxy-cache/utils/circuit-breaker"
+)
+
+const redisConnName = "testing-ratelimit"
+
+func initConn() {
+	circuit_breaker.InitCircuitBreaker(redisConnName, config.Config.CircuitBreaker, logger.GetGlobal())
+	engine.InitConn(redisConnName, config.Cache{
+		Hosts: []string{utils.GetEnv("REDIS_HOSTS", "localhost:6379")},
+		DB:    0,
+	}, logger.GetGlobal())
+}
+
+func TestAllowSharedCounters(t *testing.T) {
+	initConn()
+
+	for _, algorithm := range []string{config.RateLimitTokenBucket, config.RateLimitSlidingWindow} {
+		rule := config.RateLimit{
+			Enabled:   true,
+			Algorithm: algorithm,
+			Limit:     2,
+			Period:    time.Minute,
+		}
+		client := xid.New().String()
+
+		res := ratelimit.Allow(context.Background(), redisConnName, "TestAllowSharedCounters", rule, client)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 1, res.Remaining)
+
+		res = ratelimit.Allow(context.Background(), redisConnName, "TestAllowSharedCounters", rule, client)
+		assert.True(t, res.Allowed)
+
+		res = ratelimit.Allow(context.Background(), redisConnName, "TestAllowSharedCounters", rule, client)
+		assert.False(t, res.Allowed)
+		assert.Greater(t, res.RetryAfter, time.Duration(0))
+	}
+}
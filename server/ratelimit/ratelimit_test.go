@@ -0,0 +1,127 @@
+//go:build all || unit
+// +build all unit
+
+package ratelimit
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+func TestTokenBucket(t *testing.T) {
+	b := tokenBucket{}
+	rate := 1.0 / 1000 // 1 token per second
+
+	assert.True(t, b.take(2, rate, 1000))
+	assert.True(t, b.take(2, rate, 1000))
+	assert.False(t, b.take(2, rate, 1000))
+
+	res := getTokenBucketResult(false, b.tokens, 2, rate)
+	assert.Equal(t, 2, res.Limit)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 2*time.Second, res.Reset)
+
+	// Half a token later, still nothing.
+	assert.False(t, b.take(2, rate, 1500))
+	assert.Equal(t, 500*time.Millisecond, getTokenBucketResult(false, b.tokens, 2, rate).RetryAfter)
+
+	assert.True(t, b.take(2, rate, 2000))
+
+	// Never above the capacity.
+	assert.True(t, b.take(2, rate, 100000))
+	assert.True(t, b.take(2, rate, 100000))
+	assert.False(t, b.take(2, rate, 100000))
+}
+
+func TestSlidingWindow(t *testing.T) {
+	w := slidingWindow{}
+	size := int64(1000)
+
+	for i := 0; i < 3; i++ {
+		allowed, _ := w.take(3, size, 10500)
+		assert.True(t, allowed)
+	}
+
+	allowed, elapsed := w.take(3, size, 10500)
+	assert.False(t, allowed)
+	assert.Equal(t, int64(500), elapsed)
+
+	res := getSlidingWindowResult(allowed, 3, w.current, w.previous, size, elapsed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	// Next window: the previous one still weighs 3 * 0.5.
+	allowed, _ = w.take(3, size, 11500)
+	assert.True(t, allowed)
+	allowed, elapsed = w.take(3, size, 11500)
+	assert.False(t, allowed)
+
+	res = getSlidingWindowResult(allowed, 3, w.current, w.previous, size, elapsed)
+	assert.InDelta(t, float64(167*time.Millisecond), float64(res.RetryAfter), float64(time.Millisecond))
+
+	// Windows far in the past are forgotten.
+	allowed, _ = w.take(3, size, 20000)
+	assert.True(t, allowed)
+	assert.Equal(t, 0, w.previous)
+}
+
+func TestAllowFallsBackOnLocalCounters(t *testing.T) {
+	rule := config.RateLimit{
+		Enabled: true,
+		Limit:   2,
+		Period:  time.Minute,
+	}
+
+	// Fresh counters (e.g. with -count).
+	local = &localStore{entries: make(map[string]*localEntry)}
+
+	// No redis connection available.
+	res := Allow(context.Background(), "missing", "TestAllowFallsBackOnLocalCounters", rule, "client")
+	assert.True(t, res.Allowed)
+	assert.True(t, res.Fallback)
+	assert.Equal(t, 1, res.Remaining)
+
+	res = Allow(context.Background(), "missing", "TestAllowFallsBackOnLocalCounters", rule, "client")
+	assert.True(t, res.Allowed)
+
+	res = Allow(context.Background(), "missing", "TestAllowFallsBackOnLocalCounters", rule, "client")
+	assert.False(t, res.Allowed)
+	assert.InDelta(t, float64(30*time.Second), float64(res.RetryAfter), float64(100*time.Millisecond))
+
+	// Another client has its own counters.
+	res = Allow(context.Background(), "missing", "TestAllowFallsBackOnLocalCounters", rule, "another")
+	assert.True(t, res.Allowed)
+
+	rule.Algorithm = config.RateLimitSlidingWindow
+	res = Allow(context.Background(), "missing", "TestAllowFallsBackOnLocalCounters-sw", rule, "client")
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+}
+
+func TestAllowWithoutLimit(t *testing.T) {
+	res := Allow(context.Background(), "missing", "TestAllowWithoutLimit", config.RateLimit{Enabled: true}, "client")
+	assert.True(t, res.Allowed)
+}
+
+func TestGetStorageKey(t *testing.T) {
+	key := getStorageKey("example.com@@https", "api_key:secret")
+
+	assert.True(t, strings.HasPrefix(key, "RATELIMIT@@example.com@@https@@{"))
+	assert.NotContains(t, key, "secret")
+}
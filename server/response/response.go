@@ -37,6 +37,9 @@ type LoggedResponseWriter struct {
 	StatusCode     int
 	Content        DataChunks
 
+	// streaming - Nothing is buffered, see StartStreaming.
+	streaming bool
+
 	// GZip
 	GZipResponse *gzip.Writer
 
@@ -73,11 +76,39 @@ func (lwr *LoggedResponseWriter) Reset() {
 	lwr.Content = make(DataChunks, 0)
 }
 
+// StartStreaming - Sends the response right away (e.g. Server-Sent Events):
+// the status code, the headers and every chunk (nothing is buffered, so
+// neither the ETag nor the GZip are available).
+func (lwr *LoggedResponseWriter) StartStreaming() {
+	lwr.streaming = true
+}
+
+// IsStreaming - Checks whether the response is being sent right away.
+func (lwr *LoggedResponseWriter) IsStreaming() bool {
+	return lwr.streaming
+}
+
+// Flush - Sends the buffered data to the client, only when streaming.
+func (lwr *LoggedResponseWriter) Flush() {
+	if !lwr.streaming {
+		return
+	}
+
+	if fl, ok := lwr.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
+
 // WriteHeader - ResponseWriter's WriteHeader method decorator.
 func (lwr *LoggedResponseWriter) WriteHeader(statusCode int) {
 	lwr.statusCodeSent = true
 	lwr.StatusCode = statusCode
 
+	if lwr.streaming {
+		lwr.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+
 	// no sending to ResponseWriter as it is buffered either for ETag or GZip support.
 }
 
@@ -102,6 +133,10 @@ func (lwr *LoggedResponseWriter) Write(p []byte) (int, error) {
 		lwr.StatusCode = http.StatusOK
 	}
 
+	if lwr.streaming {
+		return lwr.ResponseWriter.Write(p)
+	}
+
 	lwr.Content = append(lwr.Content, []byte{})
 	chunk := len(lwr.Content) - 1
 	lwr.Content[chunk] = append(lwr.Content[chunk], p...)
@@ -190,6 +190,31 @@ func TestCatchContentThreeChunks(t *testing.T) {
 	tearDownResponse()
 }
 
+func TestStreamingIsNotBuffered(t *testing.T) {
+	initLogs()
+
+	rwMock := ResponseWriterMock{}
+
+	lwr := response.NewLoggedResponseWriter(rwMock, "TestStreamingIsNotBuffered")
+	lwr.StartStreaming()
+
+	content := []byte("data: test\n\n")
+	lwr.WriteHeader(http.StatusOK)
+	_, err := lwr.Write(content)
+	assert.Nil(t, err)
+
+	// checks lwr
+	assert.True(t, lwr.IsStreaming())
+	assert.Equal(t, http.StatusOK, lwr.StatusCode)
+	assert.Equal(t, 0, lwr.Content.Len())
+
+	// verify calls on rwMock
+	assert.Equal(t, http.StatusOK, MockStatusCode)
+	assert.Equal(t, content, MockContent.Bytes())
+
+	tearDownResponse()
+}
+
 func TestSendNotImplemented(t *testing.T) {
 	initLogs()
 
@@ -11,6 +11,7 @@ package server
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -18,6 +19,7 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/quic-go/quic-go/http3"
 	log "github.com/sirupsen/logrus"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
@@ -25,7 +27,9 @@ import (
 	"github.com/fabiocicerchia/go-proxy-cache/cache/engine"
 	"github.com/fabiocicerchia/go-proxy-cache/config"
 	"github.com/fabiocicerchia/go-proxy-cache/logger"
+	"github.com/fabiocicerchia/go-proxy-cache/server/access"
 	"github.com/fabiocicerchia/go-proxy-cache/server/balancer"
+	"github.com/fabiocicerchia/go-proxy-cache/server/concurrency"
 	"github.com/fabiocicerchia/go-proxy-cache/server/handler"
 	"github.com/fabiocicerchia/go-proxy-cache/server/jwt"
 	srvtls "github.com/fabiocicerchia/go-proxy-cache/server/tls"
@@ -60,6 +64,11 @@ func normalizeTimeout(d time.Duration) time.Duration {
 type Server struct {
 	Domain  string
 	HttpSrv *http.Server
+	// ProxyProtocol - Set when the listener accepts the PROXY protocol header.
+	ProxyProtocol *config.ProxyProtocol
+	// HTTP3 - Set when HTTP/3 is served on the same port (over UDP).
+	HTTP3    bool
+	Http3Srv *http3.Server
 }
 
 // Servers - Contains the HTTP/HTTPS servers.
@@ -80,6 +89,10 @@ func Run(appVersion string, configFile string) {
 	config.InitConfigFromFileOrEnv(configFile)
 	config.Print()
 
+	// Access rules (reloaded on SIGHUP)
+	access.Store(access.NewSnapshot(config.Config))
+	go reloadAccessRules(configFile)
+
 	// Logging Hooks
 	log := logger.GetGlobal()
 	logger.HookSentry(log, config.Config.Log.SentryDsn)
@@ -107,6 +120,10 @@ func Run(appVersion string, configFile string) {
 		HTTPS: make(map[string]*Server),
 	}
 
+	if err := srvtls.LoadDefaultCertificate(config.Config.Server.TLS); err != nil {
+		log.Errorf("Cannot load the default TLS certificate: %s", err)
+	}
+
 	for _, domain := range config.GetDomains() {
 		servers.StartDomainServer(domain.Host, domain.Scheme)
 	}
@@ -116,6 +133,11 @@ func Run(appVersion string, configFile string) {
 		InitInternals(),
 	)
 
+	// TLS certificates (reloaded when changed, or on SIGHUP) and their OCSP staples
+	go srvtls.WatchCertificates()
+	go srvtls.WatchStaples()
+	go reloadCertificates()
+
 	// start server http & https
 	servers.startListeners()
 
@@ -138,6 +160,36 @@ func Run(appVersion string, configFile string) {
 	log.Error("All listeners shut down. Exiting.")
 }
 
+// reloadAccessRules - Reloads the access rules and the trusted proxies from
+// the configuration file on SIGHUP, without a restart.
+func reloadAccessRules(configFile string) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	for range c {
+		conf, err := config.Load(configFile)
+		if err != nil {
+			log.Errorf("Cannot reload the access rules: %s", err)
+			continue
+		}
+
+		access.Store(access.NewSnapshot(conf))
+
+		log.Info("Access rules reloaded.")
+	}
+}
+
+// reloadCertificates - Reloads the TLS certificates on SIGHUP, without a
+// restart.
+func reloadCertificates() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	for range c {
+		srvtls.ReloadCertificates(true)
+	}
+}
+
 // InitInternals - Generates the internals endpoints (not exposed on public ports :80 :443).
 func InitInternals() *http.Server {
 	mux := http.NewServeMux()
@@ -170,7 +222,7 @@ func InitServer(domain string, domainConfig config.Configuration) *http.Server {
 	//       WHEN SHARING SAME PORT NO CUSTOM OVERRIDES ON CRITICAL SETTINGS.
 	timeout := config.Config.Server.Timeout
 	if enableTimeoutHandler && timeout.Handler > 0 {
-		muxMiddleware = http.TimeoutHandler(muxMiddleware, timeout.Handler, "Timed Out\n")
+		muxMiddleware = skipStreams(http.TimeoutHandler(muxMiddleware, timeout.Handler, "Timed Out\n"), mux)
 	}
 
 	server := &http.Server{
@@ -184,6 +236,21 @@ func InitServer(domain string, domainConfig config.Configuration) *http.Server {
 	return server
 }
 
+// skipStreams - Serves the streams (e.g. gRPC calls, Server-Sent Events or
+// WebSockets) with next, bypassing the middleware (e.g. the timeout one
+// buffers the whole response, drops the trailers, kills the long streams and
+// cannot be hijacked).
+func skipStreams(middleware http.Handler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handler.IsStreamingRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		middleware.ServeHTTP(w, r)
+	})
+}
+
 // AttachPlain - Adds a new HTTP server in the listener container.
 // NOTE: There will be only ONE server listening on a port.
 //
@@ -204,8 +271,13 @@ func (s *Servers) AttachSecure(domain string, port string, server *http.Server)
 
 // InitServers - Returns a http.Server configuration for HTTP and HTTPS.
 func (s *Servers) InitServers(domain string, domainConfig config.Configuration) {
+	proxyProtocol := domainConfig.Server.ProxyProtocol
+
 	srvHTTP := InitServer(domain, domainConfig)
 	s.AttachPlain(domain, domainConfig.Server.Port.HTTP, srvHTTP)
+	if proxyProtocol.HTTP {
+		s.HTTP[domainConfig.Server.Port.HTTP].ProxyProtocol = &proxyProtocol
+	}
 
 	srvHTTPS := InitServer(domain, domainConfig)
 
@@ -217,7 +289,29 @@ func (s *Servers) InitServers(domain string, domainConfig config.Configuration)
 		return
 	}
 
+	// HTTP/3 is served on the port when at least one domain enables it.
+	enableHTTP3 := domainConfig.Server.TLS.HTTP3.Enabled
+	if prev, ok := s.HTTPS[domainConfig.Server.Port.HTTPS]; ok && prev.HTTP3 {
+		enableHTTP3 = true
+	}
+
 	s.AttachSecure(domain, domainConfig.Server.Port.HTTPS, srvHTTPS)
+	if proxyProtocol.HTTPS {
+		s.HTTPS[domainConfig.Server.Port.HTTPS].ProxyProtocol = &proxyProtocol
+	}
+	s.HTTPS[domainConfig.Server.Port.HTTPS].HTTP3 = enableHTTP3
+}
+
+// InitHTTP3Server - Generates the HTTP/3 server sharing the HTTPS server's
+// handler and TLS configuration (so the certificates are picked by SNI too).
+func InitHTTP3Server(srv *http.Server) *http3.Server {
+	return &http3.Server{
+		Addr:           srv.Addr,
+		Handler:        srv.Handler,
+		TLSConfig:      http3.ConfigureTLSConfig(srv.TLSConfig),
+		IdleTimeout:    srv.IdleTimeout,
+		MaxHeaderBytes: srv.MaxHeaderBytes,
+	}
 }
 
 // StartDomainServer - Configures and start listening for a particular domain.
@@ -242,29 +336,58 @@ func (s *Servers) StartDomainServer(domain string, scheme string) {
 
 	// lb
 	balancer.Init(domainID, domainConfig.Server.Upstream)
+	concurrency.Init(domainID, domainConfig.Server.Upstream)
+	for _, location := range domainConfig.Server.Locations {
+		balancer.Init(location.GetBalancerID(), location.Upstream)
+		concurrency.Init(location.GetBalancerID(), location.Upstream)
+	}
 }
 
 func (s Servers) startListeners() {
 	for port, srvHTTP := range s.HTTP {
 		srvHTTP.HttpSrv.Addr = ":" + port
 
-		go func(srv *http.Server) {
+		ln, err := newListener(srvHTTP.HttpSrv.Addr, srvHTTP.ProxyProtocol)
+		if err != nil {
+			logger.GetGlobal().Fatal(err)
+		}
+
+		go func(srv *http.Server, ln net.Listener) {
 			// ErrServerClosed is returned on graceful Shutdown and must not
 			// kill the process (Fatal calls os.Exit and skips the drain).
-			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
 				logger.GetGlobal().Fatal(err)
 			}
-		}(srvHTTP.HttpSrv)
+		}(srvHTTP.HttpSrv, ln)
 	}
 
 	for port, srvHTTPS := range s.HTTPS {
 		srvHTTPS.HttpSrv.Addr = ":" + port
 
-		go func(srv *http.Server) {
-			if err := srv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+		// The PROXY protocol header comes before the TLS handshake.
+		ln, err := newListener(srvHTTPS.HttpSrv.Addr, srvHTTPS.ProxyProtocol)
+		if err != nil {
+			logger.GetGlobal().Fatal(err)
+		}
+
+		go func(srv *http.Server, ln net.Listener) {
+			if err := srv.ServeTLS(ln, "", ""); err != nil && err != http.ErrServerClosed {
+				logger.GetGlobal().Fatal(err)
+			}
+		}(srvHTTPS.HttpSrv, ln)
+
+		if !srvHTTPS.HTTP3 {
+			continue
+		}
+
+		// NOTE: The PROXY protocol is not supported over UDP.
+		srvHTTPS.Http3Srv = InitHTTP3Server(srvHTTPS.HttpSrv)
+
+		go func(srv *http3.Server) {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 				logger.GetGlobal().Fatal(err)
 			}
-		}(srvHTTPS.HttpSrv)
+		}(srvHTTPS.Http3Srv)
 	}
 }
 
@@ -283,5 +406,13 @@ func (s Servers) shutdownServers(ctx context.Context) {
 		if err != nil {
 			logger.GetGlobal().Errorf("Cannot shutdown server %s: %s", k, err)
 		}
+
+		if v.Http3Srv == nil {
+			continue
+		}
+
+		if err := v.Http3Srv.Shutdown(ctx); err != nil {
+			logger.GetGlobal().Errorf("Cannot shutdown HTTP/3 server %s: %s", k, err)
+		}
 	}
 }
@@ -0,0 +1,164 @@
+package tls
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	crypto_tls "crypto/tls"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/cache/engine"
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+// acmeCacheKeyPrefix - Prefix of the Redis keys of the automatic certificates.
+const acmeCacheKeyPrefix = "autocert:"
+
+var errMissingRedisConnection = errors.New("missing redis connection")
+
+// redisCache - Stores the automatic certificates (and the ACME account) in
+// the domain's Redis, so they're shared by all the instances.
+type redisCache struct {
+	connName string
+}
+
+// Get - Returns the data of the key, autocert.ErrCacheMiss when missing.
+func (c redisCache) Get(ctx context.Context, key string) ([]byte, error) {
+	conn := engine.GetConn(c.connName)
+	if conn == nil {
+		return nil, errors.Wrapf(errMissingRedisConnection, "%s", c.connName)
+	}
+
+	value, err := conn.Get(acmeCacheKeyPrefix + key)
+	if err != nil {
+		return nil, err
+	}
+
+	if value == "" {
+		return nil, autocert.ErrCacheMiss
+	}
+
+	return []byte(value), nil
+}
+
+// Put - Stores the data of the key, without expiration.
+func (c redisCache) Put(ctx context.Context, key string, data []byte) error {
+	conn := engine.GetConn(c.connName)
+	if conn == nil {
+		return errors.Wrapf(errMissingRedisConnection, "%s", c.connName)
+	}
+
+	_, err := conn.Set(ctx, acmeCacheKeyPrefix+key, string(data), 0)
+
+	return err
+}
+
+// Delete - Removes the key.
+func (c redisCache) Delete(ctx context.Context, key string) error {
+	conn := engine.GetConn(c.connName)
+	if conn == nil {
+		return errors.Wrapf(errMissingRedisConnection, "%s", c.connName)
+	}
+
+	return conn.Del(ctx, acmeCacheKeyPrefix+key)
+}
+
+// getACMECache - Returns the storage of the automatic certificates.
+func getACMECache(connName string, conf config.TLS) (autocert.Cache, error) {
+	if conf.ACME.Storage == config.ACMEStorageRedis {
+		return redisCache{connName: connName}, nil
+	}
+
+	// The autocert cache must be stable across restarts: the previous
+	// os.MkdirTemp call created a fresh directory on every boot, forcing a new
+	// certificate issuance from the ACME CA on each restart and burning through
+	// Let's Encrypt rate limits (which can lock the domain out of issuance).
+	cacheDir := conf.CertCacheDir
+	if cacheDir == "" {
+		cacheDir = filepath.Join(os.TempDir(), "go-proxy-cache-autocert")
+	}
+
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return nil, err
+	}
+
+	return autocert.DirCache(cacheDir), nil
+}
+
+// getACMEClient - Returns the client of the configured directory (nil for
+// the default one).
+func getACMEClient(conf config.ACME) (*acme.Client, error) {
+	if conf.DirectoryURL == "" && conf.CAFile == "" {
+		return nil, nil
+	}
+
+	client := &acme.Client{DirectoryURL: conf.DirectoryURL}
+	if client.DirectoryURL == "" {
+		client.DirectoryURL = autocert.DefaultACMEDirectory
+	}
+
+	if conf.CAFile != "" {
+		pool, err := loadCAPool(conf.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		client.HTTPClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &crypto_tls.Config{RootCAs: pool, MinVersion: crypto_tls.VersionTLS12},
+			},
+		}
+	}
+
+	return client, nil
+}
+
+// getExternalAccountBinding - Returns the EAB credentials (if any), the HMAC
+// key is base64url encoded (padding optional).
+func getExternalAccountBinding(conf config.ACME) (*acme.ExternalAccountBinding, error) {
+	if conf.EABKeyID == "" {
+		return nil, nil
+	}
+
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(conf.EABHMACKey, "="))
+	if err != nil {
+		return nil, err
+	}
+
+	return &acme.ExternalAccountBinding{KID: conf.EABKeyID, Key: key}, nil
+}
+
+// forceRSA - Makes the manager pick (and issue) the RSA certificates: the
+// ECDSA ones are chosen only for the clients announcing their support.
+func forceRSA(getCertificate func(*crypto_tls.ClientHelloInfo) (*crypto_tls.Certificate, error)) func(*crypto_tls.ClientHelloInfo) (*crypto_tls.Certificate, error) {
+	return func(hello *crypto_tls.ClientHelloInfo) (*crypto_tls.Certificate, error) {
+		rsaHello := *hello
+		rsaHello.SignatureSchemes = []crypto_tls.SignatureScheme{}
+
+		for _, v := range hello.SignatureSchemes {
+			switch v {
+			case crypto_tls.ECDSAWithSHA1, crypto_tls.ECDSAWithP256AndSHA256, crypto_tls.ECDSAWithP384AndSHA384, crypto_tls.ECDSAWithP521AndSHA512:
+			default:
+				rsaHello.SignatureSchemes = append(rsaHello.SignatureSchemes, v)
+			}
+		}
+
+		return getCertificate(&rsaHello)
+	}
+}
@@ -0,0 +1,62 @@
+//go:build all || functional
+// +build all functional
+
+package tls
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/xid"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/cache/engine"
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/logger"
+	"github.com/fabiocicerchia/go-proxy-cache/utils"
+	circuit_breaker "github.com/fabiocicerchia/go-proxy-cache/utils/circuit-breaker"
+)
+
+const redisConnName = "testing-acme"
+
+func TestRedisCache(t *testing.T) {
+	circuit_breaker.InitCircuitBreaker(redisConnName, config.Config.CircuitBreaker, logger.GetGlobal())
+	engine.InitConn(redisConnName, config.Cache{
+		Hosts: []string{utils.GetEnv("REDIS_HOSTS", "localhost:6379")},
+		DB:    0,
+	}, logger.GetGlobal())
+
+	ctx := context.Background()
+	cache := redisCache{connName: redisConnName}
+	key := "www.example.com+" + xid.New().String()
+
+	_, err := cache.Get(ctx, key)
+	assert.ErrorIs(t, err, autocert.ErrCacheMiss)
+
+	assert.Nil(t, cache.Put(ctx, key, []byte("certificate")))
+
+	// Shared: another instance reads it.
+	data, err := redisCache{connName: redisConnName}.Get(ctx, key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("certificate"), data)
+
+	assert.Nil(t, cache.Delete(ctx, key))
+
+	_, err = cache.Get(ctx, key)
+	assert.ErrorIs(t, err, autocert.ErrCacheMiss)
+}
+
+func TestRedisCacheMissingConnection(t *testing.T) {
+	_, err := redisCache{connName: "missing"}.Get(context.Background(), "key")
+	assert.ErrorIs(t, err, errMissingRedisConnection)
+}
@@ -0,0 +1,96 @@
+//go:build all || unit
+// +build all unit
+
+package tls
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	crypto_tls "crypto/tls"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/acme/autocert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+func TestGetACMEClient(t *testing.T) {
+	client, err := getACMEClient(config.ACME{})
+	assert.Nil(t, err)
+	assert.Nil(t, client)
+
+	client, err = getACMEClient(config.ACME{DirectoryURL: "https://localhost:14000/dir"})
+	assert.Nil(t, err)
+	assert.Equal(t, "https://localhost:14000/dir", client.DirectoryURL)
+	assert.Nil(t, client.HTTPClient)
+
+	ca := newTestCA(t, "ca")
+	client, err = getACMEClient(config.ACME{CAFile: ca.file})
+	assert.Nil(t, err)
+	assert.Equal(t, autocert.DefaultACMEDirectory, client.DirectoryURL)
+	assert.NotNil(t, client.HTTPClient)
+
+	_, err = getACMEClient(config.ACME{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.NotNil(t, err)
+}
+
+func TestGetExternalAccountBinding(t *testing.T) {
+	eab, err := getExternalAccountBinding(config.ACME{})
+	assert.Nil(t, err)
+	assert.Nil(t, eab)
+
+	eab, err = getExternalAccountBinding(config.ACME{EABKeyID: "kid-1", EABHMACKey: "c2VjcmV0LWtleQ"})
+	assert.Nil(t, err)
+	assert.Equal(t, "kid-1", eab.KID)
+	assert.Equal(t, []byte("secret-key"), eab.Key)
+
+	// Padded.
+	eab, err = getExternalAccountBinding(config.ACME{EABKeyID: "kid-1", EABHMACKey: "c2VjcmV0LWtleQ=="})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("secret-key"), eab.Key)
+
+	_, err = getExternalAccountBinding(config.ACME{EABKeyID: "kid-1", EABHMACKey: "not base64!"})
+	assert.NotNil(t, err)
+}
+
+func TestGetACMECache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "autocert")
+
+	cache, err := getACMECache("conn", config.TLS{CertCacheDir: dir})
+	assert.Nil(t, err)
+	assert.Equal(t, autocert.DirCache(dir), cache)
+	assert.DirExists(t, dir)
+
+	cache, err = getACMECache("conn", config.TLS{ACME: config.ACME{Storage: config.ACMEStorageRedis}})
+	assert.Nil(t, err)
+	assert.Equal(t, redisCache{connName: "conn"}, cache)
+}
+
+func TestForceRSA(t *testing.T) {
+	var received *crypto_tls.ClientHelloInfo
+
+	getCertificate := forceRSA(func(hello *crypto_tls.ClientHelloInfo) (*crypto_tls.Certificate, error) {
+		received = hello
+		return nil, nil
+	})
+
+	hello := &crypto_tls.ClientHelloInfo{
+		ServerName:       "www.example.com",
+		SignatureSchemes: []crypto_tls.SignatureScheme{crypto_tls.ECDSAWithP256AndSHA256, crypto_tls.PSSWithSHA256},
+	}
+	_, _ = getCertificate(hello)
+
+	assert.Equal(t, "www.example.com", received.ServerName)
+	assert.Equal(t, []crypto_tls.SignatureScheme{crypto_tls.PSSWithSHA256}, received.SignatureSchemes)
+	// The client's hello is untouched.
+	assert.Len(t, hello.SignatureSchemes, 2)
+}
@@ -0,0 +1,308 @@
+package tls
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"bytes"
+	crypto_tls "crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/logger"
+)
+
+var errMissingClientCertificate = errors.New("missing client certificate")
+var errRevokedClientCertificate = errors.New("revoked client certificate")
+
+// clientAuthConfigs - TLS configurations (by domain) requesting the client
+// certificates, picked by SNI as all the domains share the listeners.
+var clientAuthConfigs sync.Map
+
+// clientVerifiers - Loaded CA bundles and CRLs, by files.
+var clientVerifiers sync.Map
+
+// clientAuthSource - Client certificates verification of a domain, with its
+// files' state when last loaded.
+type clientAuthSource struct {
+	tlsConfig *crypto_tls.Config
+	conf      config.ClientAuth
+	state     string
+}
+
+// clientAuthSources - The domains requesting the client certificates, by
+// domain. It's guarded by certificatesMu.
+var clientAuthSources = make(map[string]*clientAuthSource)
+
+// ClientVerifier - Verifies the client certificates against a CA bundle and
+// (optionally) a revocation list.
+type ClientVerifier struct {
+	roots *x509.CertPool
+	// crlIssuer - Raw subject of the CA signing the revocation list.
+	crlIssuer []byte
+	revoked   map[string]struct{}
+}
+
+// NewClientVerifier - Loads the CA bundle and the revocation list.
+func NewClientVerifier(conf config.ClientAuth) (*ClientVerifier, error) {
+	caPEM, err := os.ReadFile(conf.CAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cas := []*x509.Certificate{}
+	for block, rest := pem.Decode(caPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		ca, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+
+		cas = append(cas, ca)
+	}
+
+	if len(cas) == 0 {
+		return nil, fmt.Errorf("no certificates found in %s", conf.CAFile)
+	}
+
+	v := &ClientVerifier{
+		roots:   x509.NewCertPool(),
+		revoked: make(map[string]struct{}),
+	}
+	for _, ca := range cas {
+		v.roots.AddCert(ca)
+	}
+
+	if conf.CRLFile != "" {
+		if err := v.loadCRL(conf.CRLFile, cas); err != nil {
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
+
+// loadCRL - Loads the revocation list, it must be signed by one of the CAs.
+func (v *ClientVerifier) loadCRL(file string, cas []*x509.Certificate) error {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	if block, _ := pem.Decode(raw); block != nil {
+		raw = block.Bytes
+	}
+
+	crl, err := x509.ParseRevocationList(raw)
+	if err != nil {
+		return err
+	}
+
+	signed := false
+	for _, ca := range cas {
+		if bytes.Equal(ca.RawSubject, crl.RawIssuer) && crl.CheckSignatureFrom(ca) == nil {
+			signed = true
+			break
+		}
+	}
+
+	if !signed {
+		return fmt.Errorf("the revocation list %s is not signed by any of the CAs", file)
+	}
+
+	v.crlIssuer = crl.RawIssuer
+	for _, entry := range crl.RevokedCertificateEntries {
+		v.revoked[entry.SerialNumber.String()] = struct{}{}
+	}
+
+	return nil
+}
+
+// clientVerifierKey - Key of the verifier in clientVerifiers.
+func clientVerifierKey(conf config.ClientAuth) string {
+	return conf.CAFile + "\n" + conf.CRLFile
+}
+
+// clientAuthFiles - Files of the configuration (the CRL is optional).
+func clientAuthFiles(conf config.ClientAuth) []string {
+	if conf.CRLFile == "" {
+		return []string{conf.CAFile}
+	}
+
+	return []string{conf.CAFile, conf.CRLFile}
+}
+
+// GetClientVerifier - Returns the verifier of the configuration, the files
+// are loaded once (and replaced when reloaded).
+func GetClientVerifier(conf config.ClientAuth) (*ClientVerifier, error) {
+	key := clientVerifierKey(conf)
+	if v, ok := clientVerifiers.Load(key); ok {
+		return v.(*ClientVerifier), nil
+	}
+
+	v, err := NewClientVerifier(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	clientVerifiers.Store(key, v)
+
+	return v, nil
+}
+
+// Verify - Checks the chain sent by the client (leaf first).
+func (v *ClientVerifier) Verify(certs []*x509.Certificate) error {
+	if len(certs) == 0 {
+		return errMissingClientCertificate
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+
+	chains, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         v.roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return err
+	}
+
+	return v.checkRevocation(chains)
+}
+
+// checkRevocation - Rejects the chains containing a revoked certificate.
+func (v *ClientVerifier) checkRevocation(chains [][]*x509.Certificate) error {
+	if len(v.revoked) == 0 {
+		return nil
+	}
+
+	for _, chain := range chains {
+		for _, c := range chain {
+			if !bytes.Equal(c.RawIssuer, v.crlIssuer) {
+				continue
+			}
+
+			if _, ok := v.revoked[c.SerialNumber.String()]; ok {
+				return errors.Wrapf(errRevokedClientCertificate, "serial %s", c.SerialNumber)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyClientAuth - Returns a copy of the TLS configuration requesting the
+// client certificates.
+func applyClientAuth(tlsConfig *crypto_tls.Config, conf config.ClientAuth) (*crypto_tls.Config, error) {
+	v, err := GetClientVerifier(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return newClientAuthConfig(tlsConfig, conf, v), nil
+}
+
+// newClientAuthConfig - Returns a copy of the TLS configuration requesting
+// the client certificates, verified by the verifier.
+func newClientAuthConfig(tlsConfig *crypto_tls.Config, conf config.ClientAuth, v *ClientVerifier) *crypto_tls.Config {
+	c := tlsConfig.Clone()
+	c.GetConfigForClient = nil
+	c.ClientCAs = v.roots
+
+	switch conf.Mode {
+	case config.ClientAuthRequire:
+		c.ClientAuth = crypto_tls.RequireAndVerifyClientCert
+	case config.ClientAuthVerifyIfGiven:
+		c.ClientAuth = crypto_tls.VerifyClientCertIfGiven
+	default:
+		// Never enforced, the handler forwards the verification result.
+		c.ClientAuth = crypto_tls.RequestClientCert
+
+		return c
+	}
+
+	// The chains are already verified against the CAs (when sent).
+	c.VerifyConnection = func(cs crypto_tls.ConnectionState) error {
+		return v.checkRevocation(cs.VerifiedChains)
+	}
+
+	return c
+}
+
+// registerClientAuth - Requests the client certificates for the domain's
+// handshakes (when enabled).
+func registerClientAuth(domain string, tlsConfig *crypto_tls.Config, conf config.ClientAuth) error {
+	certificatesMu.Lock()
+	defer certificatesMu.Unlock()
+
+	if !conf.IsEnabled() {
+		clientAuthConfigs.Delete(domain)
+		delete(clientAuthSources, domain)
+
+		return nil
+	}
+
+	state := getFilesState(clientAuthFiles(conf)...)
+
+	c, err := applyClientAuth(tlsConfig, conf)
+	if err != nil {
+		return err
+	}
+
+	clientAuthConfigs.Store(domain, c)
+	clientAuthSources[domain] = &clientAuthSource{tlsConfig: tlsConfig, conf: conf, state: state}
+
+	return nil
+}
+
+// reloadClientAuth - Reads again the CA bundles and CRLs, when forced even if
+// unchanged. The new handshakes (and the handler) use the new verifier, on
+// failure the previous one is kept (and it's retried on the next reload).
+// It must be called holding certificatesMu.
+func reloadClientAuth(force bool) {
+	for domain, source := range clientAuthSources {
+		state := getFilesState(clientAuthFiles(source.conf)...)
+		if !force && (state == "" || state == source.state) {
+			continue
+		}
+
+		v, err := NewClientVerifier(source.conf)
+		if err != nil {
+			logger.GetGlobal().Errorf("Cannot reload the client CA %s of '%s': %s", source.conf.CAFile, domain, err)
+			continue
+		}
+
+		clientVerifiers.Store(clientVerifierKey(source.conf), v)
+		clientAuthConfigs.Store(domain, newClientAuthConfig(source.tlsConfig, source.conf, v))
+		source.state = state
+
+		logger.GetGlobal().Infof("Client CA %s of '%s' reloaded.", source.conf.CAFile, domain)
+	}
+}
+
+func returnConfig(helloInfo *crypto_tls.ClientHelloInfo) (*crypto_tls.Config, error) {
+	if c, ok := clientAuthConfigs.Load(helloInfo.ServerName); ok {
+		return c.(*crypto_tls.Config), nil
+	}
+
+	// The listener's configuration.
+	return nil, nil
+}
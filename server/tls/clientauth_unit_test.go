@@ -0,0 +1,170 @@
+//go:build all || unit
+// +build all unit
+
+package tls
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	crypto_tls "crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T, name string) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().Add(1 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	file := filepath.Join(t.TempDir(), name+".pem")
+	assert.Nil(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+
+	return testCA{cert: cert, key: key, file: file}
+}
+
+func (ca testCA) issue(t *testing.T, serial int64) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     time.Now().Add(1 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	assert.Nil(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	return cert
+}
+
+func (ca testCA) revoke(t *testing.T, serials ...int64) string {
+	entries := []x509.RevocationListEntry{}
+	for _, v := range serials {
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: big.NewInt(v), RevocationTime: time.Now()})
+	}
+
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                time.Now(),
+		NextUpdate:                time.Now().Add(1 * time.Hour),
+		RevokedCertificateEntries: entries,
+	}, ca.cert, ca.key)
+	assert.Nil(t, err)
+
+	file := filepath.Join(t.TempDir(), "crl.pem")
+	assert.Nil(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o600))
+
+	return file
+}
+
+func TestClientVerifierVerify(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	otherCA := newTestCA(t, "other")
+
+	v, err := NewClientVerifier(config.ClientAuth{Mode: config.ClientAuthRequire, CAFile: ca.file})
+	assert.Nil(t, err)
+
+	assert.Nil(t, v.Verify([]*x509.Certificate{ca.issue(t, 2)}))
+	assert.NotNil(t, v.Verify([]*x509.Certificate{otherCA.issue(t, 2)}))
+	assert.ErrorIs(t, v.Verify([]*x509.Certificate{}), errMissingClientCertificate)
+}
+
+func TestClientVerifierRevocation(t *testing.T) {
+	ca := newTestCA(t, "ca")
+
+	v, err := NewClientVerifier(config.ClientAuth{CAFile: ca.file, CRLFile: ca.revoke(t, 3)})
+	assert.Nil(t, err)
+
+	assert.Nil(t, v.Verify([]*x509.Certificate{ca.issue(t, 2)}))
+	assert.ErrorIs(t, v.Verify([]*x509.Certificate{ca.issue(t, 3)}), errRevokedClientCertificate)
+}
+
+func TestClientVerifierRejectsForeignCRL(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	otherCA := newTestCA(t, "other")
+
+	_, err := NewClientVerifier(config.ClientAuth{CAFile: ca.file, CRLFile: otherCA.revoke(t, 3)})
+	assert.NotNil(t, err)
+
+	_, err = NewClientVerifier(config.ClientAuth{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.NotNil(t, err)
+}
+
+func TestApplyClientAuthModes(t *testing.T) {
+	ca := newTestCA(t, "ca")
+
+	modes := map[string]crypto_tls.ClientAuthType{
+		config.ClientAuthRequire:       crypto_tls.RequireAndVerifyClientCert,
+		config.ClientAuthVerifyIfGiven: crypto_tls.VerifyClientCertIfGiven,
+		config.ClientAuthOptional:      crypto_tls.RequestClientCert,
+	}
+
+	for mode, expected := range modes {
+		c, err := applyClientAuth(newDefaultTLSConfig(), config.ClientAuth{Mode: mode, CAFile: ca.file})
+		assert.Nil(t, err)
+		assert.Equal(t, expected, c.ClientAuth, mode)
+		assert.NotNil(t, c.ClientCAs)
+	}
+}
+
+func TestReturnConfigBySNI(t *testing.T) {
+	ca := newTestCA(t, "ca")
+
+	assert.Nil(t, registerClientAuth("mtls.example.com", newDefaultTLSConfig(), config.ClientAuth{Mode: config.ClientAuthRequire, CAFile: ca.file}))
+	assert.Nil(t, registerClientAuth("www.example.com", newDefaultTLSConfig(), config.ClientAuth{}))
+
+	c, err := returnConfig(&crypto_tls.ClientHelloInfo{ServerName: "mtls.example.com"})
+	assert.Nil(t, err)
+	assert.Equal(t, crypto_tls.RequireAndVerifyClientCert, c.ClientAuth)
+
+	c, err = returnConfig(&crypto_tls.ClientHelloInfo{ServerName: "www.example.com"})
+	assert.Nil(t, err)
+	assert.Nil(t, c)
+}
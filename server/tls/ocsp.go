@@ -0,0 +1,302 @@
+package tls
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	crypto_tls "crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/logger"
+)
+
+// StaplesCheckInterval - How often the OCSP staples are checked for refresh.
+var StaplesCheckInterval = 1 * time.Minute
+
+const stapleRetryInterval = 5 * time.Minute
+const stapleDefaultRefreshInterval = 1 * time.Hour
+const ocspRequestTimeout = 10 * time.Second
+const maxOCSPResponseSize = 1 << 20
+
+var errMissingIssuer = errors.New("missing issuer certificate in the chain")
+var errMissingResponder = errors.New("missing OCSP responder")
+var errCertificateNotGood = errors.New("certificate status is not good")
+
+// stapleJob - A staple to be fetched, the request is sent without holding
+// certificatesMu.
+type stapleJob struct {
+	source *certificateSource
+	conf   config.OCSP
+	leaf   *x509.Certificate
+	issuer *x509.Certificate
+}
+
+func getLeaf(cert *crypto_tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+
+	return x509.ParseCertificate(cert.Certificate[0])
+}
+
+// getIssuer - Returns the issuer of the leaf, it must follow it in the chain.
+func getIssuer(cert *crypto_tls.Certificate) (*x509.Certificate, error) {
+	if len(cert.Certificate) < 2 {
+		return nil, errMissingIssuer
+	}
+
+	return x509.ParseCertificate(cert.Certificate[1])
+}
+
+// getStapleRefreshTime - The staple is refreshed halfway through its
+// validity period.
+func getStapleRefreshTime(resp *ocsp.Response, now time.Time) time.Time {
+	if resp.NextUpdate.IsZero() {
+		return now.Add(stapleDefaultRefreshInterval)
+	}
+
+	return resp.ThisUpdate.Add(resp.NextUpdate.Sub(resp.ThisUpdate) / 2)
+}
+
+// parseStaple - Validates the response for the certificate: it must be
+// signed by the issuer (or its delegate), good and not expired.
+func parseStaple(raw []byte, leaf *x509.Certificate, issuer *x509.Certificate, now time.Time) (*ocsp.Response, error) {
+	resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Status != ocsp.Good {
+		return nil, errors.Wrapf(errCertificateNotGood, "status %d", resp.Status)
+	}
+
+	if !resp.NextUpdate.IsZero() && !now.Before(resp.NextUpdate) {
+		return nil, fmt.Errorf("expired OCSP response (next update: %s)", resp.NextUpdate)
+	}
+
+	return resp, nil
+}
+
+// fetchStaple - Requests the certificate's status to the responder.
+func fetchStaple(conf config.OCSP, leaf *x509.Certificate, issuer *x509.Certificate) ([]byte, *ocsp.Response, error) {
+	responder := conf.Responder
+	if responder == "" && len(leaf.OCSPServer) > 0 {
+		responder = leaf.OCSPServer[0]
+	}
+
+	if responder == "" {
+		return nil, nil, errMissingResponder
+	}
+
+	reqBody, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client := &http.Client{Timeout: ocspRequestTimeout}
+
+	res, err := client.Post(responder, "application/ocsp-request", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected OCSP responder status %d", res.StatusCode)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(res.Body, maxOCSPResponseSize))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := parseStaple(raw, leaf, issuer, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return raw, resp, nil
+}
+
+// getStapleCacheFile - Returns the file persisting the certificate's staple.
+func getStapleCacheFile(conf config.OCSP, leaf *x509.Certificate) string {
+	if conf.CacheDir == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256(leaf.Raw)
+
+	return filepath.Join(conf.CacheDir, hex.EncodeToString(sum[:])+".ocsp")
+}
+
+func writeCachedStaple(conf config.OCSP, leaf *x509.Certificate, raw []byte) {
+	file := getStapleCacheFile(conf, leaf)
+	if file == "" {
+		return
+	}
+
+	if err := os.MkdirAll(conf.CacheDir, 0700); err != nil {
+		logger.GetGlobal().Errorf("Cannot create the OCSP cache directory: %s", err)
+		return
+	}
+
+	if err := os.WriteFile(file, raw, 0600); err != nil {
+		logger.GetGlobal().Errorf("Cannot persist the OCSP staple: %s", err)
+	}
+}
+
+// prepareStaple - Staples the persisted response to the (not yet served)
+// certificate, when still valid. Otherwise it's fetched on the next check.
+// Without the issuer in the chain there's nothing to staple (until reloaded).
+func prepareStaple(domain string, source *certificateSource) {
+	source.stapleRefreshAt = time.Time{}
+	source.stapleJob = nil
+
+	if !source.ocsp.Enabled {
+		return
+	}
+
+	leaf, err := getLeaf(source.cert)
+	if err == nil {
+		var issuer *x509.Certificate
+		issuer, err = getIssuer(source.cert)
+		source.stapleJob = &stapleJob{source: source, conf: source.ocsp, leaf: leaf, issuer: issuer}
+	}
+
+	if err != nil {
+		source.stapleJob = nil
+		logger.GetGlobal().Errorf("Cannot staple the OCSP response of '%s': %s", domain, err)
+
+		return
+	}
+
+	file := getStapleCacheFile(source.ocsp, leaf)
+	if file == "" {
+		return
+	}
+
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+
+	resp, err := parseStaple(raw, leaf, source.stapleJob.issuer, time.Now())
+	if err != nil {
+		return
+	}
+
+	source.cert.OCSPStaple = raw
+	source.stapleRefreshAt = getStapleRefreshTime(resp, time.Now())
+}
+
+// getStapleJobs - Returns the staples due for refresh.
+// It must be called holding certificatesMu.
+func getStapleJobs(now time.Time) []stapleJob {
+	jobs := []stapleJob{}
+
+	for _, sources := range certificateSources {
+		for _, source := range sources {
+			if source.stapleJob != nil && !now.Before(source.stapleRefreshAt) {
+				jobs = append(jobs, *source.stapleJob)
+			}
+		}
+	}
+
+	return jobs
+}
+
+// RefreshStaples - Fetches the missing (or about to expire) OCSP staples,
+// the certificates are swapped so the new handshakes serve them.
+func RefreshStaples() {
+	certificatesMu.Lock()
+	jobs := getStapleJobs(time.Now())
+	certificatesMu.Unlock()
+
+	for _, job := range jobs {
+		raw, resp, err := fetchStaple(job.conf, job.leaf, job.issuer)
+
+		certificatesMu.Lock()
+
+		// The certificate could have been reloaded in the meantime.
+		if job.source.stapleJob == nil || job.source.stapleJob.leaf != job.leaf {
+			certificatesMu.Unlock()
+			continue
+		}
+
+		if err != nil {
+			logger.GetGlobal().Errorf("Cannot fetch the OCSP staple for %s: %s", job.source.certFile, err)
+			job.source.stapleRefreshAt = time.Now().Add(stapleRetryInterval)
+			dropStaple(job, err)
+			certificatesMu.Unlock()
+
+			continue
+		}
+
+		stapled := *job.source.cert
+		stapled.OCSPStaple = raw
+		job.source.cert = &stapled
+		job.source.stapleRefreshAt = getStapleRefreshTime(resp, time.Now())
+		storeCertificates()
+
+		certificatesMu.Unlock()
+
+		writeCachedStaple(job.conf, job.leaf, raw)
+
+		logger.GetGlobal().Infof("OCSP staple for %s refreshed (next update: %s).", job.source.certFile, resp.NextUpdate)
+	}
+}
+
+// dropStaple - Stops serving the staple when the certificate is not good
+// anymore or when the staple has expired (a stale one is worse than none).
+// It must be called holding certificatesMu.
+func dropStaple(job stapleJob, err error) {
+	staple := job.source.cert.OCSPStaple
+	if staple == nil {
+		return
+	}
+
+	if !errors.Is(err, errCertificateNotGood) {
+		if _, err := parseStaple(staple, job.leaf, job.issuer, time.Now()); err == nil {
+			return
+		}
+	}
+
+	unstapled := *job.source.cert
+	unstapled.OCSPStaple = nil
+	job.source.cert = &unstapled
+	storeCertificates()
+
+	logger.GetGlobal().Warnf("OCSP staple for %s dropped.", job.source.certFile)
+}
+
+// WatchStaples - Keeps the OCSP staples fresh, checking them every
+// StaplesCheckInterval.
+func WatchStaples() {
+	RefreshStaples()
+
+	t := time.NewTicker(StaplesCheckInterval)
+	defer t.Stop()
+
+	for range t.C {
+		RefreshStaples()
+	}
+}
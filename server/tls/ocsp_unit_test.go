@@ -0,0 +1,205 @@
+//go:build all || unit
+// +build all unit
+
+package tls
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	crypto_tls "crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ocsp"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+// newTestResponder - Returns an OCSP responder signing with the CA, counting
+// the requests.
+func newTestResponder(t *testing.T, ca testCA, status int) (*httptest.Server, *int32) {
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		body, _ := io.ReadAll(r.Body)
+		req, err := ocsp.ParseRequest(body)
+		assert.Nil(t, err)
+
+		resp, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   time.Now().Add(-1 * time.Hour),
+			NextUpdate:   time.Now().Add(24 * time.Hour),
+		}, ca.key)
+		assert.Nil(t, err)
+
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		_, _ = w.Write(resp)
+	}))
+
+	return srv, &requests
+}
+
+// issueChain - Returns a certificate (followed by its issuer) and its key.
+func (ca testCA) issueChain(t *testing.T, name string) (string, string) {
+	certFile, keyFile := ca.issueKeyPair(t, name)
+
+	leaf, err := os.ReadFile(certFile)
+	assert.Nil(t, err)
+	issuer, err := os.ReadFile(ca.file)
+	assert.Nil(t, err)
+
+	assert.Nil(t, os.WriteFile(certFile, append(leaf, issuer...), 0o600))
+
+	return certFile, keyFile
+}
+
+func getServedStaple(t *testing.T, name string) []byte {
+	cert, err := returnCert(&crypto_tls.ClientHelloInfo{ServerName: name})
+	assert.Nil(t, err)
+
+	return cert.OCSPStaple
+}
+
+func TestRefreshStaples(t *testing.T) {
+	resetCertificates()
+	defer resetCertificates()
+
+	ca := newTestCA(t, "ca")
+	responder, requests := newTestResponder(t, ca, ocsp.Good)
+	defer responder.Close()
+
+	certFile, keyFile := ca.issueChain(t, "ocsp.example.com")
+	ocspConfig := config.OCSP{Enabled: true, Responder: responder.URL, CacheDir: filepath.Join(t.TempDir(), "ocsp")}
+
+	assert.Nil(t, loadCertificates("ocsp.example.com", []config.CertificatePair{{CertFile: certFile, KeyFile: keyFile}}, ocspConfig))
+	assert.Empty(t, getServedStaple(t, "ocsp.example.com"))
+
+	RefreshStaples()
+	staple := getServedStaple(t, "ocsp.example.com")
+	assert.NotEmpty(t, staple)
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	// Fresh: not requested again.
+	RefreshStaples()
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	// Persisted: stapled right away on the next load.
+	assert.Nil(t, loadCertificates("ocsp.example.com", []config.CertificatePair{{CertFile: certFile, KeyFile: keyFile}}, ocspConfig))
+	assert.Equal(t, staple, getServedStaple(t, "ocsp.example.com"))
+
+	RefreshStaples()
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+}
+
+func TestRefreshStaplesRejectsRevoked(t *testing.T) {
+	resetCertificates()
+	defer resetCertificates()
+
+	ca := newTestCA(t, "ca")
+	responder, requests := newTestResponder(t, ca, ocsp.Revoked)
+	defer responder.Close()
+
+	certFile, keyFile := ca.issueChain(t, "revoked.example.com")
+	ocspConfig := config.OCSP{Enabled: true, Responder: responder.URL}
+
+	assert.Nil(t, loadCertificates("revoked.example.com", []config.CertificatePair{{CertFile: certFile, KeyFile: keyFile}}, ocspConfig))
+
+	RefreshStaples()
+	assert.Empty(t, getServedStaple(t, "revoked.example.com"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+
+	// Retried later, not on every check.
+	RefreshStaples()
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+}
+
+// setStaple - Serves the staple and points the next refresh (due now) to the
+// responder.
+func setStaple(name string, staple []byte, responder string) {
+	certificatesMu.Lock()
+	defer certificatesMu.Unlock()
+
+	source := certificateSources[name][0]
+	stapled := *source.cert
+	stapled.OCSPStaple = staple
+	source.cert = &stapled
+	source.stapleJob.conf.Responder = responder
+	source.stapleRefreshAt = time.Time{}
+	storeCertificates()
+}
+
+func TestRefreshStaplesDropsStaleStaple(t *testing.T) {
+	resetCertificates()
+	defer resetCertificates()
+
+	ca := newTestCA(t, "ca")
+	responder, _ := newTestResponder(t, ca, ocsp.Good)
+	defer responder.Close()
+	revokedResponder, _ := newTestResponder(t, ca, ocsp.Revoked)
+	defer revokedResponder.Close()
+	offline := httptest.NewServer(http.NotFoundHandler())
+	offline.Close()
+
+	certFile, keyFile := ca.issueChain(t, "stale.example.com")
+	ocspConfig := config.OCSP{Enabled: true, Responder: responder.URL}
+
+	assert.Nil(t, loadCertificates("stale.example.com", []config.CertificatePair{{CertFile: certFile, KeyFile: keyFile}}, ocspConfig))
+
+	RefreshStaples()
+	staple := getServedStaple(t, "stale.example.com")
+	assert.NotEmpty(t, staple)
+
+	// Still valid: kept while the responder is unreachable.
+	setStaple("stale.example.com", staple, offline.URL)
+	RefreshStaples()
+	assert.Equal(t, staple, getServedStaple(t, "stale.example.com"))
+
+	// Revoked in the meantime.
+	setStaple("stale.example.com", staple, revokedResponder.URL)
+	RefreshStaples()
+	assert.Empty(t, getServedStaple(t, "stale.example.com"))
+
+	// Past its next update.
+	expired, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: certificateSources["stale.example.com"][0].stapleJob.leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-2 * time.Hour),
+		NextUpdate:   time.Now().Add(-1 * time.Hour),
+	}, ca.key)
+	assert.Nil(t, err)
+
+	setStaple("stale.example.com", expired, offline.URL)
+	RefreshStaples()
+	assert.Empty(t, getServedStaple(t, "stale.example.com"))
+}
+
+func TestPrepareStapleWithoutIssuer(t *testing.T) {
+	resetCertificates()
+	defer resetCertificates()
+
+	ca := newTestCA(t, "ca")
+	certFile, keyFile := ca.issueKeyPair(t, "leaf.example.com")
+
+	assert.Nil(t, loadCertificates("leaf.example.com", []config.CertificatePair{{CertFile: certFile, KeyFile: keyFile}}, config.OCSP{Enabled: true}))
+
+	certificatesMu.Lock()
+	assert.Empty(t, getStapleJobs(time.Now()))
+	certificatesMu.Unlock()
+}
@@ -0,0 +1,245 @@
+package tls
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"crypto/ecdsa"
+	crypto_tls "crypto/tls"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/logger"
+)
+
+// CertificatesWatchInterval - How often the certificate files are checked
+// for changes.
+var CertificatesWatchInterval = 1 * time.Minute
+
+// defaultCertificateKey - Key of the default certificate, served when no
+// other one matches.
+const defaultCertificateKey = ""
+
+// certificateSource - Files of a certificate, with their state when last
+// loaded.
+type certificateSource struct {
+	certFile string
+	keyFile  string
+	state    string
+	cert     *crypto_tls.Certificate
+	ocsp     config.OCSP
+	// stapleJob - The OCSP staple's request, nil when not stapled.
+	stapleJob       *stapleJob
+	stapleRefreshAt time.Time
+}
+
+// certificates - Holds the certificateIndex, it's replaced (never modified)
+// so the handshakes read it without locks.
+var certificates atomic.Value
+
+// certificatesMu - Serialises the writers of certificates and sources.
+var certificatesMu sync.Mutex
+
+// certificateSources - The loaded certificates, by domain.
+var certificateSources = make(map[string][]*certificateSource)
+
+// certificateIndex - Certificates by name: the domains and the names in
+// their certificates (wildcards included).
+type certificateIndex map[string][]*crypto_tls.Certificate
+
+func getCertificates() certificateIndex {
+	if c, ok := certificates.Load().(certificateIndex); ok {
+		return c
+	}
+
+	return certificateIndex{}
+}
+
+// getCertificate - Returns the certificates for the server name: by exact
+// name, by wildcard (one label only) or the default ones.
+func getCertificate(serverName string) ([]*crypto_tls.Certificate, bool) {
+	index := getCertificates()
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+
+	if name != "" {
+		if certs, ok := index[name]; ok {
+			return certs, true
+		}
+
+		if i := strings.Index(name, "."); i > 0 {
+			if certs, ok := index["*"+name[i:]]; ok {
+				return certs, true
+			}
+		}
+	}
+
+	certs, ok := index[defaultCertificateKey]
+
+	return certs, ok
+}
+
+// storeCertificates - Rebuilds the index, the new handshakes use it while the
+// established connections are untouched.
+// It must be called holding certificatesMu.
+func storeCertificates() {
+	domains := make([]string, 0, len(certificateSources))
+	for domain := range certificateSources {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	index := certificateIndex{}
+
+	// The names in the certificates first, so the domains take precedence.
+	for _, domain := range domains {
+		for _, source := range certificateSources[domain] {
+			if domain == defaultCertificateKey || source.cert.Leaf == nil {
+				continue
+			}
+
+			for _, name := range source.cert.Leaf.DNSNames {
+				name = strings.ToLower(name)
+				index[name] = appendCertificate(index[name], source.cert)
+			}
+		}
+	}
+
+	for _, domain := range domains {
+		name := strings.ToLower(domain)
+		delete(index, name)
+
+		for _, source := range certificateSources[domain] {
+			index[name] = appendCertificate(index[name], source.cert)
+		}
+	}
+
+	certificates.Store(index)
+}
+
+// appendCertificate - Adds the certificate (once), keeping the ECDSA ones
+// first as they're cheaper (when supported by the client).
+func appendCertificate(certs []*crypto_tls.Certificate, cert *crypto_tls.Certificate) []*crypto_tls.Certificate {
+	for _, v := range certs {
+		if v == cert {
+			return certs
+		}
+	}
+
+	certs = append(certs, cert)
+	sort.SliceStable(certs, func(i, j int) bool {
+		_, iECDSA := certs[i].PrivateKey.(*ecdsa.PrivateKey)
+		_, jECDSA := certs[j].PrivateKey.(*ecdsa.PrivateKey)
+
+		return iECDSA && !jECDSA
+	})
+
+	return certs
+}
+
+// getFilesState - Returns a fingerprint of the files' size and modification
+// time (the symlinks are followed, e.g. Kubernetes' mounted secrets).
+func getFilesState(files ...string) string {
+	state := ""
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return ""
+		}
+
+		state += info.ModTime().String() + "|" + strconv.FormatInt(info.Size(), 10) + "|"
+	}
+
+	return state
+}
+
+// loadCertificates - Loads the domain's certificates (replacing the previous
+// ones) and keeps track of their files for the reloads.
+func loadCertificates(domain string, pairs []config.CertificatePair, ocspConfig config.OCSP) error {
+	sources := make([]*certificateSource, 0, len(pairs))
+
+	for _, v := range pairs {
+		state := getFilesState(v.CertFile, v.KeyFile)
+
+		cert, err := crypto_tls.LoadX509KeyPair(v.CertFile, v.KeyFile)
+		if err != nil {
+			return err
+		}
+
+		source := &certificateSource{certFile: v.CertFile, keyFile: v.KeyFile, state: state, cert: &cert, ocsp: ocspConfig}
+		prepareStaple(domain, source)
+
+		sources = append(sources, source)
+	}
+
+	certificatesMu.Lock()
+	defer certificatesMu.Unlock()
+
+	certificateSources[domain] = sources
+	storeCertificates()
+
+	return nil
+}
+
+// ReloadCertificates - Reads again the certificate files (the client CAs and
+// the upstream ones too), when forced even if unchanged. On failure the
+// certificate is kept (and it's retried on the next reload).
+func ReloadCertificates(force bool) {
+	certificatesMu.Lock()
+	defer certificatesMu.Unlock()
+
+	reloaded := false
+
+	for domain, sources := range certificateSources {
+		for _, source := range sources {
+			state := getFilesState(source.certFile, source.keyFile)
+			if !force && (state == "" || state == source.state) {
+				continue
+			}
+
+			cert, err := crypto_tls.LoadX509KeyPair(source.certFile, source.keyFile)
+			if err != nil {
+				logger.GetGlobal().Errorf("Cannot reload the TLS certificate %s of '%s': %s", source.certFile, domain, err)
+				continue
+			}
+
+			source.cert = &cert
+			source.state = state
+			prepareStaple(domain, source)
+			reloaded = true
+
+			logger.GetGlobal().Infof("TLS certificate %s of '%s' reloaded.", source.certFile, domain)
+		}
+	}
+
+	if reloaded {
+		storeCertificates()
+	}
+
+	reloadClientAuth(force)
+	reloadUpstreamTLS(force)
+}
+
+// WatchCertificates - Reloads the certificates (the client CAs and the
+// upstream ones too) whose files have changed, checking them every
+// CertificatesWatchInterval.
+func WatchCertificates() {
+	t := time.NewTicker(CertificatesWatchInterval)
+	defer t.Stop()
+
+	for range t.C {
+		ReloadCertificates(false)
+	}
+}
@@ -0,0 +1,142 @@
+//go:build all || unit
+// +build all unit
+
+package tls
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	crypto_tls "crypto/tls"
+	"crypto/x509"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+// replaceFiles - Copies the key pair over the files, moving their
+// modification time forward (the filesystem could be too coarse).
+func replaceFiles(t *testing.T, certFile string, keyFile string, newCertFile string, newKeyFile string) {
+	for dst, src := range map[string]string{certFile: newCertFile, keyFile: newKeyFile} {
+		content, err := os.ReadFile(src)
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(dst, content, 0o600))
+
+		future := time.Now().Add(1 * time.Hour)
+		assert.Nil(t, os.Chtimes(dst, future, future))
+	}
+}
+
+func TestReloadCertificates(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	certFile, keyFile := ca.issueKeyPair(t, "reload.example.com")
+
+	assert.Nil(t, loadCertificates("reload.example.com", []config.CertificatePair{{CertFile: certFile, KeyFile: keyFile}}, config.OCSP{}))
+	original, _ := getCertificate("reload.example.com")
+
+	// Unchanged files: nothing to reload.
+	ReloadCertificates(false)
+	current, _ := getCertificate("reload.example.com")
+	assert.Same(t, original[0], current[0])
+
+	newCertFile, newKeyFile := ca.issueKeyPair(t, "reload.example.com")
+	replaceFiles(t, certFile, keyFile, newCertFile, newKeyFile)
+
+	ReloadCertificates(false)
+	current, _ = getCertificate("reload.example.com")
+	assert.NotEqual(t, original[0].Certificate[0], current[0].Certificate[0])
+
+	served, err := returnCert(&crypto_tls.ClientHelloInfo{ServerName: "reload.example.com"})
+	assert.Nil(t, err)
+	assert.Same(t, current[0], served)
+}
+
+func TestReloadCertificatesKeepsPreviousOnError(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	certFile, keyFile := ca.issueKeyPair(t, "broken.example.com")
+
+	assert.Nil(t, loadCertificates("broken.example.com", []config.CertificatePair{{CertFile: certFile, KeyFile: keyFile}}, config.OCSP{}))
+	original, _ := getCertificate("broken.example.com")
+
+	// A certificate not matching the key (e.g. a partially rotated secret).
+	otherCertFile, _ := ca.issueKeyPair(t, "broken.example.com")
+	replaceFiles(t, certFile, keyFile, otherCertFile, keyFile)
+
+	ReloadCertificates(true)
+	current, _ := getCertificate("broken.example.com")
+	assert.Same(t, original[0], current[0])
+}
+
+func TestReloadClientAuth(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	crlFile := ca.revoke(t, 3)
+	conf := config.ClientAuth{Mode: config.ClientAuthRequire, CAFile: ca.file, CRLFile: crlFile}
+
+	assert.Nil(t, registerClientAuth("reload-mtls.example.com", newDefaultTLSConfig(), conf))
+	original, _ := returnConfig(&crypto_tls.ClientHelloInfo{ServerName: "reload-mtls.example.com"})
+
+	v, err := GetClientVerifier(conf)
+	assert.Nil(t, err)
+	assert.Nil(t, v.Verify([]*x509.Certificate{ca.issue(t, 2)}))
+
+	// Unchanged files: nothing to reload.
+	ReloadCertificates(false)
+	current, _ := returnConfig(&crypto_tls.ClientHelloInfo{ServerName: "reload-mtls.example.com"})
+	assert.Same(t, original, current)
+
+	content, err := os.ReadFile(ca.revoke(t, 2, 3))
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(crlFile, content, 0o600))
+
+	future := time.Now().Add(1 * time.Hour)
+	assert.Nil(t, os.Chtimes(crlFile, future, future))
+
+	ReloadCertificates(false)
+	current, _ = returnConfig(&crypto_tls.ClientHelloInfo{ServerName: "reload-mtls.example.com"})
+	assert.NotSame(t, original, current)
+
+	v, err = GetClientVerifier(conf)
+	assert.Nil(t, err)
+	assert.ErrorIs(t, v.Verify([]*x509.Certificate{ca.issue(t, 2)}), errRevokedClientCertificate)
+}
+
+func TestReloadUpstreamTLS(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	certFile, keyFile := ca.issueKeyPair(t, "")
+	conf := config.UpstreamTLS{CAFile: ca.file, CertFile: certFile, KeyFile: keyFile}
+
+	original, err := UpstreamConfig(conf, false)
+	assert.Nil(t, err)
+
+	// Unchanged files: nothing to reload.
+	generation := UpstreamGeneration()
+	ReloadCertificates(false)
+	assert.Equal(t, generation, UpstreamGeneration())
+
+	newCertFile, newKeyFile := ca.issueKeyPair(t, "")
+	for src, dst := range map[string]string{newCertFile: certFile, newKeyFile: keyFile} {
+		content, err := os.ReadFile(src)
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(dst, content, 0o600))
+
+		future := time.Now().Add(1 * time.Hour)
+		assert.Nil(t, os.Chtimes(dst, future, future))
+	}
+
+	ReloadCertificates(false)
+	assert.Greater(t, UpstreamGeneration(), generation)
+
+	current, err := UpstreamConfig(conf, false)
+	assert.Nil(t, err)
+	assert.NotEqual(t, original.Certificates[0].Certificate, current.Certificates[0].Certificate)
+}
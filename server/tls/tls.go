@@ -12,8 +12,6 @@ package tls
 import (
 	crypto_tls "crypto/tls"
 	"net/http"
-	"os"
-	"path/filepath"
 
 	"github.com/pkg/errors"
 
@@ -23,7 +21,6 @@ import (
 )
 
 var httpsDomains []string
-var certificates map[string]*crypto_tls.Certificate = make(map[string]*crypto_tls.Certificate)
 var tlsConfig *crypto_tls.Config
 
 // newDefaultTLSConfig - Builds the base TLS configuration.
@@ -50,38 +47,55 @@ var errMissingCertificateOrKey = errors.New("missing certificate file and/or key
 // ServerOverrides - Overrides the http.Server configuration for TLS.
 func ServerOverrides(domain string, server *http.Server, domainConfig config.Server) (err error) {
 	if domainConfig.TLS.Auto {
-		certManager := InitCertManager(domainConfig.Upstream.Host, domainConfig.TLS.Email, domainConfig.TLS.CertCacheDir)
-		server.TLSConfig = certManager.TLSConfig()
+		certManager, err := InitCertManager(domainConfig.Upstream.Host, domainConfig.Upstream.GetDomainID(), domainConfig.TLS)
+		if err != nil {
+			return err
+		}
 
-		return nil
+		server.TLSConfig = certManager.TLSConfig()
+		if domainConfig.TLS.ACME.KeyType == config.ACMEKeyTypeRSA {
+			server.TLSConfig.GetCertificate = forceRSA(certManager.GetCertificate)
+		}
+	} else {
+		tlsConfig, err = Config(domain, domainConfig.TLS)
+		if err != nil {
+			return err
+		}
+
+		server.TLSConfig = tlsConfig
+		// TODO: check this: server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler), 0),
 	}
 
-	tlsConfig, err = Config(domain, domainConfig.TLS)
-	if err != nil {
+	if err := registerClientAuth(domain, server.TLSConfig, domainConfig.TLS.ClientAuth); err != nil {
 		return err
 	}
 
-	server.TLSConfig = tlsConfig
-	// TODO: check this: server.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler), 0),
+	// The domains share the listeners, the SNI selects the domain's client
+	// certificates verification.
+	server.TLSConfig.GetConfigForClient = returnConfig
 
 	return nil
 }
 
 // Config - Returns a TLS configuration.
 func Config(domain string, domainConfigTLS config.TLS) (*crypto_tls.Config, error) {
-	if domainConfigTLS.CertFile == "" || domainConfigTLS.KeyFile == "" {
+	pairs := domainConfigTLS.GetCertificatePairs()
+	for _, v := range pairs {
+		if v.CertFile == "" || v.KeyFile == "" {
+			return nil, errMissingCertificateOrKey
+		}
+	}
+
+	if len(pairs) == 0 {
 		return nil, errMissingCertificateOrKey
 	}
 
-	cert, err := crypto_tls.LoadX509KeyPair(domainConfigTLS.CertFile, domainConfigTLS.KeyFile)
-	if err != nil {
+	// NOTE: The certificates are kept by domain (and picked by SNI), so the
+	//       previously configured domains keep working.
+	if err := loadCertificates(domain, pairs, domainConfigTLS.OCSP); err != nil {
 		return nil, err
 	}
 
-	// NOTE: This is workaround in order to keep the TLS certificates from
-	//       previously configured domains.
-	certificates[domain] = &cert
-
 	// Build a fresh config per domain. The previous code copied a shared
 	// *tls.Config pointer and appended to its Certificates slice, so every
 	// additional domain re-appended ALL known certificates to the same shared
@@ -89,51 +103,70 @@ func Config(domain string, domainConfigTLS config.TLS) (*crypto_tls.Config, erro
 	// mutating one shared config.
 	tlsConfig := newDefaultTLSConfig()
 
-	// If GetCertificate is nil or returns nil, then the certificate is
-	// retrieved from NameToCertificate. If NameToCertificate is nil, the
-	// best element of Certificates will be used.
-	// Ref: https://golang.org/pkg/crypto/tls/#Config.GetCertificate
-	tlsConfig.Certificates = make([]crypto_tls.Certificate, 0, len(certificates))
-	for _, c := range certificates {
-		tlsConfig.Certificates = append(tlsConfig.Certificates, *c)
+	// The certificates are always picked by returnCert (GetCertificate), so
+	// the reloaded ones are served.
+	return tlsConfig, nil
+}
+
+// LoadDefaultCertificate - Loads the certificate served when no other one
+// matches the SNI (if configured).
+func LoadDefaultCertificate(conf config.TLS) error {
+	if conf.DefaultCertFile == "" || conf.DefaultKeyFile == "" {
+		return nil
 	}
 
-	return tlsConfig, nil
+	return loadCertificates(defaultCertificateKey, []config.CertificatePair{{CertFile: conf.DefaultCertFile, KeyFile: conf.DefaultKeyFile}}, conf.OCSP)
 }
 
+// returnCert - Picks the certificate for the SNI (see getCertificate), the
+// first one supported by the client (e.g. ECDSA or RSA).
 func returnCert(helloInfo *crypto_tls.ClientHelloInfo) (*crypto_tls.Certificate, error) {
 	logger.GetGlobal().Debugf("HelloInfo: %+v\n", helloInfo)
 
-	if val, ok := certificates[helloInfo.ServerName]; ok {
-		return val, nil
+	certs, ok := getCertificate(helloInfo.ServerName)
+	if !ok || len(certs) == 0 {
+		return nil, errors.Wrapf(errMissingCertificate, "ServerName %s", helloInfo.ServerName)
+	}
+
+	for _, v := range certs {
+		if helloInfo.SupportsCertificate(v) == nil {
+			return v, nil
+		}
 	}
 
-	return nil, errors.Wrapf(errMissingCertificate, "ServerName %s", helloInfo.ServerName)
+	// Let the handshake fail with the most meaningful error.
+	return certs[0], nil
 }
 
 // InitCertManager - Initialise the Certification Manager for auto generation.
-func InitCertManager(host string, email string, cacheDir string) *autocert.Manager {
-	// The autocert cache must be stable across restarts: the previous
-	// os.MkdirTemp call created a fresh directory on every boot, forcing a new
-	// certificate issuance from the ACME CA on each restart and burning through
-	// Let's Encrypt rate limits (which can lock the domain out of issuance).
-	if cacheDir == "" {
-		cacheDir = filepath.Join(os.TempDir(), "go-proxy-cache-autocert")
+// The certificates are stored in the domain's Redis (connName) when
+// configured, so the instances share them.
+func InitCertManager(host string, connName string, conf config.TLS) (*autocert.Manager, error) {
+	cache, err := getACMECache(connName, conf)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := os.MkdirAll(cacheDir, 0700); err != nil {
-		logger.GetGlobal().Fatal(err)
-		return nil
+	client, err := getACMEClient(conf.ACME)
+	if err != nil {
+		return nil, err
+	}
+
+	eab, err := getExternalAccountBinding(conf.ACME)
+	if err != nil {
+		return nil, err
 	}
 
 	httpsDomains = append(httpsDomains, host)
 
 	certManager := &autocert.Manager{
-		Cache:      autocert.DirCache(cacheDir),
-		Prompt:     autocert.AcceptTOS,
-		HostPolicy: autocert.HostWhitelist(httpsDomains...),
-		Email:      email,
+		Cache:                  cache,
+		Prompt:                 autocert.AcceptTOS,
+		HostPolicy:             autocert.HostWhitelist(httpsDomains...),
+		Email:                  conf.Email,
+		Client:                 client,
+		ExternalAccountBinding: eab,
 	}
 
-	return certManager
+	return certManager, nil
 }
@@ -0,0 +1,125 @@
+//go:build all || unit
+// +build all unit
+
+package tls
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	crypto_tls "crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+func resetCertificates() {
+	certificatesMu.Lock()
+	defer certificatesMu.Unlock()
+
+	certificateSources = make(map[string][]*certificateSource)
+	storeCertificates()
+}
+
+func servedName(t *testing.T, hello *crypto_tls.ClientHelloInfo) string {
+	cert, err := returnCert(hello)
+	if err != nil {
+		return ""
+	}
+
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestReturnCertByName(t *testing.T) {
+	resetCertificates()
+	defer resetCertificates()
+
+	ca := newTestCA(t, "ca")
+	exactCert, exactKey := ca.issueKeyPair(t, "api.example.com")
+	wildcardCert, wildcardKey := ca.issueKeyPair(t, "*.example.com")
+
+	assert.Nil(t, loadCertificates("api.example.com", []config.CertificatePair{{CertFile: exactCert, KeyFile: exactKey}}, config.OCSP{}))
+	assert.Nil(t, loadCertificates("example.com", []config.CertificatePair{{CertFile: wildcardCert, KeyFile: wildcardKey}}, config.OCSP{}))
+
+	assert.Equal(t, "api.example.com", servedName(t, &crypto_tls.ClientHelloInfo{ServerName: "API.example.com."}))
+	assert.Equal(t, "*.example.com", servedName(t, &crypto_tls.ClientHelloInfo{ServerName: "www.example.com"}))
+	assert.Equal(t, "*.example.com", servedName(t, &crypto_tls.ClientHelloInfo{ServerName: "example.com"}))
+
+	// The wildcard matches one label only.
+	assert.Empty(t, servedName(t, &crypto_tls.ClientHelloInfo{ServerName: "a.b.example.com"}))
+	assert.Empty(t, servedName(t, &crypto_tls.ClientHelloInfo{}))
+}
+
+func TestReturnCertDefault(t *testing.T) {
+	resetCertificates()
+	defer resetCertificates()
+
+	ca := newTestCA(t, "ca")
+	domainCert, domainKey := ca.issueKeyPair(t, "www.example.com")
+	defaultCert, defaultKey := ca.issueKeyPair(t, "default.example.com")
+
+	assert.Nil(t, LoadDefaultCertificate(config.TLS{}))
+	assert.Nil(t, loadCertificates("www.example.com", []config.CertificatePair{{CertFile: domainCert, KeyFile: domainKey}}, config.OCSP{}))
+	assert.Nil(t, LoadDefaultCertificate(config.TLS{DefaultCertFile: defaultCert, DefaultKeyFile: defaultKey}))
+
+	assert.Equal(t, "www.example.com", servedName(t, &crypto_tls.ClientHelloInfo{ServerName: "www.example.com"}))
+	assert.Equal(t, "default.example.com", servedName(t, &crypto_tls.ClientHelloInfo{ServerName: "unknown.example.org"}))
+	assert.Equal(t, "default.example.com", servedName(t, &crypto_tls.ClientHelloInfo{}))
+
+	// The default certificate's names aren't indexed.
+	assert.Equal(t, "default.example.com", servedName(t, &crypto_tls.ClientHelloInfo{ServerName: "default.example.com"}))
+}
+
+func TestReturnCertByClientSupport(t *testing.T) {
+	resetCertificates()
+	defer resetCertificates()
+
+	ca := newTestCA(t, "ca")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	rsaCert, rsaKeyFile := ca.issueKeyPairWithKey(t, rsaKey, x509.ExtKeyUsageServerAuth, "www.example.com")
+	ecdsaCert, ecdsaKeyFile := ca.issueKeyPairWithKey(t, ecdsaKey, x509.ExtKeyUsageServerAuth, "www.example.com")
+
+	// The RSA one is the main certificate, but ECDSA is preferred.
+	assert.Nil(t, loadCertificates("www.example.com", []config.CertificatePair{
+		{CertFile: rsaCert, KeyFile: rsaKeyFile},
+		{CertFile: ecdsaCert, KeyFile: ecdsaKeyFile},
+	}, config.OCSP{}))
+
+	modern := &crypto_tls.ClientHelloInfo{
+		ServerName:        "www.example.com",
+		SupportedVersions: []uint16{crypto_tls.VersionTLS13},
+		SignatureSchemes:  []crypto_tls.SignatureScheme{crypto_tls.ECDSAWithP256AndSHA256, crypto_tls.PSSWithSHA256},
+		SupportedCurves:   []crypto_tls.CurveID{crypto_tls.CurveP256},
+	}
+	cert, err := returnCert(modern)
+	assert.Nil(t, err)
+	assert.IsType(t, &ecdsa.PrivateKey{}, cert.PrivateKey)
+
+	rsaOnly := &crypto_tls.ClientHelloInfo{
+		ServerName:        "www.example.com",
+		SupportedVersions: []uint16{crypto_tls.VersionTLS13},
+		SignatureSchemes:  []crypto_tls.SignatureScheme{crypto_tls.PSSWithSHA256},
+		SupportedCurves:   []crypto_tls.CurveID{crypto_tls.CurveP256},
+	}
+	cert, err = returnCert(rsaOnly)
+	assert.Nil(t, err)
+	assert.IsType(t, &rsa.PrivateKey{}, cert.PrivateKey)
+}
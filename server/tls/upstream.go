@@ -0,0 +1,197 @@
+package tls
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	crypto_tls "crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+	"github.com/fabiocicerchia/go-proxy-cache/logger"
+)
+
+// caPools - Loaded CA bundles, by file.
+var caPools sync.Map
+
+// upstreamCerts - Loaded client certificates, by files.
+var upstreamCerts sync.Map
+
+// upstreamGeneration - Incremented whenever an upstream TLS file is reloaded.
+var upstreamGeneration atomic.Uint64
+
+// caPool - CA bundle, with the state of its file when loaded.
+type caPool struct {
+	pool  *x509.CertPool
+	state string
+}
+
+// upstreamCert - Client certificate, with the state of its files when loaded.
+type upstreamCert struct {
+	certFile string
+	keyFile  string
+	cert     *crypto_tls.Certificate
+	state    string
+}
+
+// UpstreamConfig - Returns the TLS configuration of the connections to the
+// upstream, shared by the proxy and the health checks.
+// When a file cannot be loaded the error is returned along with a
+// configuration trusting no CA, so the connections fail closed.
+// G402 (CWE-295): TLS InsecureSkipVerify may be true. (Confidence: LOW, Severity: HIGH)
+// It can be ignored as it is customisable, but the default is false.
+func UpstreamConfig(conf config.UpstreamTLS, insecure bool) (*crypto_tls.Config, error) {
+	tlsConfig := &crypto_tls.Config{
+		InsecureSkipVerify: insecure,
+		ServerName:         conf.ServerName,
+		MinVersion:         crypto_tls.VersionTLS12,
+	} // #nosec
+
+	if v, ok := config.UpstreamTLSVersions[conf.MinVersion]; ok {
+		tlsConfig.MinVersion = v
+	}
+
+	if conf.CAFile != "" {
+		pool, err := loadCAPool(conf.CAFile)
+		if err != nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+
+			return tlsConfig, err
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if conf.CertFile != "" && conf.KeyFile != "" {
+		cert, err := loadUpstreamCert(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+
+			return tlsConfig, err
+		}
+
+		tlsConfig.Certificates = []crypto_tls.Certificate{*cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// UpstreamGeneration - Changes whenever the upstream TLS files are reloaded,
+// so the configurations built from them can be replaced.
+func UpstreamGeneration() uint64 {
+	return upstreamGeneration.Load()
+}
+
+func loadCAPool(file string) (*x509.CertPool, error) {
+	if pool, ok := caPools.Load(file); ok {
+		return pool.(*caPool).pool, nil
+	}
+
+	state := getFilesState(file)
+
+	pool, err := readCAPool(file)
+	if err != nil {
+		return nil, err
+	}
+
+	caPools.Store(file, &caPool{pool: pool, state: state})
+
+	return pool, nil
+}
+
+func readCAPool(file string) (*x509.CertPool, error) {
+	caPEM, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+
+	return pool, nil
+}
+
+func loadUpstreamCert(certFile string, keyFile string) (*crypto_tls.Certificate, error) {
+	key := certFile + "\n" + keyFile
+	if cert, ok := upstreamCerts.Load(key); ok {
+		return cert.(*upstreamCert).cert, nil
+	}
+
+	state := getFilesState(certFile, keyFile)
+
+	cert, err := crypto_tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreamCerts.Store(key, &upstreamCert{certFile: certFile, keyFile: keyFile, cert: &cert, state: state})
+
+	return &cert, nil
+}
+
+// reloadUpstreamTLS - Reads again the upstream CA bundles and client
+// certificates, when forced even if unchanged. On failure the loaded ones
+// are kept (and they're retried on the next reload).
+func reloadUpstreamTLS(force bool) {
+	reloaded := false
+
+	caPools.Range(func(key, value any) bool {
+		file := key.(string)
+
+		state := getFilesState(file)
+		if !force && (state == "" || state == value.(*caPool).state) {
+			return true
+		}
+
+		pool, err := readCAPool(file)
+		if err != nil {
+			logger.GetGlobal().Errorf("Cannot reload the upstream CA %s: %s", file, err)
+			return true
+		}
+
+		caPools.Store(file, &caPool{pool: pool, state: state})
+		reloaded = true
+
+		logger.GetGlobal().Infof("Upstream CA %s reloaded.", file)
+
+		return true
+	})
+
+	upstreamCerts.Range(func(key, value any) bool {
+		source := value.(*upstreamCert)
+
+		state := getFilesState(source.certFile, source.keyFile)
+		if !force && (state == "" || state == source.state) {
+			return true
+		}
+
+		cert, err := crypto_tls.LoadX509KeyPair(source.certFile, source.keyFile)
+		if err != nil {
+			logger.GetGlobal().Errorf("Cannot reload the upstream client certificate %s: %s", source.certFile, err)
+			return true
+		}
+
+		upstreamCerts.Store(key, &upstreamCert{certFile: source.certFile, keyFile: source.keyFile, cert: &cert, state: state})
+		reloaded = true
+
+		logger.GetGlobal().Infof("Upstream client certificate %s reloaded.", source.certFile)
+
+		return true
+	})
+
+	if reloaded {
+		upstreamGeneration.Add(1)
+	}
+}
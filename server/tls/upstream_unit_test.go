@@ -0,0 +1,143 @@
+//go:build all || unit
+// +build all unit
+
+package tls
+
+//                                                                         __
+// .-----.-----.______.-----.----.-----.--.--.--.--.______.----.---.-.----|  |--.-----.
+// |  _  |  _  |______|  _  |   _|  _  |_   _|  |  |______|  __|  _  |  __|     |  -__|
+// |___  |_____|      |   __|__| |_____|__.__|___  |      |____|___._|____|__|__|_____|
+// |_____|            |__|                   |_____|
+//
+// Copyright (c) 2023 Fabio Cicerchia. https://fabiocicerchia.it. MIT License
+// Repo: https://github.com/fabiocicerchia/go-proxy-cache
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	crypto_tls "crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/fabiocicerchia/go-proxy-cache/config"
+)
+
+// issueKeyPair - Returns a certificate issued by the CA (for the name, or a
+// client certificate when empty) and its key, written as PEM files.
+func (ca testCA) issueKeyPair(t *testing.T, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	if name == "" {
+		return ca.issueKeyPairWithKey(t, key, x509.ExtKeyUsageClientAuth)
+	}
+
+	return ca.issueKeyPairWithKey(t, key, x509.ExtKeyUsageServerAuth, name)
+}
+
+func (ca testCA) issueKeyPairWithKey(t *testing.T, key crypto.Signer, usage x509.ExtKeyUsage, names ...string) (string, string) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-1 * time.Hour),
+		NotAfter:     time.Now().Add(1 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     names,
+	}
+	if len(names) > 0 {
+		template.Subject.CommonName = names[0]
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	assert.Nil(t, err)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	assert.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
+
+func TestUpstreamConfigDefaults(t *testing.T) {
+	c, err := UpstreamConfig(config.UpstreamTLS{}, true)
+	assert.Nil(t, err)
+
+	assert.True(t, c.InsecureSkipVerify)
+	assert.Nil(t, c.RootCAs)
+	assert.Empty(t, c.Certificates)
+	assert.Equal(t, uint16(crypto_tls.VersionTLS12), c.MinVersion)
+
+	c, err = UpstreamConfig(config.UpstreamTLS{ServerName: "origin.internal", MinVersion: "1.3"}, false)
+	assert.Nil(t, err)
+
+	assert.False(t, c.InsecureSkipVerify)
+	assert.Equal(t, "origin.internal", c.ServerName)
+	assert.Equal(t, uint16(crypto_tls.VersionTLS13), c.MinVersion)
+}
+
+func TestUpstreamConfigFailsClosed(t *testing.T) {
+	c, err := UpstreamConfig(config.UpstreamTLS{CAFile: filepath.Join(t.TempDir(), "missing.pem")}, false)
+	assert.NotNil(t, err)
+	assert.NotNil(t, c.RootCAs)
+
+	ca := newTestCA(t, "ca")
+	c, err = UpstreamConfig(config.UpstreamTLS{CAFile: ca.file, CertFile: ca.file, KeyFile: ca.file}, false)
+	assert.NotNil(t, err)
+	assert.Empty(t, c.Certificates)
+}
+
+func TestUpstreamConfigMutualTLS(t *testing.T) {
+	ca := newTestCA(t, "ca")
+	serverCert, serverKey := ca.issueKeyPair(t, "origin.internal")
+	clientCert, clientKey := ca.issueKeyPair(t, "")
+
+	cert, err := crypto_tls.LoadX509KeyPair(serverCert, serverKey)
+	assert.Nil(t, err)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca.cert)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &crypto_tls.Config{
+		Certificates: []crypto_tls.Certificate{cert},
+		ClientAuth:   crypto_tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	conf := config.UpstreamTLS{CAFile: ca.file, CertFile: clientCert, KeyFile: clientKey, ServerName: "origin.internal"}
+
+	tlsConfig, err := UpstreamConfig(conf, false)
+	assert.Nil(t, err)
+
+	res, err := (&http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}).Get(srv.URL)
+	assert.Nil(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// Without the SNI override the certificate doesn't match the address.
+	conf.ServerName = ""
+	tlsConfig, _ = UpstreamConfig(conf, false)
+	_, err = (&http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}).Get(srv.URL)
+	assert.NotNil(t, err)
+}
@@ -60,7 +60,8 @@ func copyResponse(dst io.Writer, chunks [][]byte) {
 }
 
 // ServeCachedResponse - Serve a cached response.
-func ServeCachedResponse(ctx context.Context, lwr *response.LoggedResponseWriter, uriobj cache.URIObj) {
+// The cached headers can be altered via rewriteHeaders before being sent (nil to skip).
+func ServeCachedResponse(ctx context.Context, lwr *response.LoggedResponseWriter, uriobj cache.URIObj, rewriteHeaders func(http.Header)) {
 	ctxWC, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -77,7 +78,7 @@ func ServeCachedResponse(ctx context.Context, lwr *response.LoggedResponseWriter
 		Header:     uriobj.ResponseHeaders,
 	}
 
-	announcedTrailers := handleHeaders(lwr, res)
+	announcedTrailers := handleHeaders(lwr, res, rewriteHeaders)
 
 	// @deprecated
 	PushProxiedResources(lwr, &uriobj)
@@ -86,7 +87,7 @@ func ServeCachedResponse(ctx context.Context, lwr *response.LoggedResponseWriter
 	handleTrailer(announcedTrailers, lwr, res)
 }
 
-func handleHeaders(lwr *response.LoggedResponseWriter, res http.Response) int {
+func handleHeaders(lwr *response.LoggedResponseWriter, res http.Response, rewriteHeaders func(http.Header)) int {
 	removeConnectionHeaders(res.Header)
 
 	for _, h := range HopHeaders {
@@ -96,6 +97,10 @@ func handleHeaders(lwr *response.LoggedResponseWriter, res http.Response) int {
 	res.Header.Del(response.CacheStatusHeader)
 	lwr.CopyHeaders(res.Header)
 
+	if rewriteHeaders != nil {
+		rewriteHeaders(lwr.Header())
+	}
+
 	// The "Trailer" header isn't included in the Transport's response,
 	// at least for *http.Transport. Build it up from Trailer.
 	announcedTrailers := len(res.Trailer)
@@ -130,6 +130,102 @@ var (
 		},
 		[]string{"env", "hostname", "server"},
 	)
+	rateLimitAllowed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gpc",
+			Name:      "rate_limit_allowed_total",
+			Help:      "The amount of requests allowed by the rate limiter",
+		},
+		[]string{"env", "hostname", "server"},
+	)
+	rateLimitLimited = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gpc",
+			Name:      "rate_limit_limited_total",
+			Help:      "The amount of requests rejected by the rate limiter",
+		},
+		[]string{"env", "hostname", "server"},
+	)
+	rateLimitFallback = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gpc",
+			Name:      "rate_limit_fallback_total",
+			Help:      "The amount of requests checked by the local rate limiter (Redis unavailable)",
+		},
+		[]string{"env", "hostname", "server"},
+	)
+	concurrencyInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "gpc",
+			Name:      "concurrency_in_flight",
+			Help:      "The amount of in-flight requests sent to the upstream",
+		},
+		[]string{"env", "hostname", "upstream"},
+	)
+	concurrencyQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "gpc",
+			Name:      "concurrency_queue_depth",
+			Help:      "The amount of requests waiting for a free upstream slot",
+		},
+		[]string{"env", "hostname", "upstream"},
+	)
+	concurrencyShed = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gpc",
+			Name:      "concurrency_shed_total",
+			Help:      "The amount of requests shed by the concurrency limiter",
+		},
+		[]string{"env", "hostname", "server", "upstream", "response"},
+	)
+	grpcStatus = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gpc",
+			Name:      "grpc_status_total",
+			Help:      "Distribution by gRPC status codes",
+		},
+		[]string{"env", "hostname", "server", "upstream", "code"},
+	)
+	webSocketConnections = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "gpc",
+			Name:      "websocket_connections",
+			Help:      "The amount of open WebSocket connections",
+		},
+		[]string{"env", "hostname", "server", "upstream"},
+	)
+	webSocketRejected = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gpc",
+			Name:      "websocket_rejected_total",
+			Help:      "The amount of WebSocket connections rejected",
+		},
+		[]string{"env", "hostname", "server", "reason"},
+	)
+	webSocketBytes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gpc",
+			Name:      "websocket_bytes_total",
+			Help:      "The amount of bytes exchanged over the WebSocket connections",
+		},
+		[]string{"env", "hostname", "server", "upstream", "direction"},
+	)
+	webSocketMessages = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gpc",
+			Name:      "websocket_messages_total",
+			Help:      "The amount of messages exchanged over the WebSocket connections",
+		},
+		[]string{"env", "hostname", "server", "upstream", "direction"},
+	)
+	webSocketCloseCodes = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "gpc",
+			Name:      "websocket_close_codes_total",
+			Help:      "Distribution by WebSocket close codes",
+		},
+		[]string{"env", "hostname", "server", "upstream", "code"},
+	)
 
 	// EE Metrics --------------------------------------------------------------
 	gpceeBuildInfo = prometheus.NewGaugeVec(
@@ -258,6 +354,10 @@ func Register() {
 		request1xx, request2xx, request3xx, request4xx, request5xx,
 		hostHealthy, hostUnhealthy,
 		cacheHit, cacheMiss, cacheStale,
+		rateLimitAllowed, rateLimitLimited, rateLimitFallback,
+		concurrencyInFlight, concurrencyQueueDepth, concurrencyShed,
+		grpcStatus,
+		webSocketConnections, webSocketRejected, webSocketBytes, webSocketMessages, webSocketCloseCodes,
 
 		// EE Metrics --------------------------------------------------------------
 		wholeRequest, wholeResponse,
@@ -334,6 +434,71 @@ func IncCacheHit(server string) {
 	cacheHit.With(baseLabels(prometheus.Labels{"server": server})).Inc()
 }
 
+// IncRateLimitAllowed - Increments metrics for gpc_rate_limit_allowed_total.
+func IncRateLimitAllowed(server string) {
+	rateLimitAllowed.With(baseLabels(prometheus.Labels{"server": server})).Inc()
+}
+
+// IncRateLimitLimited - Increments metrics for gpc_rate_limit_limited_total.
+func IncRateLimitLimited(server string) {
+	rateLimitLimited.With(baseLabels(prometheus.Labels{"server": server})).Inc()
+}
+
+// IncRateLimitFallback - Increments metrics for gpc_rate_limit_fallback_total.
+func IncRateLimitFallback(server string) {
+	rateLimitFallback.With(baseLabels(prometheus.Labels{"server": server})).Inc()
+}
+
+// SetConcurrencyInFlight - Sets metrics for gpc_concurrency_in_flight.
+func SetConcurrencyInFlight(upstream string, val float64) {
+	concurrencyInFlight.With(baseLabels(prometheus.Labels{"upstream": upstream})).Set(val)
+}
+
+// SetConcurrencyQueueDepth - Sets metrics for gpc_concurrency_queue_depth.
+func SetConcurrencyQueueDepth(upstream string, val float64) {
+	concurrencyQueueDepth.With(baseLabels(prometheus.Labels{"upstream": upstream})).Set(val)
+}
+
+// IncConcurrencyShed - Increments metrics for gpc_concurrency_shed_total.
+func IncConcurrencyShed(server string, upstream string, response string) {
+	concurrencyShed.With(baseLabels(prometheus.Labels{"server": server, "upstream": upstream, "response": response})).Inc()
+}
+
+// IncGRPCStatus - Increments metrics for gpc_grpc_status_total.
+func IncGRPCStatus(server string, upstream string, code string) {
+	grpcStatus.With(baseLabels(prometheus.Labels{"server": server, "upstream": upstream, "code": code})).Inc()
+}
+
+// IncWebSocketConnections - Increments metrics for gpc_websocket_connections.
+func IncWebSocketConnections(server string, upstream string) {
+	webSocketConnections.With(baseLabels(prometheus.Labels{"server": server, "upstream": upstream})).Inc()
+}
+
+// DecWebSocketConnections - Decrements metrics for gpc_websocket_connections.
+func DecWebSocketConnections(server string, upstream string) {
+	webSocketConnections.With(baseLabels(prometheus.Labels{"server": server, "upstream": upstream})).Dec()
+}
+
+// IncWebSocketRejected - Increments metrics for gpc_websocket_rejected_total.
+func IncWebSocketRejected(server string, reason string) {
+	webSocketRejected.With(baseLabels(prometheus.Labels{"server": server, "reason": reason})).Inc()
+}
+
+// IncWebSocketBytes - Increments metrics for gpc_websocket_bytes_total.
+func IncWebSocketBytes(server string, upstream string, direction string, val float64) {
+	webSocketBytes.With(baseLabels(prometheus.Labels{"server": server, "upstream": upstream, "direction": direction})).Add(val)
+}
+
+// IncWebSocketMessages - Increments metrics for gpc_websocket_messages_total.
+func IncWebSocketMessages(server string, upstream string, direction string) {
+	webSocketMessages.With(baseLabels(prometheus.Labels{"server": server, "upstream": upstream, "direction": direction})).Inc()
+}
+
+// IncWebSocketCloseCode - Increments metrics for gpc_websocket_close_codes_total.
+func IncWebSocketCloseCode(server string, upstream string, code string) {
+	webSocketCloseCodes.With(baseLabels(prometheus.Labels{"server": server, "upstream": upstream, "code": code})).Inc()
+}
+
 // SetHostHealthy - Increments metrics for gpc_host_healthy.
 func SetHostHealthy(val float64) {
 	hostHealthy.With(baseLabels(nil)).Set(val)
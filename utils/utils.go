@@ -89,3 +89,13 @@ func StripPort(val string) string {
 
 	return val
 }
+
+// HasPathPrefix - Tells whether the path starts with the prefix on a segment
+// boundary, e.g. "/api" matches "/api" and "/api/users" but not "/apis".
+func HasPathPrefix(path string, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
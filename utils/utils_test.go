@@ -164,6 +164,32 @@ func TestStripPortIPv6WithoutPort(t *testing.T) {
 	tearDown()
 }
 
+// --- HasPathPrefix
+
+func TestHasPathPrefixExact(t *testing.T) {
+	assert.True(t, utils.HasPathPrefix("/api", "/api"))
+	assert.True(t, utils.HasPathPrefix("/api/", "/api/"))
+
+	tearDown()
+}
+
+func TestHasPathPrefixSegment(t *testing.T) {
+	assert.True(t, utils.HasPathPrefix("/api/users", "/api"))
+	assert.True(t, utils.HasPathPrefix("/api/users", "/api/"))
+	assert.True(t, utils.HasPathPrefix("/users", "/"))
+
+	tearDown()
+}
+
+func TestHasPathPrefixPartialSegment(t *testing.T) {
+	assert.False(t, utils.HasPathPrefix("/apis", "/api"))
+	assert.False(t, utils.HasPathPrefix("/api-docs/index.html", "/api"))
+	assert.False(t, utils.HasPathPrefix("/api", "/api/"))
+	assert.False(t, utils.HasPathPrefix("/other", "/api"))
+
+	tearDown()
+}
+
 func tearDown() {
 	config.Config = config.Configuration{}
 	os.Unsetenv("testing")